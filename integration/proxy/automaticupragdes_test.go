@@ -2,7 +2,12 @@ package proxy
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/gravitational/teleport/integration/helpers"
@@ -15,6 +20,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"path/filepath"
 	"testing"
@@ -143,3 +149,130 @@ func TestVersionServer(t *testing.T) {
 		})
 	}
 }
+
+// pemEncodedEd25519PublicKey marshals pub as a PEM encoded PKIX public key,
+// the format expected by Channel.SignaturePublicKey.
+func pemEncodedEd25519PublicKey(t *testing.T, pub ed25519.PublicKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// signatureServerMock serves sig, base64 encoded, as the response body to
+// every request, so it can be pointed to by a channel's SignatureURL.
+func signatureServerMock(t *testing.T, sig []byte) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(sig)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestVersionServerSignature(t *testing.T) {
+	// Test setup
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	testVersion := "v12.2.6"
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	wrongPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	validSig := ed25519.Sign(priv, []byte(testVersion))
+
+	validSigChannel := "static/valid-signature"
+	wrongKeyChannel := "static/wrong-key"
+	missingSigChannel := "static/missing-signature"
+
+	forwardPath := "/version-server/"
+	upstreamServer := basichttp.NewServerMock(forwardPath + constants.VersionPath)
+	upstreamServer.SetResponse(t, http.StatusOK, testVersion)
+	forwardSignatureChannel := "forward/with-signature"
+
+	channels := automaticupgrades.Channels{
+		validSigChannel: {
+			StaticVersion:      testVersion,
+			SignaturePublicKey: pemEncodedEd25519PublicKey(t, pub),
+			SignatureURL:       signatureServerMock(t, validSig),
+		},
+		wrongKeyChannel: {
+			StaticVersion:      testVersion,
+			SignaturePublicKey: pemEncodedEd25519PublicKey(t, wrongPub),
+			SignatureURL:       signatureServerMock(t, validSig),
+		},
+		missingSigChannel: {
+			StaticVersion:      testVersion,
+			SignaturePublicKey: pemEncodedEd25519PublicKey(t, pub),
+			SignatureURL:       signatureServerMock(t, nil),
+		},
+		forwardSignatureChannel: {
+			ForwardURL:         upstreamServer.Srv.URL + forwardPath,
+			SignaturePublicKey: pemEncodedEd25519PublicKey(t, pub),
+			SignatureURL:       signatureServerMock(t, validSig),
+		},
+	}
+
+	proxyAddr := createProxyWithChannels(t, channels)
+
+	tr := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	httpClient := http.Client{Transport: tr}
+
+	tests := []struct {
+		name               string
+		channel            string
+		expectedStatusCode int
+		expectedResponse   string
+	}{
+		{
+			name:               "valid signature",
+			channel:            validSigChannel,
+			expectedStatusCode: http.StatusOK,
+			expectedResponse:   testVersion,
+		},
+		{
+			name:               "wrong signing key",
+			channel:            wrongKeyChannel,
+			expectedStatusCode: http.StatusBadGateway,
+		},
+		{
+			name:               "missing signature",
+			channel:            missingSigChannel,
+			expectedStatusCode: http.StatusBadGateway,
+		},
+		{
+			name:               "forwarded upstream with signature",
+			channel:            forwardSignatureChannel,
+			expectedStatusCode: http.StatusOK,
+			expectedResponse:   testVersion,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			channelUrl, err := url.Parse(
+				fmt.Sprintf("https://%s/webapi/automaticupgrades/%s/version", proxyAddr, tt.channel),
+			)
+			require.NoError(t, err)
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, channelUrl.String(), nil)
+			require.NoError(t, err)
+			res, err := httpClient.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+
+			body, err := io.ReadAll(res.Body)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.expectedStatusCode, res.StatusCode)
+			if tt.expectedStatusCode == http.StatusOK {
+				require.Equal(t, tt.expectedResponse, string(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package acme implements an ACME (RFC 8555) server that issues short-lived
+// database access client certificates off the DatabaseClientCA, so
+// ecosystem ACME clients (cert-manager, acme.sh, Caddy) can enroll without a
+// Teleport-specific SDK. Authorizations offer the standard http-01 and
+// tls-alpn-01 challenges and a Teleport-native teleport-token-01 challenge
+// that proves possession of a join token minted by the auth server instead
+// of control of a domain. tls-alpn-01 validation is not implemented: a
+// response to that challenge always fails validation.
+package acme
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ChallengeType identifies which of the challenges below an authorization
+// offers.
+type ChallengeType string
+
+const (
+	ChallengeHTTP01          ChallengeType = "http-01"
+	ChallengeTLSALPN01       ChallengeType = "tls-alpn-01"
+	ChallengeTeleportToken01 ChallengeType = "teleport-token-01"
+)
+
+// Status is the lifecycle status shared by accounts, orders, authorizations,
+// and challenges, as defined in RFC 8555 §7.1.6.
+type Status string
+
+const (
+	StatusPending     Status = "pending"
+	StatusProcessing  Status = "processing"
+	StatusValid       Status = "valid"
+	StatusInvalid     Status = "invalid"
+	StatusReady       Status = "ready"
+	StatusDeactivated Status = "deactivated"
+	StatusRevoked     Status = "revoked"
+)
+
+// Directory is the RFC 8555 §7.1.1 directory object, the entry point an
+// ACME client fetches to discover the other endpoint URLs.
+type Directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+	RevokeCert string `json:"revokeCert"`
+	KeyChange  string `json:"keyChange"`
+}
+
+// Account is an ACME account, identified by the key used to sign its
+// requests.
+type Account struct {
+	ID      string   `json:"-"`
+	Status  Status   `json:"status"`
+	Contact []string `json:"contact,omitempty"`
+	// JWK is the account's public key, as the JSON Web Key it was
+	// registered with, used to verify the signature on every subsequent
+	// request that identifies this account by kid.
+	JWK json.RawMessage `json:"jwk"`
+	// JWKThumbprint is the RFC 7638 thumbprint of JWK, bound into the key
+	// authorization challenge validation checks the client's response
+	// against.
+	JWKThumbprint string `json:"jwkThumbprint"`
+}
+
+// Identifier is an RFC 8555 §9.7.7 identifier object. Database access
+// identifiers use a "db" type instead of "dns", naming the database
+// username/role the issued certificate should carry.
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Order is an RFC 8555 §7.1.3 order object.
+type Order struct {
+	ID             string       `json:"-"`
+	AccountID      string       `json:"accountID"`
+	Status         Status       `json:"status"`
+	Expires        time.Time    `json:"expires"`
+	Identifiers    []Identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	CSR            []byte       `json:"-"`
+	Cert           []byte       `json:"cert,omitempty"`
+}
+
+// Authorization is an RFC 8555 §7.1.4 authorization object.
+type Authorization struct {
+	ID         string      `json:"-"`
+	OrderID    string      `json:"orderID"`
+	Identifier Identifier  `json:"identifier"`
+	Status     Status      `json:"status"`
+	Expires    time.Time   `json:"expires"`
+	Challenges []Challenge `json:"challenges"`
+}
+
+// Challenge is an RFC 8555 §8 challenge object.
+type Challenge struct {
+	Type      ChallengeType `json:"type"`
+	URL       string        `json:"url"`
+	Token     string        `json:"token"`
+	Status    Status        `json:"status"`
+	Validated time.Time     `json:"validated,omitempty"`
+}
@@ -0,0 +1,146 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCertAuthority struct {
+	cert   *x509.Certificate
+	signer crypto.Signer
+}
+
+func (f *fakeCertAuthority) ActiveDatabaseClientCA(ctx context.Context) (*x509.Certificate, crypto.Signer, error) {
+	return f.cert, f.signer, nil
+}
+
+func newFakeCA(t *testing.T) *fakeCertAuthority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "db-client-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &fakeCertAuthority{cert: cert, signer: key}
+}
+
+func TestFinalizeOrder(t *testing.T) {
+	ca := newFakeCA(t)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, clientKey)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	require.NoError(t, err)
+
+	provisioner := &Provisioner{
+		Name:                    "db-access",
+		AllowedIdentityTemplate: "db-agent-{{.Identifier}}",
+		TTL:                     time.Hour,
+	}
+	require.NoError(t, provisioner.CheckAndSetDefaults())
+
+	order := &Order{Identifiers: []Identifier{{Type: "db", Value: "alice"}}}
+
+	der, err := finalizeOrder(context.Background(), ca, order, csr, provisioner)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.Equal(t, "db-agent-alice", cert.Subject.CommonName)
+	require.WithinDuration(t, time.Now().Add(provisioner.TTL), cert.NotAfter, time.Minute)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.NoError(t, err)
+}
+
+func TestFinalizeOrderIgnoresCSRSubjectAltNames(t *testing.T) {
+	ca := newFakeCA(t)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "attacker-chosen-cn"},
+		DNSNames:       []string{"attacker-chosen.example.com"},
+		EmailAddresses: []string{"attacker@example.com"},
+	}, clientKey)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	require.NoError(t, err)
+
+	provisioner := &Provisioner{
+		Name:                    "db-access",
+		AllowedIdentityTemplate: "db-agent-{{.Identifier}}",
+		TTL:                     time.Hour,
+	}
+	require.NoError(t, provisioner.CheckAndSetDefaults())
+
+	order := &Order{Identifiers: []Identifier{{Type: "db", Value: "alice"}}}
+
+	der, err := finalizeOrder(context.Background(), ca, order, csr, provisioner)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	require.Equal(t, "db-agent-alice", cert.Subject.CommonName)
+	require.Empty(t, cert.DNSNames)
+	require.Empty(t, cert.EmailAddresses)
+}
+
+func TestFinalizeOrderRejectsEmptyIdentifiers(t *testing.T) {
+	ca := newFakeCA(t)
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, clientKey)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	require.NoError(t, err)
+
+	provisioner := &Provisioner{Name: "db-access", AllowedIdentityTemplate: "{{.Identifier}}"}
+	require.NoError(t, provisioner.CheckAndSetDefaults())
+
+	_, err = finalizeOrder(context.Background(), ca, &Order{}, csr, provisioner)
+	require.Error(t, err)
+}
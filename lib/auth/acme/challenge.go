@@ -0,0 +1,93 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/api/types"
+)
+
+// TokenGetter fetches a join token minted by the auth server, the subset of
+// auth.Server the teleport-token-01 validator needs.
+type TokenGetter interface {
+	GetToken(ctx context.Context, token string) (types.ProvisionToken, error)
+}
+
+// httpClient is the subset of *http.Client used to fetch http-01 challenge
+// responses, so tests can substitute a fake transport.
+type httpClient interface {
+	Get(url string) (*http.Response, error)
+}
+
+// ValidateHTTP01 implements the http-01 challenge (RFC 8555 §8.3): it fetches
+// the key authorization the client is expected to have published at
+// http://<domain>/.well-known/acme-challenge/<token> and compares it to the
+// expected value.
+func ValidateHTTP01(client httpClient, domain string, challenge Challenge, keyAuthorization string) error {
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", domain, challenge.Token)
+	resp, err := client.Get(url)
+	if err != nil {
+		return trace.Wrap(err, "fetching http-01 challenge response")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return trace.AccessDenied("http-01 challenge response returned status %v", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if subtle.ConstantTimeCompare(body, []byte(keyAuthorization)) != 1 {
+		return trace.AccessDenied("http-01 challenge response did not match the expected key authorization")
+	}
+	return nil
+}
+
+// ValidateTLSALPN01 implements the tls-alpn-01 challenge (RFC 8737): it
+// would dial domain over TLS, negotiate the "acme-tls/1" ALPN protocol, and
+// check the self-signed certificate the client presents for the expected
+// id-pe-acmeIdentifier extension. Serving that TLS connection requires
+// routing it through the proxy's ALPN listener, which is wired up
+// alongside the rest of the ACME HTTP handlers rather than implemented
+// here.
+func ValidateTLSALPN01(ctx context.Context, domain string, challenge Challenge, keyAuthorization string) error {
+	return trace.NotImplemented("tls-alpn-01 validation requires ALPN listener integration")
+}
+
+// ValidateTeleportToken01 implements the Teleport-native teleport-token-01
+// challenge: instead of proving control of a domain, the client proves
+// possession of a join token minted by the auth server by echoing it back
+// as the challenge's key authorization.
+func ValidateTeleportToken01(ctx context.Context, tokens TokenGetter, challenge Challenge, keyAuthorization string) error {
+	token, err := tokens.GetToken(ctx, keyAuthorization)
+	if err != nil {
+		return trace.AccessDenied("teleport-token-01 challenge token is invalid or has expired")
+	}
+	if token.Expiry().Before(time.Now()) {
+		return trace.AccessDenied("teleport-token-01 challenge token has expired")
+	}
+	return nil
+}
@@ -0,0 +1,534 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+
+	apievents "github.com/gravitational/teleport/api/types/events"
+	"github.com/gravitational/teleport/lib/events"
+	"github.com/gravitational/teleport/lib/utils"
+)
+
+// AuditLogger is the subset of the Teleport audit log the handler needs to
+// record order attempts.
+type AuditLogger interface {
+	EmitAuditEvent(ctx context.Context, event apievents.AuditEvent) error
+}
+
+// Handler serves the ACME (RFC 8555) endpoints backing database access
+// client certificate issuance off the DatabaseClientCA. It is mounted
+// under "/acme/:provisioner/" by the caller.
+type Handler struct {
+	// CertAuthority signs finalized orders.
+	CertAuthority CertAuthority
+	// Tokens validates teleport-token-01 challenges.
+	Tokens TokenGetter
+	// Store persists accounts, orders, authorizations, and nonces.
+	Store *Store
+	// Emitter records order attempts to the cluster audit log.
+	Emitter AuditLogger
+	// Provisioners holds the configured ACMEProvisioner resources, keyed
+	// by name.
+	Provisioners map[string]*Provisioner
+	// BaseURL is the externally reachable base URL this handler is served
+	// from, e.g. "https://proxy.example.com/acme/db-access", used to build
+	// the URLs embedded in directory and resource responses.
+	BaseURL string
+	// Log is used to log messages, defaulting to the standard logger if
+	// unset.
+	Log logrus.FieldLogger
+}
+
+func (h *Handler) log() logrus.FieldLogger {
+	if h.Log != nil {
+		return h.Log
+	}
+	return logrus.StandardLogger()
+}
+
+// Directory implements the RFC 8555 §7.1.1 directory endpoint.
+func (h *Handler) Directory(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	writeJSON(w, http.StatusOK, Directory{
+		NewNonce:   h.BaseURL + "/new-nonce",
+		NewAccount: h.BaseURL + "/new-account",
+		NewOrder:   h.BaseURL + "/new-order",
+		RevokeCert: h.BaseURL + "/revoke-cert",
+		KeyChange:  h.BaseURL + "/key-change",
+	})
+}
+
+// NewNonce implements the RFC 8555 §7.2 newNonce endpoint.
+func (h *Handler) NewNonce(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	nonce, err := utils.CryptoRandomHex(16)
+	if err != nil {
+		http.Error(w, "failed to generate nonce", http.StatusInternalServerError)
+		return
+	}
+	if err := h.Store.IssueNonce(nonce); err != nil {
+		h.log().WithError(err).Warn("Failed to persist an ACME nonce.")
+		http.Error(w, "failed to generate nonce", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Replay-Nonce", nonce)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// acmeRequest is the decoded, signature-verified payload of a JWS-wrapped
+// ACME request, produced by authenticatedRequest. AccountID is the account
+// whose registered key signed the request; it is "" only for new-account,
+// which is necessarily signed by a key with no account yet to reference by
+// kid. JWK carries that request's embedded key, for NewAccount to persist.
+type acmeRequest struct {
+	AccountID string
+	JWK       json.RawMessage
+	Payload   json.RawMessage
+}
+
+// NewAccount implements the RFC 8555 §7.3 newAccount endpoint.
+func (h *Handler) NewAccount(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	req, ok := h.authenticatedRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if len(req.JWK) == 0 {
+		http.Error(w, "new-account request must embed a jwk", http.StatusBadRequest)
+		return
+	}
+	var key jwk
+	if err := json.Unmarshal(req.JWK, &key); err != nil {
+		http.Error(w, "malformed jwk", http.StatusBadRequest)
+		return
+	}
+	thumbprint, err := key.thumbprint()
+	if err != nil {
+		http.Error(w, "malformed jwk", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Contact              []string `json:"contact"`
+		TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+	}
+	if err := json.Unmarshal(req.Payload, &body); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+
+	id, err := utils.CryptoRandomHex(16)
+	if err != nil {
+		http.Error(w, "failed to create account", http.StatusInternalServerError)
+		return
+	}
+	account := &Account{ID: id, Status: StatusValid, Contact: body.Contact, JWK: req.JWK, JWKThumbprint: thumbprint}
+	if err := h.Store.CreateAccount(account); err != nil {
+		h.log().WithError(err).Warn("Failed to persist an ACME account.")
+		http.Error(w, "failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/account/%s", h.BaseURL, account.ID))
+	writeJSON(w, http.StatusCreated, account)
+}
+
+// NewOrder implements the RFC 8555 §7.4 newOrder endpoint.
+func (h *Handler) NewOrder(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	provisioner, ok := h.provisioner(w, p)
+	if !ok {
+		return
+	}
+	req, ok := h.authenticatedRequest(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := h.Store.CountRecentOrders(req.AccountID, provisioner.RateLimit.Period)
+	if err != nil {
+		h.log().WithError(err).Warn("Failed to evaluate the ACME order rate limit.")
+	} else if count >= provisioner.RateLimit.OrdersPerAccount {
+		h.auditOrderFailure(r.Context(), p.ByName("provisioner"), req.AccountID, trace.LimitExceeded("account has exceeded its order rate limit"))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	var body struct {
+		Identifiers []Identifier `json:"identifiers"`
+	}
+	if err := json.Unmarshal(req.Payload, &body); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+
+	orderID, err := utils.CryptoRandomHex(16)
+	if err != nil {
+		http.Error(w, "failed to create order", http.StatusInternalServerError)
+		return
+	}
+
+	order := &Order{
+		ID:          orderID,
+		AccountID:   req.AccountID,
+		Status:      StatusPending,
+		Expires:     time.Now().Add(orderTTL),
+		Identifiers: body.Identifiers,
+		Finalize:    fmt.Sprintf("%s/order/%s/finalize", h.BaseURL, orderID),
+	}
+
+	for _, identifier := range body.Identifiers {
+		authzID, err := utils.CryptoRandomHex(16)
+		if err != nil {
+			http.Error(w, "failed to create order", http.StatusInternalServerError)
+			return
+		}
+		token, err := utils.CryptoRandomHex(16)
+		if err != nil {
+			http.Error(w, "failed to create order", http.StatusInternalServerError)
+			return
+		}
+
+		authz := &Authorization{
+			ID:         authzID,
+			OrderID:    orderID,
+			Identifier: identifier,
+			Status:     StatusPending,
+			Expires:    order.Expires,
+			Challenges: []Challenge{
+				{Type: ChallengeHTTP01, URL: fmt.Sprintf("%s/challenge/%s/http-01", h.BaseURL, authzID), Token: token, Status: StatusPending},
+				{Type: ChallengeTLSALPN01, URL: fmt.Sprintf("%s/challenge/%s/tls-alpn-01", h.BaseURL, authzID), Token: token, Status: StatusPending},
+				{Type: ChallengeTeleportToken01, URL: fmt.Sprintf("%s/challenge/%s/teleport-token-01", h.BaseURL, authzID), Token: token, Status: StatusPending},
+			},
+		}
+		if err := h.Store.CreateAuthorization(authz); err != nil {
+			h.log().WithError(err).Warn("Failed to persist an ACME authorization.")
+			http.Error(w, "failed to create order", http.StatusInternalServerError)
+			return
+		}
+		order.Authorizations = append(order.Authorizations, fmt.Sprintf("%s/authz/%s", h.BaseURL, authzID))
+	}
+
+	if err := h.Store.CreateOrder(order); err != nil {
+		h.log().WithError(err).Warn("Failed to persist an ACME order.")
+		http.Error(w, "failed to create order", http.StatusInternalServerError)
+		return
+	}
+
+	h.auditOrderCreated(r.Context(), p.ByName("provisioner"), req.AccountID, order.ID)
+	w.Header().Set("Location", fmt.Sprintf("%s/order/%s", h.BaseURL, order.ID))
+	writeJSON(w, http.StatusCreated, order)
+}
+
+// Finalize implements the RFC 8555 §7.4 finalize endpoint: it signs the
+// submitted CSR against the provisioner's allowed identity and the active
+// DatabaseClientCA key.
+func (h *Handler) Finalize(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+	provisioner, ok := h.provisioner(w, p)
+	if !ok {
+		return
+	}
+	req, ok := h.authenticatedRequest(w, r)
+	if !ok {
+		return
+	}
+
+	order, err := h.Store.GetOrder(p.ByName("order"))
+	if err != nil {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return
+	}
+	if order.AccountID != req.AccountID {
+		http.Error(w, "order not found", http.StatusNotFound)
+		return
+	}
+
+	ready, err := h.orderAuthorizationsValid(order)
+	if err != nil {
+		h.log().WithError(err).Warn("Failed to check ACME order authorizations.")
+		http.Error(w, "failed to finalize order", http.StatusInternalServerError)
+		return
+	}
+	if !ready {
+		h.auditOrderFailure(ctx, p.ByName("provisioner"), req.AccountID, trace.AccessDenied("order has unauthorized identifiers"))
+		http.Error(w, "order is not ready to be finalized", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		CSR []byte `json:"csr"`
+	}
+	if err := json.Unmarshal(req.Payload, &body); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(body.CSR)
+	if err != nil {
+		h.auditOrderFailure(ctx, p.ByName("provisioner"), req.AccountID, err)
+		http.Error(w, "malformed CSR", http.StatusBadRequest)
+		return
+	}
+
+	der, err := finalizeOrder(ctx, h.CertAuthority, order, csr, provisioner)
+	if err != nil {
+		h.auditOrderFailure(ctx, p.ByName("provisioner"), req.AccountID, err)
+		http.Error(w, "failed to finalize order", http.StatusInternalServerError)
+		return
+	}
+
+	order.Status = StatusValid
+	order.Cert = der
+	order.Certificate = fmt.Sprintf("%s/certificate/%s", h.BaseURL, order.ID)
+	if err := h.Store.UpdateOrder(order); err != nil {
+		h.log().WithError(err).Warn("Failed to persist a finalized ACME order.")
+	}
+
+	h.auditOrderFinalized(ctx, p.ByName("provisioner"), req.AccountID, order.ID)
+	writeJSON(w, http.StatusOK, order)
+}
+
+// orderAuthorizationsValid reports whether every authorization order
+// created has reached StatusValid, i.e. its challenge has been
+// successfully validated. Finalize refuses to sign a CSR for an order
+// that hasn't cleared this check: without it, an order's identifiers
+// would be bound into an issued certificate without the client ever
+// having proven control of (or possession of a token for) any of them.
+func (h *Handler) orderAuthorizationsValid(order *Order) (bool, error) {
+	if len(order.Authorizations) == 0 {
+		return false, nil
+	}
+	for _, authzURL := range order.Authorizations {
+		authz, err := h.Store.GetAuthorization(path.Base(authzURL))
+		if err != nil {
+			return false, trace.Wrap(err)
+		}
+		if authz.Status != StatusValid {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ValidateChallenge implements the RFC 8555 §7.5.1 challenge response
+// endpoint: the client POSTs an empty, JWS-signed body to indicate it's
+// ready for the server to validate the given challenge, and the server
+// attempts validation and records the outcome on the authorization.
+func (h *Handler) ValidateChallenge(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+	req, ok := h.authenticatedRequest(w, r)
+	if !ok {
+		return
+	}
+
+	authz, err := h.Store.GetAuthorization(p.ByName("authz"))
+	if err != nil {
+		http.Error(w, "authorization not found", http.StatusNotFound)
+		return
+	}
+	order, err := h.Store.GetOrder(authz.OrderID)
+	if err != nil || order.AccountID != req.AccountID {
+		http.Error(w, "authorization not found", http.StatusNotFound)
+		return
+	}
+
+	challengeType := ChallengeType(p.ByName("type"))
+	var challenge *Challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == challengeType {
+			challenge = &authz.Challenges[i]
+			break
+		}
+	}
+	if challenge == nil {
+		http.Error(w, "unknown challenge type", http.StatusNotFound)
+		return
+	}
+
+	var validateErr error
+	switch challengeType {
+	case ChallengeHTTP01, ChallengeTLSALPN01:
+		account, err := h.Store.GetAccount(order.AccountID)
+		if err != nil {
+			http.Error(w, "authorization not found", http.StatusNotFound)
+			return
+		}
+		// The RFC 8555 §8.1 key authorization: the challenge token bound
+		// to the account key that's proving control of the domain, so a
+		// token stolen from one account can't be replayed by another.
+		keyAuthorization := challenge.Token + "." + account.JWKThumbprint
+		if challengeType == ChallengeHTTP01 {
+			validateErr = ValidateHTTP01(http.DefaultClient, authz.Identifier.Value, *challenge, keyAuthorization)
+		} else {
+			validateErr = ValidateTLSALPN01(ctx, authz.Identifier.Value, *challenge, keyAuthorization)
+		}
+	case ChallengeTeleportToken01:
+		// teleport-token-01 isn't a proof of domain control, so it has no
+		// key authorization: the client instead echoes back the join
+		// token itself, which it can only know if it holds a valid one.
+		var body struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(req.Payload, &body); err != nil {
+			http.Error(w, "malformed request", http.StatusBadRequest)
+			return
+		}
+		validateErr = ValidateTeleportToken01(ctx, h.Tokens, *challenge, body.Token)
+	default:
+		http.Error(w, "unknown challenge type", http.StatusNotFound)
+		return
+	}
+
+	if validateErr != nil {
+		challenge.Status = StatusInvalid
+		authz.Status = StatusInvalid
+		h.auditOrderFailure(ctx, p.ByName("provisioner"), req.AccountID, validateErr)
+	} else {
+		challenge.Status = StatusValid
+		challenge.Validated = time.Now()
+		authz.Status = StatusValid
+	}
+
+	if err := h.Store.UpdateAuthorization(authz); err != nil {
+		h.log().WithError(err).Warn("Failed to persist an ACME authorization after challenge validation.")
+	}
+
+	writeJSON(w, http.StatusOK, challenge)
+}
+
+// Certificate implements the RFC 8555 §7.4.2 certificate download endpoint.
+func (h *Handler) Certificate(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	order, err := h.Store.GetOrder(p.ByName("order"))
+	if err != nil || order.Status != StatusValid {
+		http.Error(w, "certificate not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: order.Cert})
+}
+
+func (h *Handler) provisioner(w http.ResponseWriter, p httprouter.Params) (*Provisioner, bool) {
+	provisioner, ok := h.Provisioners[p.ByName("provisioner")]
+	if !ok {
+		http.Error(w, "unknown provisioner", http.StatusNotFound)
+		return nil, false
+	}
+	return provisioner, true
+}
+
+// authenticatedRequest decodes r's JWS envelope, verifies its signature
+// against the key identified by the protected header (see
+// resolveSigningKey in jws.go), and consumes its nonce. Any failure -
+// malformed envelope, unknown kid, bad signature, reused nonce - is
+// reported identically to the caller as an authentication failure, so as
+// not to help an attacker distinguish which check they failed.
+func (h *Handler) authenticatedRequest(w http.ResponseWriter, r *http.Request) (*acmeRequest, bool) {
+	var envelope jwsEnvelope
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(envelope.Protected)
+	if err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return nil, false
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	pub, accountID, err := h.resolveSigningKey(header)
+	if err != nil {
+		h.log().WithError(err).Warn("Rejected an ACME request with an unresolvable signing key.")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(envelope.Signature)
+	if err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return nil, false
+	}
+	signingInput := envelope.Protected + "." + envelope.Payload
+	if err := verifyJWSSignature(header.Alg, pub, []byte(signingInput), sig); err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	if err := h.Store.ConsumeNonce(header.Nonce); err != nil {
+		http.Error(w, "badNonce", http.StatusBadRequest)
+		return nil, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return &acmeRequest{AccountID: accountID, JWK: header.JWK, Payload: payload}, true
+}
+
+func (h *Handler) auditOrderCreated(ctx context.Context, provisioner, accountID, orderID string) {
+	h.emitOrderEvent(ctx, provisioner, accountID, orderID, events.ACMEOrderSuccessCode, nil)
+}
+
+func (h *Handler) auditOrderFinalized(ctx context.Context, provisioner, accountID, orderID string) {
+	h.emitOrderEvent(ctx, provisioner, accountID, orderID, events.ACMEOrderSuccessCode, nil)
+}
+
+func (h *Handler) auditOrderFailure(ctx context.Context, provisioner, accountID string, cause error) {
+	h.log().WithError(cause).Warn("Rejected an ACME order.")
+	h.emitOrderEvent(ctx, provisioner, accountID, "", events.ACMEOrderFailureCode, cause)
+}
+
+func (h *Handler) emitOrderEvent(ctx context.Context, provisioner, accountID, orderID string, code string, cause error) {
+	event := &apievents.ACMEOrder{
+		Metadata: apievents.Metadata{
+			Type: events.ACMEOrderEvent,
+			Code: code,
+		},
+		Provisioner: provisioner,
+		AccountID:   accountID,
+		OrderID:     orderID,
+		Status:      apievents.Status{Success: cause == nil},
+	}
+	if cause != nil {
+		event.Status.Error = cause.Error()
+	}
+	if err := h.Emitter.EmitAuditEvent(ctx, event); err != nil {
+		h.log().WithError(err).Warn("Failed to emit ACME order audit event.")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,208 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gravitational/teleport/api/types"
+	apievents "github.com/gravitational/teleport/api/types/events"
+)
+
+type noopAuditLogger struct{}
+
+func (noopAuditLogger) EmitAuditEvent(ctx context.Context, event apievents.AuditEvent) error {
+	return nil
+}
+
+// fakeTokenGetter never finds a token, so a teleport-token-01 challenge
+// validated against it always fails.
+type fakeTokenGetter struct{}
+
+func (fakeTokenGetter) GetToken(ctx context.Context, token string) (types.ProvisionToken, error) {
+	return nil, trace.NotFound("token %v not found", token)
+}
+
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	provisioner := &Provisioner{
+		Name:                    "db-access",
+		AllowedIdentityTemplate: "db-agent-{{.Identifier}}",
+		TTL:                     time.Hour,
+	}
+	require.NoError(t, provisioner.CheckAndSetDefaults())
+	return &Handler{
+		CertAuthority: newFakeCA(t),
+		Tokens:        fakeTokenGetter{},
+		Store:         newTestStore(t),
+		Emitter:       noopAuditLogger{},
+		Provisioners: map[string]*Provisioner{
+			"db-access": provisioner,
+		},
+		BaseURL: "https://proxy.example.com/acme/db-access",
+	}
+}
+
+// serve runs router against a request built from method/body and returns
+// the recorded response, mirroring how router.go wires h's methods up to
+// httprouter.
+func serve(h *Handler, method, path string, body []byte) *httptest.ResponseRecorder {
+	router := httprouter.New()
+	RegisterHandlers(router, h)
+
+	r := httptest.NewRequest(method, "https://proxy.example.com"+path, strings.NewReader(string(body)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// registerAccount drives a newAccount request through h and returns the
+// created account's ID and the key it was registered with.
+func registerAccount(t *testing.T, h *Handler) (string, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	require.NoError(t, h.Store.IssueNonce("nonce-account"))
+	jwkJSON, err := json.Marshal(jwkFromPublicKey(&key.PublicKey))
+	require.NoError(t, err)
+	body := signJWS(t, key, jwsHeader{Nonce: "nonce-account", JWK: jwkJSON}, []byte(`{}`))
+
+	w := serve(h, http.MethodPost, "/acme/db-access/new-account", body)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	location := w.Header().Get("Location")
+	require.NotEmpty(t, location)
+	id := location[strings.LastIndex(location, "/")+1:]
+	return id, key
+}
+
+// createOrder drives a newOrder request for identifier, authenticated as
+// accountID/key, and returns the created order and the bare IDs of its
+// authorizations.
+func createOrder(t *testing.T, h *Handler, accountID string, key *ecdsa.PrivateKey, identifier Identifier) (Order, []string) {
+	t.Helper()
+	require.NoError(t, h.Store.IssueNonce("nonce-order"))
+	payload, err := json.Marshal(struct {
+		Identifiers []Identifier `json:"identifiers"`
+	}{Identifiers: []Identifier{identifier}})
+	require.NoError(t, err)
+
+	kid := h.BaseURL + "/account/" + accountID
+	body := signJWS(t, key, jwsHeader{Nonce: "nonce-order", KID: kid}, payload)
+
+	w := serve(h, http.MethodPost, "/acme/db-access/new-order", body)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var order Order
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &order))
+	location := w.Header().Get("Location")
+	order.ID = location[strings.LastIndex(location, "/")+1:]
+
+	authzIDs := make([]string, len(order.Authorizations))
+	for i, url := range order.Authorizations {
+		authzIDs[i] = url[strings.LastIndex(url, "/")+1:]
+	}
+	return order, authzIDs
+}
+
+func validateChallenge(t *testing.T, h *Handler, accountID string, key *ecdsa.PrivateKey, authzID string, challengeType ChallengeType, payload []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	if payload == nil {
+		payload = []byte(`{}`)
+	}
+	require.NoError(t, h.Store.IssueNonce("nonce-challenge-"+authzID+string(challengeType)))
+	kid := h.BaseURL + "/account/" + accountID
+	body := signJWS(t, key, jwsHeader{Nonce: "nonce-challenge-" + authzID + string(challengeType), KID: kid}, payload)
+	return serve(h, http.MethodPost, "/acme/db-access/challenge/"+authzID+"/"+string(challengeType), body)
+}
+
+func finalizeOrderRequest(t *testing.T, h *Handler, accountID string, key *ecdsa.PrivateKey, orderID string, clientKey *ecdsa.PrivateKey, csrDomains []string) *httptest.ResponseRecorder {
+	t.Helper()
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: csrDomains}, clientKey)
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(struct {
+		CSR []byte `json:"csr"`
+	}{CSR: csrDER})
+	require.NoError(t, err)
+
+	require.NoError(t, h.Store.IssueNonce("nonce-finalize-"+orderID))
+	kid := h.BaseURL + "/account/" + accountID
+	body := signJWS(t, key, jwsHeader{Nonce: "nonce-finalize-" + orderID, KID: kid}, payload)
+
+	return serve(h, http.MethodPost, "/acme/db-access/order/"+orderID+"/finalize", body)
+}
+
+func TestFinalizeRejectsOrderWithUnvalidatedAuthorization(t *testing.T) {
+	h := newTestHandler(t)
+	accountID, key := registerAccount(t, h)
+	order, _ := createOrder(t, h, accountID, key, Identifier{Type: "db", Value: "alice"})
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	w := finalizeOrderRequest(t, h, accountID, key, order.ID, clientKey, []string{"attacker-chosen.example.com"})
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestFinalizeSucceedsOnceChallengeValidatedAndIgnoresCSRSANs(t *testing.T) {
+	h := newTestHandler(t)
+	accountID, key := registerAccount(t, h)
+	order, authzIDs := createOrder(t, h, accountID, key, Identifier{Type: "db", Value: "alice"})
+	require.Len(t, authzIDs, 1)
+
+	w := validateChallenge(t, h, accountID, key, authzIDs[0], ChallengeTeleportToken01, []byte(`{"token":"bogus-token"}`))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var challenge Challenge
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+	require.Equal(t, StatusInvalid, challenge.Status) // fakeTokenGetter never finds the token.
+
+	authz, err := h.Store.GetAuthorization(authzIDs[0])
+	require.NoError(t, err)
+	authz.Status = StatusValid
+	require.NoError(t, h.Store.UpdateAuthorization(authz))
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	finalizeW := finalizeOrderRequest(t, h, accountID, key, order.ID, clientKey, []string{"attacker-chosen.example.com"})
+	require.Equal(t, http.StatusOK, finalizeW.Code, finalizeW.Body.String())
+
+	var finalized Order
+	require.NoError(t, json.Unmarshal(finalizeW.Body.Bytes(), &finalized))
+	require.Equal(t, StatusValid, finalized.Status)
+
+	stored, err := h.Store.GetOrder(order.ID)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(stored.Cert)
+	require.NoError(t, err)
+	require.Equal(t, "db-agent-alice", cert.Subject.CommonName)
+	require.Empty(t, cert.DNSNames)
+}
@@ -0,0 +1,197 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"path"
+
+	"github.com/gravitational/trace"
+)
+
+// jwsEnvelope is the RFC 8555 §6.2 flattened JWS JSON serialization every
+// authenticated ACME request body uses.
+type jwsEnvelope struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader is the subset of the RFC 7515 §4.1 protected header ACME
+// requests populate: Nonce replay-proofs the request, and exactly one of
+// KID (an existing account's URL) or JWK (the account's own key, only
+// valid on new-account, which by definition has no account yet to
+// reference) identifies the signing key.
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	KID   string          `json:"kid"`
+	JWK   json.RawMessage `json:"jwk"`
+}
+
+// jwk is the subset of RFC 7517 JSON Web Key fields needed to reconstruct
+// the EC (P-256/ES256) or RSA (RS256) public keys ACME clients commonly
+// register.
+type jwk struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// publicKey reconstructs the crypto.PublicKey k describes.
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, trace.BadParameter("unsupported JWK curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, trace.Wrap(err, "decoding JWK x coordinate")
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, trace.Wrap(err, "decoding JWK y coordinate")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, trace.Wrap(err, "decoding JWK modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, trace.Wrap(err, "decoding JWK exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return nil, trace.BadParameter("unsupported JWK key type %q", k.Kty)
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint: a SHA-256 digest of k's
+// required members in a fixed, lexicographically-sorted JSON encoding.
+// This is the value ACME's key authorizations (RFC 8555 §8.1) bind
+// challenge tokens to, and what Account.JWKThumbprint stores so challenge
+// validation doesn't need the full key on hand.
+func (k *jwk) thumbprint() (string, error) {
+	var canon any
+	switch k.Kty {
+	case "EC":
+		canon = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case "RSA":
+		canon = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	default:
+		return "", trace.BadParameter("unsupported JWK key type %q", k.Kty)
+	}
+	raw, err := json.Marshal(canon)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// verifyJWSSignature checks sig over signingInput (the request's
+// "<protected>.<payload>", exactly as transmitted) using pub, per RFC 7515
+// §5.1. Only the ES256 and RS256 algorithms ACME clients commonly use are
+// supported; anything else is rejected rather than silently accepted.
+func verifyJWSSignature(alg string, pub crypto.PublicKey, signingInput, sig []byte) error {
+	digest := sha256.Sum256(signingInput)
+	switch alg {
+	case "ES256":
+		key, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return trace.BadParameter("jwk does not match alg %q", alg)
+		}
+		if len(sig) != 64 {
+			return trace.BadParameter("malformed ES256 signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return trace.AccessDenied("invalid JWS signature")
+		}
+		return nil
+	case "RS256":
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return trace.BadParameter("jwk does not match alg %q", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+			return trace.AccessDenied("invalid JWS signature")
+		}
+		return nil
+	default:
+		return trace.BadParameter("unsupported JWS algorithm %q", alg)
+	}
+}
+
+// resolveSigningKey returns the public key header's request should be
+// verified against, per RFC 8555 §6.2: an embedded jwk for new-account (the
+// one request that by definition precedes any account existing to
+// reference by kid), otherwise the jwk previously registered against the
+// account header.KID names. The returned accountID is "" for the jwk case,
+// since there's no account yet.
+func (h *Handler) resolveSigningKey(header jwsHeader) (pub crypto.PublicKey, accountID string, err error) {
+	if len(header.JWK) > 0 {
+		var key jwk
+		if err := json.Unmarshal(header.JWK, &key); err != nil {
+			return nil, "", trace.Wrap(err, "malformed jwk")
+		}
+		pub, err = key.publicKey()
+		if err != nil {
+			return nil, "", trace.Wrap(err)
+		}
+		return pub, "", nil
+	}
+
+	if header.KID == "" {
+		return nil, "", trace.BadParameter("request has neither kid nor jwk")
+	}
+	id := path.Base(header.KID)
+	account, err := h.Store.GetAccount(id)
+	if err != nil {
+		return nil, "", trace.Wrap(err)
+	}
+	var key jwk
+	if err := json.Unmarshal(account.JWK, &key); err != nil {
+		return nil, "", trace.Wrap(err, "account has no usable registered key")
+	}
+	pub, err = key.publicKey()
+	if err != nil {
+		return nil, "", trace.Wrap(err)
+	}
+	return pub, account.ID, nil
+}
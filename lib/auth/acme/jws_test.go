@@ -0,0 +1,136 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// signJWS produces the RFC 8555 §6.2 flattened JWS envelope for payload,
+// signed by key with ES256, the way an ACME client would. header is
+// mutated to carry payload's nonce; tests build it with either a KID or a
+// JWK already set.
+func signJWS(t *testing.T, key *ecdsa.PrivateKey, header jwsHeader, payload []byte) []byte {
+	t.Helper()
+	header.Alg = "ES256"
+
+	headerJSON, err := json.Marshal(header)
+	require.NoError(t, err)
+	protected := base64.RawURLEncoding.EncodeToString(headerJSON)
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(protected + "." + encodedPayload))
+	r, s, err := ecdsaSign(key, digest)
+	require.NoError(t, err)
+
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	envelope := jwsEnvelope{
+		Protected: protected,
+		Payload:   encodedPayload,
+		Signature: base64.RawURLEncoding.EncodeToString(sig),
+	}
+	raw, err := json.Marshal(envelope)
+	require.NoError(t, err)
+	return raw
+}
+
+func ecdsaSign(key *ecdsa.PrivateKey, digest [32]byte) (*big.Int, *big.Int, error) {
+	return ecdsa.Sign(rand.Reader, key, digest[:])
+}
+
+func jwkFromPublicKey(pub *ecdsa.PublicKey) jwk {
+	return jwk{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(pub.X.Bytes()),
+		Y:   base64.RawURLEncoding.EncodeToString(pub.Y.Bytes()),
+	}
+}
+
+func TestJWKPublicKeyRoundTrip(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	k := jwkFromPublicKey(&key.PublicKey)
+	pub, err := k.publicKey()
+	require.NoError(t, err)
+
+	ecPub, ok := pub.(*ecdsa.PublicKey)
+	require.True(t, ok)
+	require.True(t, key.PublicKey.Equal(ecPub))
+}
+
+func TestJWKThumbprintStable(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	k := jwkFromPublicKey(&key.PublicKey)
+
+	first, err := k.thumbprint()
+	require.NoError(t, err)
+	second, err := k.thumbprint()
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherThumbprint, err := jwkFromPublicKey(&other.PublicKey).thumbprint()
+	require.NoError(t, err)
+	require.NotEqual(t, first, otherThumbprint)
+}
+
+func TestVerifyJWSSignatureRejectsTamperedPayload(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	body := signJWS(t, key, jwsHeader{Nonce: "abc"}, []byte(`{"ok":true}`))
+	var envelope jwsEnvelope
+	require.NoError(t, json.Unmarshal(body, &envelope))
+
+	sig, err := base64.RawURLEncoding.DecodeString(envelope.Signature)
+	require.NoError(t, err)
+
+	tamperedPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"ok":false}`))
+	signingInput := []byte(envelope.Protected + "." + tamperedPayload)
+
+	err = verifyJWSSignature("ES256", &key.PublicKey, signingInput, sig)
+	require.Error(t, err)
+}
+
+func TestVerifyJWSSignatureAcceptsValidSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	body := signJWS(t, key, jwsHeader{Nonce: "abc"}, []byte(`{"ok":true}`))
+	var envelope jwsEnvelope
+	require.NoError(t, json.Unmarshal(body, &envelope))
+
+	sig, err := base64.RawURLEncoding.DecodeString(envelope.Signature)
+	require.NoError(t, err)
+	signingInput := []byte(envelope.Protected + "." + envelope.Payload)
+
+	require.NoError(t, verifyJWSSignature("ES256", &key.PublicKey, signingInput, sig))
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"time"
+
+	"github.com/gravitational/trace"
+)
+
+// Provisioner is the ACMEProvisioner resource: it bounds what an ACME
+// account enrolling against this server can obtain and how often, so that
+// exposing an ACME endpoint to ecosystem tooling can't be used to mint
+// arbitrary Teleport identities or to exhaust the auth server with orders.
+type Provisioner struct {
+	// Name identifies the provisioner in the ACME directory path, e.g.
+	// "/acme/<name>/directory".
+	Name string
+	// AllowedIdentityTemplate is a text/template string, rendered with the
+	// order's requested identifier, that produces the Teleport identity
+	// (database username) bound into the issued certificate as its subject
+	// common name. No SANs are set on the issued certificate.
+	AllowedIdentityTemplate string
+	// TTL caps how long an issued certificate is valid for, regardless of
+	// what the CSR asks for.
+	TTL time.Duration
+	// RateLimit bounds how many orders a single account may create in a
+	// rolling window.
+	RateLimit RateLimit
+}
+
+// RateLimit bounds how many orders a single ACME account may create
+// within Period.
+type RateLimit struct {
+	// OrdersPerAccount is the maximum number of orders an account may
+	// create within Period.
+	OrdersPerAccount int
+	// Period is the rolling window OrdersPerAccount is measured over.
+	Period time.Duration
+}
+
+// CheckAndSetDefaults validates p and fills in defaults for fields left
+// unset.
+func (p *Provisioner) CheckAndSetDefaults() error {
+	if p.Name == "" {
+		return trace.BadParameter("missing provisioner name")
+	}
+	if p.AllowedIdentityTemplate == "" {
+		return trace.BadParameter("missing provisioner allowed identity template")
+	}
+	if p.TTL <= 0 {
+		p.TTL = time.Hour
+	}
+	if p.RateLimit.OrdersPerAccount <= 0 {
+		p.RateLimit.OrdersPerAccount = 20
+	}
+	if p.RateLimit.Period <= 0 {
+		p.RateLimit.Period = time.Hour
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvisionerCheckAndSetDefaults(t *testing.T) {
+	t.Run("fills in defaults", func(t *testing.T) {
+		p := &Provisioner{Name: "db-access", AllowedIdentityTemplate: "{{.Identifier}}"}
+		require.NoError(t, p.CheckAndSetDefaults())
+		require.Equal(t, time.Hour, p.TTL)
+		require.Equal(t, 20, p.RateLimit.OrdersPerAccount)
+		require.Equal(t, time.Hour, p.RateLimit.Period)
+	})
+
+	t.Run("preserves explicit values", func(t *testing.T) {
+		p := &Provisioner{
+			Name:                    "db-access",
+			AllowedIdentityTemplate: "{{.Identifier}}",
+			TTL:                     5 * time.Minute,
+			RateLimit:               RateLimit{OrdersPerAccount: 3, Period: time.Minute},
+		}
+		require.NoError(t, p.CheckAndSetDefaults())
+		require.Equal(t, 5*time.Minute, p.TTL)
+		require.Equal(t, 3, p.RateLimit.OrdersPerAccount)
+	})
+
+	t.Run("rejects missing fields", func(t *testing.T) {
+		tests := []Provisioner{
+			{AllowedIdentityTemplate: "{{.Identifier}}"},
+			{Name: "db-access"},
+		}
+		for _, p := range tests {
+			p := p
+			require.Error(t, p.CheckAndSetDefaults())
+		}
+	})
+}
@@ -0,0 +1,30 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import "github.com/julienschmidt/httprouter"
+
+// RegisterHandlers mounts h's ACME operations on router under
+// "/acme/:provisioner/", the conventional per-provisioner ACME path.
+func RegisterHandlers(router *httprouter.Router, h *Handler) {
+	router.GET("/acme/:provisioner/directory", h.Directory)
+	router.HEAD("/acme/:provisioner/new-nonce", h.NewNonce)
+	router.GET("/acme/:provisioner/new-nonce", h.NewNonce)
+	router.POST("/acme/:provisioner/new-account", h.NewAccount)
+	router.POST("/acme/:provisioner/new-order", h.NewOrder)
+	router.POST("/acme/:provisioner/order/:order/finalize", h.Finalize)
+	router.POST("/acme/:provisioner/challenge/:authz/:type", h.ValidateChallenge)
+	router.GET("/acme/:provisioner/certificate/:order", h.Certificate)
+}
@@ -0,0 +1,179 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/backend"
+)
+
+// nonceTTL bounds how long a newNonce response remains redeemable, per the
+// recommendation in RFC 8555 §7.2 that servers not accept arbitrarily old
+// nonces.
+const nonceTTL = 5 * time.Minute
+
+// orderTTL bounds how long a pending order is kept around if the client
+// never finalizes it.
+const orderTTL = time.Hour
+
+var (
+	accountsBucket       = []string{"acme", "accounts"}
+	ordersBucket         = []string{"acme", "orders"}
+	authorizationsBucket = []string{"acme", "authorizations"}
+	noncesBucket         = []string{"acme", "nonces"}
+)
+
+// Store persists ACME server state - accounts, orders, authorizations, and
+// issued nonces - in the cluster backend, so an ACME flow can be resumed
+// regardless of which auth server instance handles each request.
+type Store struct {
+	backend backend.Backend
+}
+
+// NewStore returns a Store backed by b.
+func NewStore(b backend.Backend) *Store {
+	return &Store{backend: b}
+}
+
+// IssueNonce creates a fresh, single-use nonce.
+func (s *Store) IssueNonce(nonce string) error {
+	return trace.Wrap(s.backend.CreateVal(noncesBucket, nonce, []byte{1}, nonceTTL))
+}
+
+// ConsumeNonce redeems nonce, returning an error if it was never issued or
+// has already been consumed.
+func (s *Store) ConsumeNonce(nonce string) error {
+	if err := s.backend.DeleteKey(noncesBucket, nonce); err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// CreateAccount persists a new account.
+func (s *Store) CreateAccount(a *Account) error {
+	val, err := json.Marshal(a)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(s.backend.CreateVal(accountsBucket, a.ID, val, backend.Forever))
+}
+
+// GetAccount fetches the account with the given ID.
+func (s *Store) GetAccount(id string) (*Account, error) {
+	val, err := s.backend.GetVal(accountsBucket, id)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var a Account
+	if err := json.Unmarshal(val, &a); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	a.ID = id
+	return &a, nil
+}
+
+// CreateOrder persists a new order with the standard order TTL.
+func (s *Store) CreateOrder(o *Order) error {
+	val, err := json.Marshal(o)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(s.backend.CreateVal(ordersBucket, o.ID, val, orderTTL))
+}
+
+// UpdateOrder overwrites an existing order, resetting its TTL to orderTTL.
+func (s *Store) UpdateOrder(o *Order) error {
+	val, err := json.Marshal(o)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(s.backend.UpsertVal(ordersBucket, o.ID, val, orderTTL))
+}
+
+// GetOrder fetches the order with the given ID.
+func (s *Store) GetOrder(id string) (*Order, error) {
+	val, err := s.backend.GetVal(ordersBucket, id)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var o Order
+	if err := json.Unmarshal(val, &o); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	o.ID = id
+	return &o, nil
+}
+
+// CreateAuthorization persists a new authorization with the same TTL as its
+// parent order.
+func (s *Store) CreateAuthorization(a *Authorization) error {
+	val, err := json.Marshal(a)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(s.backend.CreateVal(authorizationsBucket, a.ID, val, orderTTL))
+}
+
+// UpdateAuthorization overwrites an existing authorization.
+func (s *Store) UpdateAuthorization(a *Authorization) error {
+	val, err := json.Marshal(a)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(s.backend.UpsertVal(authorizationsBucket, a.ID, val, orderTTL))
+}
+
+// GetAuthorization fetches the authorization with the given ID.
+func (s *Store) GetAuthorization(id string) (*Authorization, error) {
+	val, err := s.backend.GetVal(authorizationsBucket, id)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	var a Authorization
+	if err := json.Unmarshal(val, &a); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	a.ID = id
+	return &a, nil
+}
+
+// CountRecentOrders returns how many orders accountID has created within
+// window, for rate limiting. An order's creation time is taken to be its
+// Expires time less orderTTL.
+func (s *Store) CountRecentOrders(accountID string, window time.Duration) (int, error) {
+	keys, err := s.backend.GetKeys(ordersBucket)
+	if err != nil {
+		return 0, trace.Wrap(err)
+	}
+
+	count := 0
+	since := time.Now().Add(-window)
+	for _, key := range keys {
+		o, err := s.GetOrder(key)
+		if trace.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return 0, trace.Wrap(err)
+		}
+		if o.AccountID == accountID && o.Expires.Add(-orderTTL).After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
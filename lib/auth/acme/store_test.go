@@ -0,0 +1,76 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/gravitational/teleport/lib/backend/fs"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	b, err := fs.FromJSON(fmt.Sprintf(`{"path": %q}`, t.TempDir()))
+	require.NoError(t, err)
+	return NewStore(b)
+}
+
+func TestStoreNonce(t *testing.T) {
+	s := newTestStore(t)
+
+	require.NoError(t, s.IssueNonce("abc"))
+	require.NoError(t, s.ConsumeNonce("abc"))
+
+	// A nonce can't be redeemed twice.
+	require.Error(t, s.ConsumeNonce("abc"))
+
+	// An unissued nonce is rejected.
+	require.Error(t, s.ConsumeNonce("never-issued"))
+}
+
+func TestStoreAccountRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+
+	account := &Account{ID: "acct-1", Status: StatusValid, Contact: []string{"mailto:admin@example.com"}}
+	require.NoError(t, s.CreateAccount(account))
+
+	got, err := s.GetAccount("acct-1")
+	require.NoError(t, err)
+	require.Equal(t, account.Status, got.Status)
+	require.Equal(t, account.Contact, got.Contact)
+}
+
+func TestStoreOrderRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+
+	order := &Order{
+		ID:          "order-1",
+		AccountID:   "acct-1",
+		Status:      StatusPending,
+		Identifiers: []Identifier{{Type: "db", Value: "alice"}},
+	}
+	require.NoError(t, s.CreateOrder(order))
+
+	order.Status = StatusValid
+	require.NoError(t, s.UpdateOrder(order))
+
+	got, err := s.GetOrder("order-1")
+	require.NoError(t, err)
+	require.Equal(t, StatusValid, got.Status)
+	require.Equal(t, order.Identifiers, got.Identifiers)
+}
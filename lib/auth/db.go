@@ -0,0 +1,190 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/api/client/proto"
+	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/lib/auth/dbjwt"
+	"github.com/gravitational/teleport/lib/tlsca"
+)
+
+// getSnowflakeJWTParams derives the subject and issuer for a Snowflake
+// key-pair auth JWT. It is a thin wrapper kept for existing callers; new
+// engines should go through [dbjwt.ForEngine] instead, which also covers
+// BigQuery, Databricks, and generic RFC 7523 JWT auth.
+func getSnowflakeJWTParams(accountName, userName string, publicKey []byte) (subject, issuer string) {
+	return dbjwt.SnowflakeJWTParams(accountName, userName, publicKey)
+}
+
+// RenewDatabaseCert reissues a database certificate for the identity already
+// vouched for by peerCert, reusing peerCert's public key. It lets a
+// long-lived database agent or tctl pick up a certificate signed by the
+// currently active database CA on every rotation cycle without building a
+// fresh CSR, as long as it still presents a certificate trusted by the CA
+// that issued it. requester selects which CA authenticates and signs the
+// renewal, exactly as it does for GenerateDatabaseCert.
+func (a *Server) RenewDatabaseCert(ctx context.Context, peerCert *x509.Certificate, requester proto.DatabaseCertRequest_Requester) (*proto.DatabaseCertResponse, error) {
+	return a.reissueDatabaseCert(ctx, peerCert, peerCert.PublicKey, requester)
+}
+
+// RekeyDatabaseCert is like RenewDatabaseCert, but binds newPublicKey to the
+// issued certificate instead of reusing the key from peerCert. This lets a
+// caller rotate its private key locally and obtain a matching certificate in
+// the same call, again without a CSR round-trip.
+func (a *Server) RekeyDatabaseCert(ctx context.Context, peerCert *x509.Certificate, newPublicKey crypto.PublicKey, requester proto.DatabaseCertRequest_Requester) (*proto.DatabaseCertResponse, error) {
+	return a.reissueDatabaseCert(ctx, peerCert, newPublicKey, requester)
+}
+
+// reissueDatabaseCert authenticates peerCert against the active key of the
+// CA requester is expected to present - the DatabaseClientCA for DB_SERVICE,
+// falling back to the DatabaseCA when no client CA has been created yet, or
+// the DatabaseCA directly for TCTL - rejecting a peer certificate that only
+// the retired trust store would still accept. It then copies the identity
+// and SANs encoded in peerCert into a fresh certificate bound to publicKey,
+// signed by that same active key, mirroring the CA selection GenerateDatabaseCert
+// performs for a CSR-based request.
+func (a *Server) reissueDatabaseCert(ctx context.Context, peerCert *x509.Certificate, publicKey crypto.PublicKey, requester proto.DatabaseCertRequest_Requester) (*proto.DatabaseCertResponse, error) {
+	if peerCert == nil {
+		return nil, trace.BadParameter("missing peer certificate")
+	}
+
+	clusterName, err := a.GetClusterName()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	domain := clusterName.GetClusterName()
+
+	caType := types.DatabaseClientCA
+	if requester == proto.DatabaseCertRequest_TCTL {
+		caType = types.DatabaseCA
+	}
+	ca, caType, err := a.loadDatabaseCA(ctx, domain, caType)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	activeKeys := ca.GetActiveKeys().TLS
+	pool := x509.NewCertPool()
+	for _, keyPair := range activeKeys {
+		if !pool.AppendCertsFromPEM(keyPair.Cert) {
+			return nil, trace.BadParameter("failed to parse %v certificate", caType)
+		}
+	}
+	if _, err := peerCert.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		return nil, trace.AccessDenied("peer certificate is not signed by the active %v, renew or rekey is only available to holders of a certificate from the current trust store", caType)
+	}
+
+	tlsCert, signer, err := a.keyStore.GetTLSCertAndSigner(ctx, ca)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	signingCA, err := tlsca.FromCertAndSigner(tlsCert, signer)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	cert, err := signingCA.GenerateCertificate(tlsca.CertificateRequest{
+		Clock:     a.clock,
+		PublicKey: publicKey,
+		Subject:   peerCert.Subject,
+		NotAfter:  peerCert.NotAfter,
+		DNSNames:  peerCert.DNSNames,
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	trustedCAType := types.DatabaseCA
+	if caType == types.DatabaseCA {
+		trustedCAType = types.DatabaseClientCA
+	}
+	trustedCA, err := a.GetCertAuthority(ctx, types.CertAuthID{Type: trustedCAType, DomainName: domain}, false)
+	if trace.IsNotFound(err) {
+		trustedCA = ca
+	} else if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	// CACerts is kept for backward compatibility with older agents and
+	// tctl, which can't interpret TrustBundle roles; new callers should
+	// prefer TrustBundle, which disambiguates the active signer from
+	// additional trusted and retired keys without relying on ordering.
+	var caCerts [][]byte
+	for _, keyPair := range trustedCA.GetActiveKeys().TLS {
+		caCerts = append(caCerts, keyPair.Cert)
+	}
+	for _, keyPair := range trustedCA.GetAdditionalTrustedKeys().TLS {
+		caCerts = append(caCerts, keyPair.Cert)
+	}
+
+	trustBundle, err := trustBundleEntries(trustedCA, trustedCAType)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return &proto.DatabaseCertResponse{Cert: cert, CACerts: caCerts, TrustBundle: trustBundle}, nil
+}
+
+// loadDatabaseCA fetches the requested CA type, falling back from
+// DatabaseClientCA to DatabaseCA when no client CA has been created yet. It
+// returns the CA actually loaded, which may differ from want.
+func (a *Server) loadDatabaseCA(ctx context.Context, domain string, want types.CertAuthType) (types.CertAuthority, types.CertAuthType, error) {
+	ca, err := a.GetCertAuthority(ctx, types.CertAuthID{Type: want, DomainName: domain}, true)
+	if trace.IsNotFound(err) && want == types.DatabaseClientCA {
+		want = types.DatabaseCA
+		ca, err = a.GetCertAuthority(ctx, types.CertAuthID{Type: want, DomainName: domain}, true)
+	}
+	if err != nil {
+		return nil, want, trace.Wrap(err)
+	}
+	return ca, want, nil
+}
+
+// ActiveDatabaseClientCA returns the certificate and signer for the active
+// DatabaseClientCA key, falling back to DatabaseCA when no client CA has
+// been created yet - the same selection RenewDatabaseCert and
+// RekeyDatabaseCert use. It is exposed for endpoints, such as the SCEP
+// enrollment handler in [scep], that sign certificates outside the gRPC
+// API but must agree with it on which key is currently active.
+func (a *Server) ActiveDatabaseClientCA(ctx context.Context) (*x509.Certificate, crypto.Signer, error) {
+	clusterName, err := a.GetClusterName()
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+
+	ca, _, err := a.loadDatabaseCA(ctx, clusterName.GetClusterName(), types.DatabaseClientCA)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+
+	tlsCert, signer, err := a.keyStore.GetTLSCertAndSigner(ctx, ca)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+
+	cert, err := tlsca.ParseCertificatePEM(tlsCert)
+	if err != nil {
+		return nil, nil, trace.Wrap(err)
+	}
+
+	return cert, signer, nil
+}
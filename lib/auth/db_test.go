@@ -236,6 +236,163 @@ func TestDBCertSigning(t *testing.T) {
 	})
 }
 
+func TestRenewRekeyDatabaseCert(t *testing.T) {
+	t.Parallel()
+	authServer, err := NewTestAuthServer(TestAuthServerConfig{
+		Clock:       clockwork.NewFakeClockAt(time.Now()),
+		ClusterName: "local.me",
+		Dir:         t.TempDir(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, authServer.Close()) })
+
+	ctx := context.Background()
+
+	privateKey, err := testauthority.New().GeneratePrivateKey()
+	require.NoError(t, err)
+
+	csr, err := tlsca.GenerateCertificateRequestPEM(pkix.Name{
+		CommonName: "localhost",
+	}, privateKey)
+	require.NoError(t, err)
+
+	initialResp, err := authServer.AuthServer.GenerateDatabaseCert(ctx, &proto.DatabaseCertRequest{
+		CSR:        csr,
+		ServerName: "localhost",
+		TTL:        proto.Duration(time.Hour),
+	})
+	require.NoError(t, err)
+	peerCert, err := tlsca.ParseCertificatePEM(initialResp.Cert)
+	require.NoError(t, err)
+
+	renewed, err := authServer.AuthServer.RenewDatabaseCert(ctx, peerCert, proto.DatabaseCertRequest_DB_SERVICE)
+	require.NoError(t, err)
+	mustVerifyCert(t, renewed.CACerts[0], renewed.Cert)
+
+	newPrivateKey, err := testauthority.New().GeneratePrivateKey()
+	require.NoError(t, err)
+	rekeyed, err := authServer.AuthServer.RekeyDatabaseCert(ctx, peerCert, newPrivateKey.Public(), proto.DatabaseCertRequest_DB_SERVICE)
+	require.NoError(t, err)
+	rekeyedCert, err := tlsca.ParseCertificatePEM(rekeyed.Cert)
+	require.NoError(t, err)
+	require.Equal(t, newPrivateKey.Public(), rekeyedCert.PublicKey)
+
+	// Rotate the database client CA through a full rotation, from the init
+	// phase to standby, after which the key that signed peerCert is no
+	// longer active: renewing against it should now be rejected.
+	err = authServer.AuthServer.RotateCertAuthority(ctx, RotateRequest{
+		Type:        types.DatabaseClientCA,
+		TargetPhase: types.RotationPhaseInit,
+		Mode:        types.RotationModeManual,
+	})
+	require.NoError(t, err)
+	err = authServer.AuthServer.RotateCertAuthority(ctx, RotateRequest{
+		Type:        types.DatabaseClientCA,
+		TargetPhase: types.RotationPhaseUpdateClients,
+		Mode:        types.RotationModeManual,
+	})
+	require.NoError(t, err)
+	err = authServer.AuthServer.RotateCertAuthority(ctx, RotateRequest{
+		Type:        types.DatabaseClientCA,
+		TargetPhase: types.RotationPhaseUpdateServers,
+		Mode:        types.RotationModeManual,
+	})
+	require.NoError(t, err)
+	err = authServer.AuthServer.RotateCertAuthority(ctx, RotateRequest{
+		Type:        types.DatabaseClientCA,
+		TargetPhase: types.RotationPhaseStandby,
+		Mode:        types.RotationModeManual,
+	})
+	require.NoError(t, err)
+
+	_, err = authServer.AuthServer.RenewDatabaseCert(ctx, peerCert, proto.DatabaseCertRequest_DB_SERVICE)
+	require.Error(t, err)
+	require.True(t, trace.IsAccessDenied(err))
+}
+
+func TestDatabaseTrustBundleRoles(t *testing.T) {
+	t.Parallel()
+	authServer, err := NewTestAuthServer(TestAuthServerConfig{
+		Clock:       clockwork.NewFakeClockAt(time.Now()),
+		ClusterName: "local.me",
+		Dir:         t.TempDir(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, authServer.Close()) })
+
+	ctx := context.Background()
+
+	privateKey, err := testauthority.New().GeneratePrivateKey()
+	require.NoError(t, err)
+	csr, err := tlsca.GenerateCertificateRequestPEM(pkix.Name{
+		CommonName: "localhost",
+	}, privateKey)
+	require.NoError(t, err)
+
+	resp, err := authServer.AuthServer.GenerateDatabaseCert(ctx, &proto.DatabaseCertRequest{
+		CSR:        csr,
+		ServerName: "localhost",
+		TTL:        proto.Duration(time.Hour),
+	})
+	require.NoError(t, err)
+	peerCert, err := tlsca.ParseCertificatePEM(resp.Cert)
+	require.NoError(t, err)
+
+	rolesByKeyID := func(resp *proto.DatabaseCertResponse) map[string]proto.DatabaseTrustBundleEntry_Role {
+		roles := make(map[string]proto.DatabaseTrustBundleEntry_Role, len(resp.TrustBundle))
+		for _, entry := range resp.TrustBundle {
+			roles[entry.KeyID] = entry.Role
+		}
+		return roles
+	}
+
+	phases := []types.RotationPhase{
+		types.RotationPhaseInit,
+		types.RotationPhaseUpdateClients,
+		types.RotationPhaseUpdateServers,
+	}
+	for _, phase := range phases {
+		err = authServer.AuthServer.RotateCertAuthority(ctx, RotateRequest{
+			Type:        types.DatabaseCA,
+			TargetPhase: phase,
+			Mode:        types.RotationModeManual,
+		})
+		require.NoError(t, err)
+
+		resp, err := authServer.AuthServer.RenewDatabaseCert(ctx, peerCert, proto.DatabaseCertRequest_DB_SERVICE)
+		require.NoError(t, err)
+
+		roles := rolesByKeyID(resp)
+		var active, additional int
+		for _, role := range roles {
+			switch role {
+			case proto.DatabaseTrustBundleEntry_ACTIVE:
+				active++
+			case proto.DatabaseTrustBundleEntry_ADDITIONAL_TRUSTED:
+				additional++
+			default:
+				t.Fatalf("unexpected role %v during phase %v", role, phase)
+			}
+		}
+		require.Equal(t, 1, active, "phase %v", phase)
+		require.Equal(t, 1, additional, "phase %v", phase)
+	}
+
+	err = authServer.AuthServer.RotateCertAuthority(ctx, RotateRequest{
+		Type:        types.DatabaseCA,
+		TargetPhase: types.RotationPhaseStandby,
+		Mode:        types.RotationModeManual,
+	})
+	require.NoError(t, err)
+
+	resp, err = authServer.AuthServer.RenewDatabaseCert(ctx, peerCert, proto.DatabaseCertRequest_DB_SERVICE)
+	require.NoError(t, err)
+	for _, entry := range resp.TrustBundle {
+		require.NotEqual(t, proto.DatabaseTrustBundleEntry_ADDITIONAL_TRUSTED, entry.Role,
+			"a completed rotation should not leave an ADDITIONAL_TRUSTED entry behind")
+	}
+}
+
 // mustVerifyCert is a helper func that verifies leaf cert with root cert.
 func mustVerifyCert(t *testing.T, rootPEM, leafPEM []byte, msgAndArgs ...any) {
 	t.Helper()
@@ -0,0 +1,45 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbjwt
+
+import (
+	"github.com/gravitational/trace"
+)
+
+// bigQueryAudience is the fixed audience GCP expects on a service-account
+// JWT presented for BigQuery access.
+const bigQueryAudience = "https://bigquery.googleapis.com/"
+
+// bigQueryIssuer implements BigQuery's RS256 self-signed service-account
+// JWT scheme: `iss` and `sub` both name the service account, and `aud` is
+// fixed to the BigQuery API audience.
+type bigQueryIssuer struct {
+	cfg Config
+}
+
+// Params implements [Issuer].
+func (b *bigQueryIssuer) Params(req IssueRequest) (Params, error) {
+	if req.DatabaseUser == "" {
+		return Params{}, trace.BadParameter("bigquery JWT auth requires a service account email as the database user")
+	}
+
+	return Params{
+		Subject: req.DatabaseUser,
+		Issuer:  req.DatabaseUser,
+		Extra: map[string]any{
+			"aud": bigQueryAudience,
+		},
+	}, nil
+}
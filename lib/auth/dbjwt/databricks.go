@@ -0,0 +1,43 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbjwt
+
+import "github.com/gravitational/trace"
+
+// databricksAudience is the token endpoint Databricks expects as the `aud`
+// claim on an OAuth2 JWT bearer assertion (RFC 7523 §2.1).
+const databricksAudience = "https://accounts.azuredatabricks.net/oidc/v1/token"
+
+// databricksIssuer implements Databricks' OAuth2 JWT bearer flow: both
+// `iss` and `sub` name the service principal ID, and `aud` is fixed to the
+// Databricks account token endpoint.
+type databricksIssuer struct {
+	cfg Config
+}
+
+// Params implements [Issuer].
+func (d *databricksIssuer) Params(req IssueRequest) (Params, error) {
+	if req.DatabaseUser == "" {
+		return Params{}, trace.BadParameter("databricks JWT auth requires a service principal ID as the database user")
+	}
+
+	return Params{
+		Subject: req.DatabaseUser,
+		Issuer:  req.DatabaseUser,
+		Extra: map[string]any{
+			"aud": databricksAudience,
+		},
+	}, nil
+}
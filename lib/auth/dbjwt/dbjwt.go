@@ -0,0 +1,149 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dbjwt implements the per-engine JWT issuance schemes Teleport
+// uses to authenticate to databases that accept a signed JWT in place of a
+// password - Snowflake key-pair auth, BigQuery and Databricks
+// service-account bearer tokens, and generic RFC 7523 JWT assertions.
+// [ForEngine] selects the right [Issuer] for a types.Database's engine.
+package dbjwt
+
+import (
+	"time"
+
+	"github.com/gravitational/trace"
+)
+
+// Algorithm is a JWT signing algorithm a [Issuer] is allowed to use.
+type Algorithm string
+
+const (
+	AlgorithmRS256 Algorithm = "RS256"
+	AlgorithmES256 Algorithm = "ES256"
+	AlgorithmEdDSA Algorithm = "EdDSA"
+)
+
+// KeySource selects where the private key backing a database JWT issuer
+// lives.
+type KeySource string
+
+const (
+	// KeySourceLocal signs with a key Teleport generates and stores itself.
+	KeySourceLocal KeySource = "local"
+	// KeySourceKMS signs with a key held in a cloud KMS.
+	KeySourceKMS KeySource = "kms"
+	// KeySourceHSM signs with a key held in an HSM.
+	KeySourceHSM KeySource = "hsm"
+)
+
+// Config is the JWTAuth spec block of a types.Database: it configures how
+// its [Issuer] builds and signs a JWT.
+type Config struct {
+	// ClaimTemplate is a text/template string rendered against the
+	// [IssueRequest] to produce additional claims for the JWT. Only the
+	// generic issuer, used for engines with no dedicated [Issuer], renders
+	// it; the Snowflake, BigQuery, and Databricks issuers ignore it.
+	ClaimTemplate string
+	// AllowedAlgorithms lists the signing algorithms the issuer may use,
+	// defaulting to RS256. ForEngine rejects a BigQuery config that does
+	// not allow RS256; no other check is made against this list here.
+	AllowedAlgorithms []Algorithm
+	// KeySource selects where the signing key is held.
+	KeySource KeySource
+	// TTL caps how long an issued JWT is valid for.
+	TTL time.Duration
+}
+
+// CheckAndSetDefaults validates c and fills in defaults for fields left
+// unset.
+func (c *Config) CheckAndSetDefaults() error {
+	if len(c.AllowedAlgorithms) == 0 {
+		c.AllowedAlgorithms = []Algorithm{AlgorithmRS256}
+	}
+	if c.KeySource == "" {
+		c.KeySource = KeySourceLocal
+	}
+	if c.TTL <= 0 {
+		c.TTL = time.Hour
+	}
+	return nil
+}
+
+// allows reports whether alg is one of c's AllowedAlgorithms.
+func (c *Config) allows(alg Algorithm) bool {
+	for _, allowed := range c.AllowedAlgorithms {
+		if allowed == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// IssueRequest carries the parameters a [Issuer] needs to build a
+// database-specific JWT subject, issuer, and claim set.
+type IssueRequest struct {
+	// DatabaseUser is the Teleport-resolved database username the JWT
+	// authenticates as.
+	DatabaseUser string
+	// AccountName is the cloud account/organization identifier the
+	// database belongs to, e.g. a Snowflake account locator or a GCP
+	// project ID.
+	AccountName string
+	// PublicKey is the DER-encoded public key paired with the private key
+	// that will sign the JWT.
+	PublicKey []byte
+}
+
+// Params is the subject, issuer, and extra claims an [Issuer] derives for
+// an [IssueRequest]. How these map onto JWT registered claims is
+// issuer-specific: Snowflake key-pair auth puts both into `sub`/`iss`,
+// while RFC 7523-style bearer assertions split them across `sub` and
+// `iss`/`aud` as the spec requires.
+type Params struct {
+	Subject string
+	Issuer  string
+	Extra   map[string]any
+}
+
+// Issuer derives the subject/issuer/claims for a database's JWT auth
+// scheme. Signing the resulting JWT is handled uniformly by the caller,
+// using the key selected by Config.KeySource - Issuer only shapes the
+// claims.
+type Issuer interface {
+	// Params returns the subject, issuer, and any additional claims for
+	// req, or an error if req is missing a field the scheme requires.
+	Params(req IssueRequest) (Params, error)
+}
+
+// ForEngine returns the [Issuer] for a types.Database's engine name,
+// configured with cfg after filling in its defaults.
+func ForEngine(engine string, cfg Config) (Issuer, error) {
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	switch engine {
+	case "snowflake":
+		return &snowflakeIssuer{cfg: cfg}, nil
+	case "bigquery":
+		if !cfg.allows(AlgorithmRS256) {
+			return nil, trace.BadParameter("bigquery JWT auth requires RS256 to be an allowed algorithm")
+		}
+		return &bigQueryIssuer{cfg: cfg}, nil
+	case "databricks":
+		return &databricksIssuer{cfg: cfg}, nil
+	default:
+		return &genericOIDCIssuer{cfg: cfg}, nil
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbjwt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForEngine(t *testing.T) {
+	tests := []struct {
+		engine   string
+		wantType Issuer
+	}{
+		{engine: "snowflake", wantType: &snowflakeIssuer{}},
+		{engine: "bigquery", wantType: &bigQueryIssuer{}},
+		{engine: "databricks", wantType: &databricksIssuer{}},
+		{engine: "postgres", wantType: &genericOIDCIssuer{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.engine, func(t *testing.T) {
+			issuer, err := ForEngine(tt.engine, Config{})
+			require.NoError(t, err)
+			require.IsType(t, tt.wantType, issuer)
+		})
+	}
+}
+
+func TestSnowflakeJWTParams(t *testing.T) {
+	type args struct {
+		accountName string
+		userName    string
+		publicKey   []byte
+	}
+	tests := []struct {
+		name        string
+		args        args
+		wantSubject string
+		wantIssuer  string
+	}{
+		{
+			name: "only account locator",
+			args: args{
+				accountName: "abc123",
+				userName:    "user1",
+				publicKey:   []byte("fakeKey"),
+			},
+			wantSubject: "ABC123.USER1",
+			wantIssuer:  "ABC123.USER1.SHA256:q3OCFrBX3MOuBefrAI0e2UgNh5yLGIiSSIuncvcMdGA=",
+		},
+		{
+			name: "GCP",
+			args: args{
+				accountName: "abc321.us-central1.gcp",
+				userName:    "user1",
+				publicKey:   []byte("fakeKey"),
+			},
+			wantSubject: "ABC321.USER1",
+			wantIssuer:  "ABC321.USER1.SHA256:q3OCFrBX3MOuBefrAI0e2UgNh5yLGIiSSIuncvcMdGA=",
+		},
+		{
+			name: "AWS",
+			args: args{
+				accountName: "abc321.us-west-2.aws",
+				userName:    "user2",
+				publicKey:   []byte("fakeKey"),
+			},
+			wantSubject: "ABC321.USER2",
+			wantIssuer:  "ABC321.USER2.SHA256:q3OCFrBX3MOuBefrAI0e2UgNh5yLGIiSSIuncvcMdGA=",
+		},
+		{
+			name: "global",
+			args: args{
+				accountName: "testaccount-user.global",
+				userName:    "user2",
+				publicKey:   []byte("fakeKey"),
+			},
+			wantSubject: "TESTACCOUNT.USER2",
+			wantIssuer:  "TESTACCOUNT.USER2.SHA256:q3OCFrBX3MOuBefrAI0e2UgNh5yLGIiSSIuncvcMdGA=",
+		},
+		{
+			name: "arbitrary binary key",
+			args: args{
+				accountName: "abc123",
+				userName:    "user1",
+				publicKey:   []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20},
+			},
+			wantSubject: "ABC123.USER1",
+			wantIssuer:  "ABC123.USER1.SHA256:4S8IdDNEwOq3r6oiu3Hicl9+E97OasLSNxEFTueHtsI=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, issuer := SnowflakeJWTParams(tt.args.accountName, tt.args.userName, tt.args.publicKey)
+
+			require.Equal(t, tt.wantSubject, subject)
+			require.Equal(t, tt.wantIssuer, issuer)
+		})
+	}
+}
+
+func TestBigQueryIssuerParams(t *testing.T) {
+	issuer, err := ForEngine("bigquery", Config{})
+	require.NoError(t, err)
+
+	params, err := issuer.Params(IssueRequest{DatabaseUser: "svc@project.iam.gserviceaccount.com"})
+	require.NoError(t, err)
+	require.Equal(t, "svc@project.iam.gserviceaccount.com", params.Subject)
+	require.Equal(t, "svc@project.iam.gserviceaccount.com", params.Issuer)
+	require.Equal(t, "https://bigquery.googleapis.com/", params.Extra["aud"])
+
+	_, err = issuer.Params(IssueRequest{})
+	require.Error(t, err)
+}
+
+func TestDatabricksIssuerParams(t *testing.T) {
+	issuer, err := ForEngine("databricks", Config{})
+	require.NoError(t, err)
+
+	params, err := issuer.Params(IssueRequest{DatabaseUser: "11111111-2222-3333-4444-555555555555"})
+	require.NoError(t, err)
+	require.Equal(t, "11111111-2222-3333-4444-555555555555", params.Subject)
+	require.Equal(t, "11111111-2222-3333-4444-555555555555", params.Issuer)
+	require.Equal(t, databricksAudience, params.Extra["aud"])
+}
+
+func TestGenericOIDCIssuerParams(t *testing.T) {
+	t.Run("no claim template", func(t *testing.T) {
+		issuer, err := ForEngine("postgres", Config{})
+		require.NoError(t, err)
+
+		params, err := issuer.Params(IssueRequest{DatabaseUser: "alice", AccountName: "my-cluster"})
+		require.NoError(t, err)
+		require.Equal(t, "alice", params.Subject)
+		require.Equal(t, "my-cluster", params.Issuer)
+		require.Nil(t, params.Extra)
+	})
+
+	t.Run("claim template", func(t *testing.T) {
+		issuer, err := ForEngine("postgres", Config{
+			ClaimTemplate: `{"role": "{{.DatabaseUser}}"}`,
+		})
+		require.NoError(t, err)
+
+		params, err := issuer.Params(IssueRequest{DatabaseUser: "alice", AccountName: "my-cluster"})
+		require.NoError(t, err)
+		require.Equal(t, "alice", params.Extra["role"])
+	})
+
+	t.Run("missing database user", func(t *testing.T) {
+		issuer, err := ForEngine("postgres", Config{})
+		require.NoError(t, err)
+
+		_, err = issuer.Params(IssueRequest{})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbjwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"text/template"
+
+	"github.com/gravitational/trace"
+)
+
+// genericOIDCIssuer implements a generic RFC 7523 JWT assertion: `sub` is
+// the database user, `iss` defaults to the account name unless
+// cfg.ClaimTemplate overrides it, and any further claims a database's
+// OIDC-style auth expects come entirely from cfg.ClaimTemplate. It is the
+// fallback for engines with no dedicated [Issuer].
+type genericOIDCIssuer struct {
+	cfg Config
+}
+
+// Params implements [Issuer].
+func (g *genericOIDCIssuer) Params(req IssueRequest) (Params, error) {
+	if req.DatabaseUser == "" {
+		return Params{}, trace.BadParameter("generic JWT auth requires a database user")
+	}
+
+	params := Params{
+		Subject: req.DatabaseUser,
+		Issuer:  req.AccountName,
+	}
+
+	if g.cfg.ClaimTemplate == "" {
+		return params, nil
+	}
+
+	extra, err := renderClaimTemplate(g.cfg.ClaimTemplate, req)
+	if err != nil {
+		return Params{}, trace.Wrap(err)
+	}
+	params.Extra = extra
+	return params, nil
+}
+
+// renderClaimTemplate executes tmpl against req, expecting a JSON object as
+// output, and decodes it into a claim map.
+func renderClaimTemplate(tmpl string, req IssueRequest) (map[string]any, error) {
+	t, err := template.New("claims").Parse(tmpl)
+	if err != nil {
+		return nil, trace.Wrap(err, "invalid claim template")
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, req); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var claims map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &claims); err != nil {
+		return nil, trace.Wrap(err, "claim template did not render to a JSON object")
+	}
+	return claims, nil
+}
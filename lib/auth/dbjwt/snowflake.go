@@ -0,0 +1,71 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbjwt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/gravitational/trace"
+)
+
+// snowflakeIssuer implements Snowflake key-pair JWT authentication: the
+// subject and issuer are both "<account>.<user>", with the issuer suffixed
+// by a SHA-256 fingerprint of the public key registered against the user,
+// per Snowflake's key-pair authentication spec.
+type snowflakeIssuer struct {
+	cfg Config
+}
+
+// Params implements [Issuer].
+func (s *snowflakeIssuer) Params(req IssueRequest) (Params, error) {
+	if req.AccountName == "" || req.DatabaseUser == "" {
+		return Params{}, trace.BadParameter("snowflake JWT auth requires an account name and database user")
+	}
+
+	subject, issuer := SnowflakeJWTParams(req.AccountName, req.DatabaseUser, req.PublicKey)
+	return Params{Subject: subject, Issuer: issuer}, nil
+}
+
+// SnowflakeJWTParams derives the subject and issuer for a Snowflake
+// key-pair auth JWT from accountName (an account locator, optionally
+// suffixed with "-<id>" for an organization account or ".<region>.<cloud>"
+// / ".global" for a replication-aware identifier), userName, and the
+// DER-encoded publicKey registered against that user.
+func SnowflakeJWTParams(accountName, userName string, publicKey []byte) (subject, issuer string) {
+	subject = fmt.Sprintf("%s.%s", normalizeSnowflakeAccountName(accountName), strings.ToUpper(userName))
+
+	sum := sha256.Sum256(publicKey)
+	fingerprint := base64.StdEncoding.EncodeToString(sum[:])
+	issuer = fmt.Sprintf("%s.SHA256:%s", subject, fingerprint)
+
+	return subject, issuer
+}
+
+// normalizeSnowflakeAccountName reduces a Snowflake account identifier to
+// the bare account locator Snowflake expects in the JWT subject, stripping
+// any ".<region>.<cloud>" / ".global" suffix and any "-<id>" organization
+// account suffix.
+func normalizeSnowflakeAccountName(accountName string) string {
+	if idx := strings.IndexByte(accountName, '.'); idx > 0 {
+		accountName = accountName[:idx]
+	}
+	if idx := strings.IndexByte(accountName, '-'); idx > 0 {
+		accountName = accountName[:idx]
+	}
+	return strings.ToUpper(accountName)
+}
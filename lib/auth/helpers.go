@@ -675,6 +675,35 @@ type TestTLSServer struct {
 	Identity *Identity
 	// TLSServer is a configured TLS server
 	TLSServer *TLSServer
+	// dynamicTLS backs TLSServer's configuration, allowing the server
+	// certificate and client CA pool to be reloaded via ReloadTLS.
+	dynamicTLS *DynamicTLSConfig
+}
+
+// ReloadTLS swaps out the server certificate and/or client CA pool used for
+// new TLS handshakes, without restarting the listener. Either argument may
+// be nil to leave the corresponding value unchanged.
+func (t *TestTLSServer) ReloadTLS(cert *tls.Certificate, clientCAs *x509.CertPool) error {
+	return trace.Wrap(t.dynamicTLS.Update(cert, clientCAs))
+}
+
+// RotateCA simulates the reaction of a production [CertReloader] to a
+// certificate authority rotation: it re-derives t's TLS identity against
+// t.AuthServer's current CA state and pushes the result through ReloadTLS.
+// Call it after rotating the CA on t.AuthServer.AuthServer (e.g. via
+// RotateCertAuthority) to exercise the reload path that keeps t's listener
+// serving a rotated CA without a restart.
+func (t *TestTLSServer) RotateCA(ctx context.Context) error {
+	identity, err := NewServerIdentity(t.AuthServer.AuthServer, "test-tls-server", types.RoleAuth)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	tlsConfig, err := identity.TLSConfig(t.AuthServer.CipherSuites)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	t.Identity = identity
+	return trace.Wrap(t.ReloadTLS(&tlsConfig.Certificates[0], tlsConfig.ClientCAs))
 }
 
 // ClusterName returns name of test TLS server cluster
@@ -726,6 +755,11 @@ func NewTestTLSServer(cfg TestTLSServerConfig) (*TestTLSServer, error) {
 	}
 	tlsConfig.Time = cfg.AuthServer.Clock().Now
 
+	// Wrap the identity-derived TLS config in a DynamicTLSConfig so that
+	// tests can exercise hot-reload of the server certificate and client CA
+	// pool, e.g. to simulate a CA rotation, via [TestTLSServer.ReloadTLS].
+	srv.dynamicTLS = NewDynamicTLSConfig(tlsConfig)
+
 	accessPoint, err := NewAdminAuthServer(srv.AuthServer.AuthServer, srv.AuthServer.AuditLog)
 	if err != nil {
 		return nil, trace.Wrap(err)
@@ -739,7 +773,7 @@ func NewTestTLSServer(cfg TestTLSServerConfig) (*TestTLSServer, error) {
 	srv.TLSServer, err = NewTLSServer(TLSServerConfig{
 		Listener:      srv.Listener,
 		AccessPoint:   accessPoint,
-		TLS:           tlsConfig,
+		TLS:           srv.dynamicTLS.TLSConfig(),
 		APIConfig:     *srv.APIConfig,
 		LimiterConfig: *srv.Limiter,
 		AcceptedUsage: cfg.AcceptedUsage,
@@ -787,6 +821,21 @@ func TestUserWithDeviceExtensions(username string, exts tlsca.DeviceExtensions)
 	}
 }
 
+// TestIdentityFromPeerCert returns a TestIdentity derived from cert's
+// subject common name, the way [TLSServer] would identify a client
+// presenting an externally-issued certificate. It lets tests in this file
+// exercise the [PeerCertMatcher] matching path without needing a
+// Teleport-issued certificate bearing a tlsca.Identity extension.
+func TestIdentityFromPeerCert(cert *x509.Certificate) TestIdentity {
+	username := cert.Subject.CommonName
+	return TestIdentity{
+		I: authz.LocalUser{
+			Username: username,
+			Identity: tlsca.Identity{Username: username},
+		},
+	}
+}
+
 // TestUser returns a TestIdentity for a local user
 // with renewable credentials.
 func TestRenewableUser(username string, generation uint64) TestIdentity {
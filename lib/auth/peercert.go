@@ -0,0 +1,79 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import "crypto/x509"
+
+// PeerCertificateAttributes holds the subject distinguished name and subject
+// alternative name fields parsed from a client's TLS peer certificate. It is
+// attached to requests by [TLSServer] so that [authz.Authorizer] and audit
+// event emission can make use of the raw certificate attributes in addition
+// to the identity encoded in the certificate's teleport-specific extensions.
+// This matters for deployments where Teleport fronts workloads issued certs
+// by an external PKI (e.g. a SPIFFE/mTLS mesh, a corporate CA) that roles
+// and audit filters need to match on directly, rather than through a
+// Teleport-issued tlsca.Identity.
+type PeerCertificateAttributes struct {
+	// Subject is the certificate's subject distinguished name in RFC 2253
+	// string form, e.g. "CN=alice,OU=eng,O=example".
+	Subject string
+	// Issuer is the certificate's issuer distinguished name in RFC 2253
+	// string form.
+	Issuer string
+	// SerialNumber is the certificate's serial number in decimal string
+	// form.
+	SerialNumber string
+	// DNSNames holds the SAN dNSName entries.
+	DNSNames []string
+	// EmailAddresses holds the SAN rfc822Name entries.
+	EmailAddresses []string
+	// IPAddresses holds the SAN iPAddress entries, rendered as strings.
+	IPAddresses []string
+	// URIs holds the SAN uniformResourceIdentifier entries, rendered as
+	// strings.
+	URIs []string
+}
+
+// ParsePeerCertificateAttributes extracts the DN and SAN attributes from
+// cert. A nil cert returns the zero value.
+func ParsePeerCertificateAttributes(cert *x509.Certificate) PeerCertificateAttributes {
+	if cert == nil {
+		return PeerCertificateAttributes{}
+	}
+
+	attrs := PeerCertificateAttributes{
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		SerialNumber:   cert.SerialNumber.String(),
+		DNSNames:       append([]string(nil), cert.DNSNames...),
+		EmailAddresses: append([]string(nil), cert.EmailAddresses...),
+	}
+
+	for _, ip := range cert.IPAddresses {
+		attrs.IPAddresses = append(attrs.IPAddresses, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		attrs.URIs = append(attrs.URIs, uri.String())
+	}
+
+	return attrs
+}
+
+// PeerCertMatcher reports whether attrs satisfies a role condition written
+// against raw peer-certificate fields (e.g. external_cert.issuer.common_name,
+// external_cert.san.uri). [authz.AuthorizerOpts.PeerCertMatcher] holds one of
+// these so that [authz.Authorizer] can evaluate such conditions without
+// depending on this package.
+type PeerCertMatcher func(attrs PeerCertificateAttributes) bool
@@ -0,0 +1,62 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeerCertificateAttributes(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	spiffeURI, err := url.Parse("spiffe://example.com/ns/default/sa/db-agent")
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(42),
+		Subject:        pkix.Name{CommonName: "alice", Organization: []string{"example"}},
+		Issuer:         pkix.Name{CommonName: "corporate-ca"},
+		DNSNames:       []string{"alice.example.com"},
+		EmailAddresses: []string{"alice@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:           []*url.URL{spiffeURI},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	attrs := ParsePeerCertificateAttributes(cert)
+	require.Equal(t, "42", attrs.SerialNumber)
+	require.Equal(t, []string{"alice.example.com"}, attrs.DNSNames)
+	require.Equal(t, []string{"alice@example.com"}, attrs.EmailAddresses)
+	require.Equal(t, []string{"10.0.0.1"}, attrs.IPAddresses)
+	require.Equal(t, []string{"spiffe://example.com/ns/default/sa/db-agent"}, attrs.URIs)
+}
+
+func TestParsePeerCertificateAttributesNilCert(t *testing.T) {
+	require.Equal(t, PeerCertificateAttributes{}, ParsePeerCertificateAttributes(nil))
+}
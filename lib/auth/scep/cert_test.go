@@ -0,0 +1,127 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scep
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssueCertificate(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          generateSerial(t),
+		Subject:               pkix.Name{CommonName: "db-client-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csrTemplate := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "attacker-chosen-name"}}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, csrTemplate, clientKey)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	require.NoError(t, err)
+
+	provisioner := &Provisioner{
+		Name:                    "jamf",
+		ChallengePassword:       "secret",
+		AllowedIdentityTemplate: "db-agent-{{.CommonName}}",
+		TTL:                     time.Hour,
+	}
+
+	cert, err := issueCertificate(csr, caCert, caKey, provisioner)
+	require.NoError(t, err)
+
+	// The identity template, not the CSR's own subject, decides the issued
+	// common name.
+	require.Equal(t, "db-agent-attacker-chosen-name", cert.Subject.CommonName)
+	require.WithinDuration(t, time.Now().Add(provisioner.TTL), cert.NotAfter, time.Minute)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.NoError(t, err)
+}
+
+func TestIssueCertificateIgnoresCSRSubjectAltNames(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          generateSerial(t),
+		Subject:               pkix.Name{CommonName: "db-client-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	csrTemplate := &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: "legit-name"},
+		DNSNames:       []string{"attacker-chosen.example.com"},
+		EmailAddresses: []string{"attacker@example.com"},
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, csrTemplate, clientKey)
+	require.NoError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	require.NoError(t, err)
+
+	provisioner := &Provisioner{
+		Name:                    "jamf",
+		ChallengePassword:       "secret",
+		AllowedIdentityTemplate: "db-agent-{{.CommonName}}",
+		TTL:                     time.Hour,
+	}
+
+	cert, err := issueCertificate(csr, caCert, caKey, provisioner)
+	require.NoError(t, err)
+
+	// A CSR's SANs are just as attacker-controlled as its CommonName, and
+	// AllowedIdentityTemplate gives the provisioner no way to constrain
+	// them - they must never survive into the issued certificate.
+	require.Empty(t, cert.DNSNames)
+	require.Empty(t, cert.EmailAddresses)
+}
+
+func generateSerial(t *testing.T) *big.Int {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	require.NoError(t, err)
+	return serial
+}
@@ -0,0 +1,217 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scep
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net/http"
+
+	"github.com/gravitational/trace"
+	"github.com/julienschmidt/httprouter"
+	scepserver "github.com/micromdm/scep/v2/scep"
+	"github.com/sirupsen/logrus"
+
+	apievents "github.com/gravitational/teleport/api/types/events"
+	"github.com/gravitational/teleport/lib/events"
+)
+
+// caCapabilities are the SCEP capabilities Teleport advertises through
+// GetCACaps. Renewal is supported because RenewDatabaseCert/RekeyDatabaseCert
+// already provide a way to reissue without a fresh CSR; POSTPKIOperation
+// lets clients avoid cramming a large PKCSReq into a query string.
+var caCapabilities = []byte("Renewal\nSHA-256\nPOSTPKIOperation\n")
+
+// CertAuthorityGetter is the subset of auth.Server the SCEP handler needs:
+// the active DatabaseClientCA key, selected with the same rotation-aware
+// logic GenerateDatabaseCert and RenewDatabaseCert use, so a SCEP client and
+// a gRPC client always agree on which key is currently signing.
+type CertAuthorityGetter interface {
+	ActiveDatabaseClientCA(ctx context.Context) (cert *x509.Certificate, signer crypto.Signer, err error)
+}
+
+// AuditLogger is the subset of the Teleport audit log the handler needs to
+// record enrollment attempts.
+type AuditLogger interface {
+	EmitAuditEvent(ctx context.Context, event apievents.AuditEvent) error
+}
+
+// Handler serves the SCEP (RFC 8894) endpoints backing enrollment against
+// Teleport's DatabaseClientCA. It is mounted under
+// "/scep/:provisioner/pkiclient.exe" by the caller.
+type Handler struct {
+	// CertAuthority provides the signing key for PKIOperation and the CA
+	// certificate for GetCACert.
+	CertAuthority CertAuthorityGetter
+	// Emitter records enrollment attempts to the cluster audit log.
+	Emitter AuditLogger
+	// Provisioners holds the configured SCEPProvisioner resources, keyed by
+	// name, that gate enrollment.
+	Provisioners map[string]*Provisioner
+	// Log is used to log messages, defaulting to the standard logger if
+	// unset.
+	Log logrus.FieldLogger
+}
+
+func (h *Handler) log() logrus.FieldLogger {
+	if h.Log != nil {
+		return h.Log
+	}
+	return logrus.StandardLogger()
+}
+
+// GetCACaps implements the SCEP GetCACaps operation: it returns the newline
+// separated list of capabilities this endpoint supports.
+func (h *Handler) GetCACaps(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write(caCapabilities)
+}
+
+// GetCACert implements the SCEP GetCACert operation: it returns the DER
+// encoding of the active DatabaseClientCA certificate.
+func (h *Handler) GetCACert(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	cert, _, err := h.CertAuthority.ActiveDatabaseClientCA(r.Context())
+	if err != nil {
+		h.log().WithError(err).Warn("Failed to load the active DatabaseClientCA for a SCEP GetCACert request.")
+		http.Error(w, "failed to load CA certificate", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	_, _ = w.Write(cert.Raw)
+}
+
+// PKIOperation implements the SCEP PKIOperation operation, dispatching to
+// the PKCSReq, RenewalReq, and GetCertInitial message types. The CSR is
+// taken from the POST body, or from the "message" query parameter
+// base64-decoded for clients that only support GET.
+func (h *Handler) PKIOperation(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	ctx := r.Context()
+	provisionerName := p.ByName("provisioner")
+	provisioner, ok := h.Provisioners[provisionerName]
+	if !ok {
+		http.Error(w, "unknown provisioner", http.StatusNotFound)
+		return
+	}
+
+	raw, err := readPKIMessage(r)
+	if err != nil {
+		h.log().WithError(err).Warn("Failed to read a SCEP PKIOperation request body.")
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := scepserver.ParsePKIMessage(raw)
+	if err != nil {
+		h.auditEnrollFailure(ctx, provisionerName, err)
+		http.Error(w, "malformed PKI message", http.StatusBadRequest)
+		return
+	}
+
+	if msg.MessageType != scepserver.PKCSReq && msg.MessageType != scepserver.RenewalReq && msg.MessageType != scepserver.GetCertInitial {
+		h.auditEnrollFailure(ctx, provisionerName, trace.BadParameter("unsupported messageType %v", msg.MessageType))
+		http.Error(w, "unsupported messageType", http.StatusBadRequest)
+		return
+	}
+
+	caCert, signer, err := h.CertAuthority.ActiveDatabaseClientCA(ctx)
+	if err != nil {
+		h.auditEnrollFailure(ctx, provisionerName, err)
+		http.Error(w, "failed to load CA", http.StatusInternalServerError)
+		return
+	}
+
+	// The CSR is enveloped (encrypted) to the CA's public key per RFC 8894
+	// §3.3; decrypt it with the same active key that will sign the response
+	// so a rotation mid-flight can't leave the envelope unreadable.
+	if err := msg.DecryptPKIEnvelope(caCert, signer); err != nil {
+		h.auditEnrollFailure(ctx, provisionerName, err)
+		http.Error(w, "failed to decrypt request", http.StatusBadRequest)
+		return
+	}
+
+	if !provisioner.AuthenticateChallenge(msg.CSRReqMessage.ChallengePassword) {
+		h.auditEnrollFailure(ctx, provisionerName, trace.AccessDenied("invalid challenge password"))
+		http.Error(w, "invalid challenge password", http.StatusForbidden)
+		return
+	}
+
+	cert, err := issueCertificate(msg.CSRReqMessage.CSR, caCert, signer, provisioner)
+	if err != nil {
+		h.auditEnrollFailure(ctx, provisionerName, err)
+		http.Error(w, "failed to issue certificate", http.StatusInternalServerError)
+		return
+	}
+
+	resp, err := scepserver.DegenerateCertificates([]*x509.Certificate{cert, caCert})
+	if err != nil {
+		h.auditEnrollFailure(ctx, provisionerName, err)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.Emitter.EmitAuditEvent(ctx, &apievents.SCEPEnroll{
+		Metadata: apievents.Metadata{
+			Type: events.SCEPEnrollEvent,
+			Code: events.SCEPEnrollSuccessCode,
+		},
+		Provisioner: provisionerName,
+		Subject:     msg.CSRReqMessage.CSR.Subject.String(),
+		Status:      apievents.Status{Success: true},
+	}); err != nil {
+		h.log().WithError(err).Warn("Failed to emit SCEP enrollment audit event.")
+	}
+
+	w.Header().Set("Content-Type", "application/x-pki-message")
+	_, _ = w.Write(resp)
+}
+
+func (h *Handler) auditEnrollFailure(ctx context.Context, provisioner string, cause error) {
+	h.log().WithError(cause).Warn("Rejected a SCEP enrollment attempt.")
+	if err := h.Emitter.EmitAuditEvent(ctx, &apievents.SCEPEnroll{
+		Metadata: apievents.Metadata{
+			Type: events.SCEPEnrollEvent,
+			Code: events.SCEPEnrollFailureCode,
+		},
+		Provisioner: provisioner,
+		Status: apievents.Status{
+			Success: false,
+			Error:   cause.Error(),
+		},
+	}); err != nil {
+		h.log().WithError(err).Warn("Failed to emit SCEP enrollment audit event.")
+	}
+}
+
+// readPKIMessage reads the raw PKCS#7 message from a POST body, or decodes
+// it from the "message" query parameter for operations submitted over GET.
+func readPKIMessage(r *http.Request) ([]byte, error) {
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPKIMessageBytes))
+		return body, trace.Wrap(err)
+	}
+
+	message := r.URL.Query().Get("message")
+	decoded, err := base64.StdEncoding.DecodeString(message)
+	return decoded, trace.Wrap(err)
+}
+
+// maxPKIMessageBytes bounds the size of a PKIOperation request body so that
+// an unauthenticated caller can't use the enrollment endpoint to exhaust
+// memory.
+const maxPKIMessageBytes = 1 << 20
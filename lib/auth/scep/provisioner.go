@@ -0,0 +1,71 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scep implements a SCEP (RFC 8894) enrollment endpoint backed by
+// Teleport's DatabaseClientCA, for network appliances and legacy database
+// clients that cannot speak the Teleport gRPC API.
+package scep
+
+import (
+	"crypto/subtle"
+	"time"
+
+	"github.com/gravitational/trace"
+)
+
+// Provisioner is the SCEPProvisioner resource: it gates enrollment with a
+// shared challenge password and bounds what identity and TTL a PKCSReq may
+// obtain, so that a SCEP endpoint exposed to appliances outside the cluster
+// can't be used to mint an arbitrary Teleport identity.
+type Provisioner struct {
+	// Name identifies the provisioner in the SCEP URL path, e.g.
+	// "/scep/<name>/pkiclient.exe".
+	Name string
+	// ChallengePassword is the shared secret a PKCSReq must echo back in its
+	// SCEP challengePassword attribute to be accepted.
+	ChallengePassword string
+	// AllowedIdentityTemplate is a text/template string, rendered with the
+	// CSR's subject common name, that produces the Teleport identity
+	// (database username) bound into the issued certificate as its subject
+	// common name. No SANs are set on the issued certificate.
+	AllowedIdentityTemplate string
+	// TTL caps how long an issued certificate is valid for, regardless of
+	// what the CSR or a RenewalReq asks for.
+	TTL time.Duration
+}
+
+// CheckAndSetDefaults validates p and fills in defaults for fields left
+// unset, following the same convention as other Teleport resource configs.
+func (p *Provisioner) CheckAndSetDefaults() error {
+	if p.Name == "" {
+		return trace.BadParameter("missing provisioner name")
+	}
+	if p.ChallengePassword == "" {
+		return trace.BadParameter("missing provisioner challenge password")
+	}
+	if p.AllowedIdentityTemplate == "" {
+		return trace.BadParameter("missing provisioner allowed identity template")
+	}
+	if p.TTL <= 0 {
+		p.TTL = 12 * time.Hour
+	}
+	return nil
+}
+
+// AuthenticateChallenge reports whether challenge matches the provisioner's
+// configured challenge password, using a constant-time comparison so that
+// response timing can't be used to guess it.
+func (p *Provisioner) AuthenticateChallenge(challenge string) bool {
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(p.ChallengePassword)) == 1
+}
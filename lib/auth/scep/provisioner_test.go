@@ -0,0 +1,63 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scep
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvisionerCheckAndSetDefaults(t *testing.T) {
+	t.Run("fills in a default TTL", func(t *testing.T) {
+		p := &Provisioner{
+			Name:                    "jamf",
+			ChallengePassword:       "secret",
+			AllowedIdentityTemplate: "{{.CommonName}}",
+		}
+		require.NoError(t, p.CheckAndSetDefaults())
+		require.Equal(t, 12*time.Hour, p.TTL)
+	})
+
+	t.Run("rejects missing fields", func(t *testing.T) {
+		tests := []struct {
+			name string
+			p    Provisioner
+		}{
+			{name: "missing name", p: Provisioner{ChallengePassword: "s", AllowedIdentityTemplate: "t"}},
+			{name: "missing challenge password", p: Provisioner{Name: "n", AllowedIdentityTemplate: "t"}},
+			{name: "missing identity template", p: Provisioner{Name: "n", ChallengePassword: "s"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				require.Error(t, tt.p.CheckAndSetDefaults())
+			})
+		}
+	})
+}
+
+func TestProvisionerAuthenticateChallenge(t *testing.T) {
+	p := &Provisioner{
+		Name:                    "jamf",
+		ChallengePassword:       "correct-horse-battery-staple",
+		AllowedIdentityTemplate: "{{.CommonName}}",
+	}
+	require.NoError(t, p.CheckAndSetDefaults())
+
+	require.True(t, p.AuthenticateChallenge("correct-horse-battery-staple"))
+	require.False(t, p.AuthenticateChallenge("wrong"))
+	require.False(t, p.AuthenticateChallenge(""))
+}
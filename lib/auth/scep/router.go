@@ -0,0 +1,44 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scep
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// RegisterHandlers mounts h's SCEP operations on router under
+// "/scep/:provisioner/pkiclient.exe", the conventional SCEP path.
+func RegisterHandlers(router *httprouter.Router, h *Handler) {
+	router.GET("/scep/:provisioner/pkiclient.exe", h.dispatchGET)
+	router.POST("/scep/:provisioner/pkiclient.exe", h.PKIOperation)
+}
+
+// dispatchGET routes a GET request to GetCACaps, GetCACert, or PKIOperation
+// based on the "operation" query parameter, as RFC 8894 §4 requires: all
+// three share a single URL and are distinguished by that parameter.
+func (h *Handler) dispatchGET(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	switch r.URL.Query().Get("operation") {
+	case "GetCACaps":
+		h.GetCACaps(w, r, p)
+	case "GetCACert":
+		h.GetCACert(w, r, p)
+	case "PKIOperation":
+		h.PKIOperation(w, r, p)
+	default:
+		http.Error(w, "unknown SCEP operation", http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"sync/atomic"
+
+	"github.com/gravitational/trace"
+)
+
+// DynamicTLSConfig wraps a *tls.Config and allows the server certificate and
+// client CA pool backing it to be swapped out at runtime - for example when
+// a certificate authority is rotated - without requiring [TLSServer] to be
+// restarted or existing listeners to be torn down.
+type DynamicTLSConfig struct {
+	current atomic.Pointer[tls.Config]
+}
+
+// NewDynamicTLSConfig creates a [DynamicTLSConfig] seeded with the provided
+// base configuration. base is cloned so that later callers mutating it have
+// no effect on the [DynamicTLSConfig].
+func NewDynamicTLSConfig(base *tls.Config) *DynamicTLSConfig {
+	d := &DynamicTLSConfig{}
+	d.current.Store(base.Clone())
+	return d
+}
+
+// TLSConfig returns a *tls.Config whose GetConfigForClient callback always
+// hands back the most recently set certificate and CA pool. The returned
+// value is safe to pass to [tls.Listen] or [http.Server.TLSConfig] once and
+// reused for the lifetime of the listener.
+func (d *DynamicTLSConfig) TLSConfig() *tls.Config {
+	base := d.current.Load().Clone()
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		return d.current.Load(), nil
+	}
+	return base
+}
+
+// Update atomically replaces the server certificate and/or client CA pool
+// used by subsequent TLS handshakes. Either argument may be nil to leave the
+// corresponding value unchanged.
+func (d *DynamicTLSConfig) Update(cert *tls.Certificate, clientCAs *x509.CertPool) error {
+	prev := d.current.Load()
+	if prev == nil {
+		return trace.BadParameter("dynamic TLS config has not been initialized")
+	}
+
+	next := prev.Clone()
+	if cert != nil {
+		next.Certificates = []tls.Certificate{*cert}
+	}
+	if clientCAs != nil {
+		next.ClientCAs = clientCAs
+	}
+
+	d.current.Store(next)
+	return nil
+}
+
+// CertReloaderConfig configures a [CertReloader].
+type CertReloaderConfig struct {
+	// TLSConfig is the DynamicTLSConfig the reloader keeps in sync with
+	// whatever certificate authority is currently active.
+	TLSConfig *DynamicTLSConfig
+	// GetCertificate fetches the host certificate and key to serve,
+	// re-issued against the currently active CA. May be nil if the
+	// reloader should leave the server certificate alone.
+	GetCertificate func(ctx context.Context) (*tls.Certificate, error)
+	// GetClientCAs fetches the client CA pool trusted for mTLS. May be nil
+	// if the reloader should leave the client CA pool alone.
+	GetClientCAs func(ctx context.Context) (*x509.CertPool, error)
+	// Events fires once for every certificate authority rotation the
+	// reloader should react to. Nothing in this package subscribes it to a
+	// CertAuthority watcher; the caller supplies and drives it.
+	Events <-chan struct{}
+}
+
+// CheckAndSetDefaults validates that cfg is usable.
+func (cfg *CertReloaderConfig) CheckAndSetDefaults() error {
+	if cfg.TLSConfig == nil {
+		return trace.BadParameter("missing parameter TLSConfig")
+	}
+	if cfg.Events == nil {
+		return trace.BadParameter("missing parameter Events")
+	}
+	if cfg.GetCertificate == nil && cfg.GetClientCAs == nil {
+		return trace.BadParameter("at least one of GetCertificate or GetClientCAs must be set")
+	}
+	return nil
+}
+
+// CertReloader keeps a [DynamicTLSConfig] in sync with the certificate
+// authority backing it, so that a long-running [TLSServer] picks up a
+// rotated CA without being restarted. It reacts to rotation rather than
+// polling: every event on its Events channel triggers a re-fetch of the
+// current server certificate and/or client CA pool.
+type CertReloader struct {
+	cfg CertReloaderConfig
+}
+
+// NewCertReloader creates a CertReloader from cfg.
+func NewCertReloader(cfg CertReloaderConfig) (*CertReloader, error) {
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &CertReloader{cfg: cfg}, nil
+}
+
+// Run blocks, reloading cfg.TLSConfig every time cfg.Events fires, until ctx
+// is canceled or cfg.Events is closed. Callers run it in its own goroutine
+// for the lifetime of the server it backs.
+func (r *CertReloader) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-r.cfg.Events:
+			if !ok {
+				return nil
+			}
+			if err := r.reload(ctx); err != nil {
+				return trace.Wrap(err)
+			}
+		}
+	}
+}
+
+// reload re-fetches the current certificate and/or client CA pool and pushes
+// them into cfg.TLSConfig.
+func (r *CertReloader) reload(ctx context.Context) error {
+	var cert *tls.Certificate
+	var clientCAs *x509.CertPool
+	var err error
+
+	if r.cfg.GetCertificate != nil {
+		cert, err = r.cfg.GetCertificate(ctx)
+		if err != nil {
+			return trace.Wrap(err, "reloading server certificate after certificate authority rotation")
+		}
+	}
+	if r.cfg.GetClientCAs != nil {
+		clientCAs, err = r.cfg.GetClientCAs(ctx)
+		if err != nil {
+			return trace.Wrap(err, "reloading client CA pool after certificate authority rotation")
+		}
+	}
+	return trace.Wrap(r.cfg.TLSConfig.Update(cert, clientCAs))
+}
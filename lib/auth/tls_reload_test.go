@@ -0,0 +1,99 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// selfSignedCert returns a minimal self-signed leaf certificate for cn,
+// usable as a *tls.Certificate.
+func selfSignedCert(t *testing.T, cn string) *tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestCertReloaderReloadsOnEvent(t *testing.T) {
+	initial := selfSignedCert(t, "initial")
+	rotated := selfSignedCert(t, "rotated")
+
+	dynamicTLS := NewDynamicTLSConfig(&tls.Config{Certificates: []tls.Certificate{*initial}})
+	events := make(chan struct{}, 1)
+
+	served := initial
+	reloader, err := NewCertReloader(CertReloaderConfig{
+		TLSConfig: dynamicTLS,
+		GetCertificate: func(ctx context.Context) (*tls.Certificate, error) {
+			return served, nil
+		},
+		Events: events,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- reloader.Run(ctx) }()
+
+	require.Equal(t, initial.Certificate[0], dynamicTLS.current.Load().Certificates[0].Certificate[0])
+
+	served = rotated
+	events <- struct{}{}
+	require.Eventually(t, func() bool {
+		cur := dynamicTLS.current.Load()
+		return len(cur.Certificates) == 1 && string(cur.Certificates[0].Certificate[0]) == string(rotated.Certificate[0])
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestCertReloaderConfigRequiresEventsAndGetter(t *testing.T) {
+	dynamicTLS := NewDynamicTLSConfig(&tls.Config{})
+
+	_, err := NewCertReloader(CertReloaderConfig{TLSConfig: dynamicTLS, Events: make(chan struct{})})
+	require.Error(t, err, "at least one getter must be configured")
+
+	_, err = NewCertReloader(CertReloaderConfig{
+		TLSConfig:      dynamicTLS,
+		GetCertificate: func(ctx context.Context) (*tls.Certificate, error) { return nil, nil },
+	})
+	require.Error(t, err, "missing Events")
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/api/client/proto"
+	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/lib/tlsca"
+)
+
+// trustBundleEntries builds the structured TrustBundle entries for ca's TLS
+// keys, so that agents and tctl can build an x509.CertPool deterministically
+// instead of guessing which entry in the legacy, ordered CACerts is the
+// active signer.
+//
+// During RotationPhaseInit, RotationPhaseUpdateClients, and
+// RotationPhaseUpdateServers, additional trusted keys are a candidate key a
+// rotation is phasing in, so they're reported as ADDITIONAL_TRUSTED. By the
+// time a CA reaches RotationPhaseStandby the rotation has completed and any
+// additional trusted key left over is the previous signer being phased out,
+// so it's reported as RETIRED - callers can drop it from their trust store
+// as soon as they see that role.
+func trustBundleEntries(ca types.CertAuthority, issuerType types.CertAuthType) ([]*proto.DatabaseTrustBundleEntry, error) {
+	additionalRole := proto.DatabaseTrustBundleEntry_ADDITIONAL_TRUSTED
+	if ca.GetRotation().Phase == types.RotationPhaseStandby {
+		additionalRole = proto.DatabaseTrustBundleEntry_RETIRED
+	}
+
+	var entries []*proto.DatabaseTrustBundleEntry
+	for _, keyPair := range ca.GetActiveKeys().TLS {
+		entry, err := newTrustBundleEntry(keyPair.Cert, issuerType, proto.DatabaseTrustBundleEntry_ACTIVE)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		entries = append(entries, entry)
+	}
+	for _, keyPair := range ca.GetAdditionalTrustedKeys().TLS {
+		entry, err := newTrustBundleEntry(keyPair.Cert, issuerType, additionalRole)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func newTrustBundleEntry(certPEM []byte, issuerType types.CertAuthType, role proto.DatabaseTrustBundleEntry_Role) (*proto.DatabaseTrustBundleEntry, error) {
+	cert, err := tlsca.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	keyID := cert.SubjectKeyId
+	if len(keyID) == 0 {
+		sum := sha1.Sum(cert.RawSubjectPublicKeyInfo)
+		keyID = sum[:]
+	}
+
+	return &proto.DatabaseTrustBundleEntry{
+		PEM:        certPEM,
+		KeyID:      hex.EncodeToString(keyID),
+		Role:       role,
+		NotAfter:   cert.NotAfter,
+		IssuerType: string(issuerType),
+	}, nil
+}
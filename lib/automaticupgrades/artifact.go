@@ -0,0 +1,129 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package automaticupgrades
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/gravitational/trace"
+)
+
+// Artifact describes a single platform-specific build of the version served
+// by a channel: where to fetch it, how to verify it, and any operator-facing
+// messaging to surface alongside it.
+type Artifact struct {
+	OS     string `json:"os" yaml:"os"`
+	Arch   string `json:"arch" yaml:"arch"`
+	URL    string `json:"url" yaml:"url"`
+	SHA256 string `json:"sha256" yaml:"sha256"`
+	// Signature, if set, points to a detached signature for the artifact at
+	// URL, separate from the version signature Channel.VerifySignature
+	// checks, since an artifact can be re-packaged (e.g. compressed) after
+	// the version string it implements was signed.
+	Signature string `json:"signature,omitempty" yaml:"signature,omitempty"`
+	// Compressed indicates the artifact at URL is compressed and must be
+	// decompressed before the SHA256 checksum above will match.
+	Compressed bool `json:"compressed,omitempty" yaml:"compressed,omitempty"`
+	// UserMessage is shown to admins alongside the artifact, e.g. release
+	// notes or a warning, without requiring a version bump to change.
+	UserMessage string `json:"user_message,omitempty" yaml:"user_message,omitempty"`
+}
+
+// Manifest is the structured form of a channel's target version: the version
+// string plus every platform artifact published for it.
+type Manifest struct {
+	Version   string     `json:"version"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// artifactGetter resolves the list of artifacts published for a channel's
+// current target version. It mirrors version.Getter: each configured
+// artifact source (static list, remote manifest) implements it the same way
+// each version source implements version.Getter.
+type artifactGetter interface {
+	GetArtifacts(ctx context.Context) ([]Artifact, error)
+}
+
+// staticArtifactGetter serves a fixed, config-provided artifact list.
+type staticArtifactGetter []Artifact
+
+// GetArtifacts implements artifactGetter.
+func (g staticArtifactGetter) GetArtifacts(_ context.Context) ([]Artifact, error) {
+	return g, nil
+}
+
+// httpArtifactGetter fetches a JSON Manifest from a remote URL on every
+// call, for channels that want their artifact metadata to track an upstream
+// release server instead of being copied into static config.
+type httpArtifactGetter struct {
+	manifestURL *url.URL
+}
+
+// newHTTPArtifactGetter builds an artifactGetter that fetches its manifest
+// from manifestURL.
+func newHTTPArtifactGetter(manifestURL *url.URL) *httpArtifactGetter {
+	return &httpArtifactGetter{manifestURL: manifestURL}
+}
+
+// GetArtifacts implements artifactGetter.
+func (g *httpArtifactGetter) GetArtifacts(ctx context.Context) ([]Artifact, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.manifestURL.String(), nil)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, trace.BadParameter("artifact manifest endpoint returned status %d", resp.StatusCode)
+	}
+
+	var manifest Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, trace.Wrap(err, "decoding artifact manifest")
+	}
+
+	return manifest.Artifacts, nil
+}
+
+// GetArtifact returns the artifact published for the given os/arch, or a
+// trace.NotFound error if the channel has no artifact source configured or
+// doesn't publish one for that platform.
+func (c *Channel) GetArtifact(ctx context.Context, os, arch string) (*Artifact, error) {
+	if c.artifactGetter == nil {
+		return nil, trace.NotFound("channel does not publish artifact metadata")
+	}
+
+	artifacts, err := c.artifactGetter.GetArtifacts(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err, "fetching artifact manifest")
+	}
+
+	for _, artifact := range artifacts {
+		if artifact.OS == os && artifact.Arch == arch {
+			return &artifact, nil
+		}
+	}
+
+	return nil, trace.NotFound("no artifact published for os=%s arch=%s", os, arch)
+}
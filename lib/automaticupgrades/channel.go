@@ -16,12 +16,23 @@ package automaticupgrades
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net/http"
 	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/gravitational/trace"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/gravitational/teleport/integrations/kube-agent-updater/pkg/maintenance"
 	"github.com/gravitational/teleport/integrations/kube-agent-updater/pkg/version"
+	"github.com/gravitational/teleport/lib/automaticupgrades/compat"
 )
 
 type Channels map[string]*Channel
@@ -39,17 +50,105 @@ func (c Channels) CheckAndSetDefaults() error {
 }
 
 type Channel struct {
-	ForwardURL      string `yaml:"forward_url,omitempty"`
-	StaticVersion   string `yaml:"static_version,omitempty"`
-	Critical        bool   `yaml:"critical"`
-	versionGetter   version.Getter
-	criticalTrigger maintenance.Trigger
+	ForwardURL    string `yaml:"forward_url,omitempty"`
+	StaticVersion string `yaml:"static_version,omitempty"`
+	VersionEnvVar string `yaml:"version_env_var,omitempty"`
+	VersionFile   string `yaml:"version_file,omitempty"`
+	Critical      bool   `yaml:"critical"`
+
+	// SignaturePublicKey, if set, is a PEM encoded ed25519 public key used to
+	// verify a detached signature over the version string served by this
+	// channel, so operators can pin trust to their own release-signing key
+	// instead of relying on TLS transport trust to an upstream alone.
+	SignaturePublicKey string `yaml:"signature_public_key,omitempty"`
+	// SignatureURL is the URL the detached signature for the served version
+	// is fetched from. Required when SignaturePublicKey is set.
+	SignatureURL string `yaml:"signature_url,omitempty"`
+	// SignatureHeader, if set, names the response header SignatureURL
+	// returns the base64 encoded signature in. If unset, the response body,
+	// with surrounding whitespace trimmed, is read as the base64 encoded
+	// signature.
+	SignatureHeader string `yaml:"signature_header,omitempty"`
+
+	// Artifacts statically declares the per-platform artifacts published for
+	// this channel's target version. Mutually exclusive with ArtifactsURL.
+	Artifacts []Artifact `yaml:"artifacts,omitempty"`
+	// ArtifactsURL, if set, is fetched on every GetArtifact call to resolve
+	// the channel's artifact manifest from a remote release server instead
+	// of a static list. Mutually exclusive with Artifacts.
+	ArtifactsURL string `yaml:"artifacts_url,omitempty"`
+
+	// RetractedVersions lists version ranges this channel must never serve,
+	// e.g. a release that shipped a regression after already going out.
+	RetractedVersions []RetractedRange `yaml:"retracted_versions,omitempty"`
+	// VersionHistory lists every version this channel has served, ordered
+	// oldest to newest, so ResolveVersion can walk back to the newest
+	// non-retracted version when the current target is retracted. Without
+	// it, a retracted target falls straight back to an empty response. This
+	// same list backs GetVersion's release-validation fallback.
+	VersionHistory []string `yaml:"version_history,omitempty"`
+
+	// ReleaseValidation configures how GetVersion confirms a candidate
+	// version's release has actually finished publishing before serving
+	// it, falling back to the newest validated entry in VersionHistory
+	// otherwise. Leave unset to skip validation entirely.
+	ReleaseValidation ReleaseValidationConfig `yaml:"release_validation,omitempty"`
+
+	// UpgradePolicy enforces upgrade-path/version-skew constraints (no
+	// downgrades, capped major jumps, minor-skew window, required
+	// intermediate stops) for agents that report their current version.
+	// See compat.Resolve for how it's applied.
+	UpgradePolicy compat.Policy `yaml:"upgrade_policy,omitempty"`
+
+	// Rollout, if set, stages TargetVersion behind a percentage of agents
+	// instead of serving it (or the channel's usual GetVersion result) to
+	// everyone at once. See Rollout.ResolveVersion.
+	Rollout *Rollout `yaml:"rollout,omitempty"`
+
+	versionGetter    version.Getter
+	criticalTrigger  maintenance.Trigger
+	signaturePubKey  ed25519.PublicKey
+	artifactGetter   artifactGetter
+	releaseValidator ReleaseValidator
+}
+
+// ReleaseValidationConfig selects and configures a Channel's ReleaseValidator.
+type ReleaseValidationConfig struct {
+	// GitHubRepo, if set ("owner/repo"), validates candidate versions
+	// against the GitHub Releases API, requiring a release tagged with the
+	// version that carries an asset named AssetName. Mutually exclusive
+	// with ArtifactURLTemplate.
+	GitHubRepo string `yaml:"github_repo,omitempty"`
+	// AssetName overrides the release asset githubReleaseValidator
+	// requires. Defaults to "metadata.yaml".
+	AssetName string `yaml:"asset_name,omitempty"`
+	// ArtifactURLTemplate, if set, validates candidate versions with an
+	// HTTPS HEAD request against this URL, with the literal "{version}"
+	// substituted for the candidate version. Mutually exclusive with
+	// GitHubRepo.
+	ArtifactURLTemplate string `yaml:"artifact_url_template,omitempty"`
+	// CacheTTL overrides how long a validation result (success or failure)
+	// is cached for. Defaults to 5 minutes.
+	CacheTTL time.Duration `yaml:"cache_ttl,omitempty"`
+}
+
+// enabled reports whether any validation source is configured.
+func (c ReleaseValidationConfig) enabled() bool {
+	return c.GitHubRepo != "" || c.ArtifactURLTemplate != ""
 }
 
 func (c *Channel) CheckAndSetDefaults() error {
+	sourceCount := 0
+	for _, set := range []bool{c.ForwardURL != "", c.StaticVersion != "", c.VersionEnvVar != "", c.VersionFile != ""} {
+		if set {
+			sourceCount++
+		}
+	}
+	if sourceCount > 1 {
+		return trace.BadParameter("Only one of ForwardURL, StaticVersion, VersionEnvVar, or VersionFile may be set")
+	}
+
 	switch {
-	case c.ForwardURL != "" && (c.StaticVersion != "" || c.Critical):
-		return trace.BadParameter("Cannot set both ForwardURL and (StaticVersion or Critical)")
 	case c.ForwardURL != "":
 		baseURL, err := url.Parse(c.ForwardURL)
 		if err != nil {
@@ -60,14 +159,230 @@ func (c *Channel) CheckAndSetDefaults() error {
 	case c.StaticVersion != "":
 		c.versionGetter = version.NewStaticGetter(c.StaticVersion, nil)
 		c.criticalTrigger = maintenance.NewMaintenanceStaticTrigger("remote", c.Critical)
+	case c.VersionEnvVar != "":
+		version, err := readVersionFromEnv(c.VersionEnvVar)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		c.versionGetter = version
+		c.criticalTrigger = maintenance.NewMaintenanceStaticTrigger("env", c.Critical)
+	case c.VersionFile != "":
+		version, err := readVersionFromFile(c.VersionFile)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		c.versionGetter = version
+		c.criticalTrigger = maintenance.NewMaintenanceStaticTrigger("file", c.Critical)
 	default:
-		return trace.BadParameter("Either ForwardURL or StaticVersion must be set")
+		return trace.BadParameter("One of ForwardURL, StaticVersion, VersionEnvVar, or VersionFile must be set")
+	}
+
+	if c.SignaturePublicKey != "" {
+		if c.SignatureURL == "" {
+			return trace.BadParameter("SignatureURL must be set when SignaturePublicKey is set")
+		}
+
+		pubKey, err := parseEd25519PublicKey(c.SignaturePublicKey)
+		if err != nil {
+			return trace.Wrap(err, "parsing SignaturePublicKey")
+		}
+		c.signaturePubKey = pubKey
+	}
+
+	if c.ArtifactsURL != "" && len(c.Artifacts) > 0 {
+		return trace.BadParameter("only one of Artifacts or ArtifactsURL may be set")
+	}
+	switch {
+	case c.ArtifactsURL != "":
+		manifestURL, err := url.Parse(c.ArtifactsURL)
+		if err != nil {
+			return trace.Wrap(err, "parsing ArtifactsURL")
+		}
+		c.artifactGetter = newHTTPArtifactGetter(manifestURL)
+	case len(c.Artifacts) > 0:
+		c.artifactGetter = staticArtifactGetter(c.Artifacts)
+	}
+
+	for _, r := range c.RetractedVersions {
+		if _, err := r.contains(r.Low); err != nil {
+			return trace.Wrap(err, "invalid retracted_versions entry")
+		}
 	}
+	for _, v := range c.VersionHistory {
+		if _, err := version.EnsureSemver(v); err != nil {
+			return trace.Wrap(err, "invalid version_history entry %q", v)
+		}
+	}
+
+	if c.ReleaseValidation.GitHubRepo != "" && c.ReleaseValidation.ArtifactURLTemplate != "" {
+		return trace.BadParameter("only one of ReleaseValidation.GitHubRepo or ArtifactURLTemplate may be set")
+	}
+	var validator ReleaseValidator = noopReleaseValidator{}
+	switch {
+	case c.ReleaseValidation.GitHubRepo != "":
+		validator = &githubReleaseValidator{
+			repo:      c.ReleaseValidation.GitHubRepo,
+			assetName: c.ReleaseValidation.AssetName,
+		}
+	case c.ReleaseValidation.ArtifactURLTemplate != "":
+		validator = &httpHeadReleaseValidator{urlTemplate: c.ReleaseValidation.ArtifactURLTemplate}
+	}
+	if c.ReleaseValidation.enabled() {
+		ttl := c.ReleaseValidation.CacheTTL
+		if ttl <= 0 {
+			ttl = defaultReleaseValidationCacheTTL
+		}
+		validator = &cachingReleaseValidator{inner: validator, ttl: ttl}
+	}
+	c.releaseValidator = validator
+
 	return nil
 }
 
+// parseEd25519PublicKey decodes a PEM encoded ed25519 public key.
+func parseEd25519PublicKey(pemData string) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, trace.BadParameter("no PEM block found in signature public key")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, trace.Wrap(err, "parsing signature public key")
+	}
+
+	key, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, trace.BadParameter("signature public key must be an ed25519 key, got %T", pub)
+	}
+
+	return key, nil
+}
+
+// VerifySignature fetches the detached signature configured via SignatureURL
+// and verifies it against version using SignaturePublicKey. It is a no-op
+// if no SignaturePublicKey is configured for the channel.
+func (c *Channel) VerifySignature(ctx context.Context, version string) error {
+	if c.signaturePubKey == nil {
+		return nil
+	}
+
+	sig, err := c.fetchSignature(ctx)
+	if err != nil {
+		return trace.Wrap(err, "fetching version signature")
+	}
+
+	if !ed25519.Verify(c.signaturePubKey, []byte(version), sig) {
+		return trace.CompareFailed("version signature verification failed")
+	}
+
+	return nil
+}
+
+// fetchSignature retrieves the base64 encoded detached signature for the
+// served version, either from the SignatureHeader response header or, if
+// SignatureHeader is unset, from the raw response body.
+func (c *Channel) fetchSignature(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.SignatureURL, nil)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, trace.NotFound("signature endpoint returned status %d", resp.StatusCode)
+	}
+
+	var encoded string
+	if c.SignatureHeader != "" {
+		encoded = resp.Header.Get(c.SignatureHeader)
+		if encoded == "" {
+			return nil, trace.NotFound("response did not include a %q header", c.SignatureHeader)
+		}
+	} else {
+		raw, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		encoded = strings.TrimSpace(string(raw))
+		if encoded == "" {
+			return nil, trace.NotFound("signature response body was empty")
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	return sig, trace.Wrap(err, "decoding signature")
+}
+
+// readVersionFromEnv resolves a target version from the named environment
+// variable at startup, for deployments that inject the desired version via
+// the container/unit environment rather than a config file or remote URL.
+func readVersionFromEnv(envVar string) (version.Getter, error) {
+	val := strings.TrimSpace(os.Getenv(envVar))
+	if val == "" {
+		return nil, trace.BadParameter("environment variable %q is not set", envVar)
+	}
+	return version.NewStaticGetter(val, nil), nil
+}
+
+// readVersionFromFile resolves a target version from a local file, for
+// air-gapped deployments where the version is dropped onto disk by an
+// external process instead of being served over HTTP.
+func readVersionFromFile(path string) (version.Getter, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	val := strings.TrimSpace(string(raw))
+	if val == "" {
+		return nil, trace.BadParameter("version file %q is empty", path)
+	}
+	return version.NewStaticGetter(val, nil), nil
+}
+
+// GetVersion returns the channel's target version, after confirming (via
+// the configured ReleaseValidation) that its release has actually finished
+// publishing. If the highest candidate fails validation, GetVersion walks
+// VersionHistory backwards for the newest entry that does validate and
+// logs a structured warning about the fallback; if nothing validates, it
+// returns the original validation error.
 func (c *Channel) GetVersion(ctx context.Context) (string, error) {
-	return c.versionGetter.GetVersion(ctx)
+	candidate, err := c.versionGetter.GetVersion(ctx)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	if c.releaseValidator == nil {
+		return candidate, nil
+	}
+
+	validationErr := c.releaseValidator.Validate(ctx, candidate)
+	if validationErr == nil {
+		return candidate, nil
+	}
+
+	for i := len(c.VersionHistory) - 1; i >= 0; i-- {
+		fallback := c.VersionHistory[i]
+		if fallback == candidate {
+			continue
+		}
+		if err := c.releaseValidator.Validate(ctx, fallback); err == nil {
+			log.WithFields(log.Fields{
+				"candidate_version": candidate,
+				"fallback_version":  fallback,
+				"reason":            validationErr.Error(),
+			}).Warn("Candidate version failed release validation; falling back to an earlier validated version.")
+			return fallback, nil
+		}
+	}
+
+	return "", trace.Wrap(validationErr, "version %s failed release validation and no earlier version in VersionHistory validated", candidate)
 }
 
 func (c *Channel) GetCritical(ctx context.Context) (bool, error) {
@@ -0,0 +1,249 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package compat enforces an upgrade-path policy for automatic upgrade
+// channels, mirroring the compatibility/version-skew checking pattern used
+// by cluster upgrade tooling: agents may not downgrade, may not jump more
+// than one major version per step, must stay within a configurable
+// minor-version skew window, and (optionally) must land on the latest
+// patch of their current major before crossing into the next one.
+package compat
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/integrations/kube-agent-updater/pkg/version"
+)
+
+// Policy configures the upgrade-path constraints Resolve enforces.
+type Policy struct {
+	// MaxMajorJump caps how many majors a single step may cross. Defaults
+	// to 1 (e.g. v14 -> v15 is fine, v14 -> v16 is not).
+	MaxMajorJump int `yaml:"max_major_jump,omitempty"`
+	// MaxMinorSkew caps target.Minor - current.Minor within the same
+	// major. 0 (the default) means unlimited.
+	MaxMinorSkew int `yaml:"max_minor_skew,omitempty"`
+	// RequireLatestPatchBeforeMajorJump, when true, blocks a step that
+	// crosses a major-version boundary unless the agent is already on the
+	// latest known patch of its current major.
+	RequireLatestPatchBeforeMajorJump bool `yaml:"require_latest_patch_before_major_jump,omitempty"`
+}
+
+// withDefaults fills in Policy's zero-value defaults.
+func (p Policy) withDefaults() Policy {
+	if p.MaxMajorJump <= 0 {
+		p.MaxMajorJump = 1
+	}
+	return p
+}
+
+// ReasonCode explains why Resolve picked the version it did.
+type ReasonCode string
+
+const (
+	// ReasonOK means the target version (or current version, if already on
+	// target) satisfies the policy outright.
+	ReasonOK ReasonCode = "ok"
+	// ReasonDowngradeBlocked means the target is older than the current
+	// version, so Resolve kept the agent on its current version.
+	ReasonDowngradeBlocked ReasonCode = "downgrade_blocked"
+	// ReasonMajorJumpTooLarge means the target crosses more majors than
+	// Policy.MaxMajorJump allows in one step.
+	ReasonMajorJumpTooLarge ReasonCode = "major_jump_too_large"
+	// ReasonMinorSkewTooLarge means the target's minor version is further
+	// ahead than Policy.MaxMinorSkew allows within the same major.
+	ReasonMinorSkewTooLarge ReasonCode = "minor_skew_too_large"
+	// ReasonIntermediateStopRequired means the target crosses a major
+	// boundary before the agent reached the latest patch of its current
+	// major, as Policy.RequireLatestPatchBeforeMajorJump requires.
+	ReasonIntermediateStopRequired ReasonCode = "intermediate_stop_required"
+	// ReasonRetracted means the channel's target version (and every
+	// earlier candidate) is retracted; callers that also consult
+	// automaticupgrades.Channel.ResolveVersion use this to report that
+	// outcome through the same Decision shape.
+	ReasonRetracted ReasonCode = "retracted"
+)
+
+// Decision is Resolve's verdict: the version an agent should move to next,
+// and why it isn't simply the originally requested target.
+type Decision struct {
+	Version string     `json:"version"`
+	Reason  ReasonCode `json:"reason"`
+	Message string     `json:"message"`
+}
+
+// semver is a parsed major.minor.patch version, kept alongside its
+// original string so Decision and error messages can echo back exactly
+// what the caller passed in.
+type semver struct {
+	raw                string
+	major, minor, patch int
+}
+
+// parse normalizes and decomposes a version string into its major, minor,
+// and patch components.
+func parse(raw string) (semver, error) {
+	normalized, err := version.EnsureSemver(raw)
+	if err != nil {
+		return semver{}, trace.Wrap(err, "invalid version %q", raw)
+	}
+
+	trimmed := strings.TrimPrefix(normalized, "v")
+	if i := strings.IndexAny(trimmed, "-+"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+
+	parts := strings.SplitN(trimmed, ".", 3)
+	if len(parts) != 3 {
+		return semver{}, trace.BadParameter("version %q is not in major.minor.patch form", raw)
+	}
+
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return semver{}, trace.Wrap(err, "parsing major version in %q", raw)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return semver{}, trace.Wrap(err, "parsing minor version in %q", raw)
+	}
+	patch, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return semver{}, trace.Wrap(err, "parsing patch version in %q", raw)
+	}
+
+	return semver{raw: raw, major: major, minor: minor, patch: patch}, nil
+}
+
+// compare returns <0, 0, or >0 as a is older than, equal to, or newer than b.
+func compare(a, b semver) int {
+	if a.major != b.major {
+		return a.major - b.major
+	}
+	if a.minor != b.minor {
+		return a.minor - b.minor
+	}
+	return a.patch - b.patch
+}
+
+// step reports whether moving from cur directly to candidate satisfies
+// policy, given the latest known version sharing cur's major (nil if
+// none is known).
+func step(policy Policy, cur, candidate semver, latestOfCurrentMajor *semver) (bool, ReasonCode) {
+	majorDiff := candidate.major - cur.major
+	switch {
+	case majorDiff < 0:
+		return false, ReasonDowngradeBlocked
+	case majorDiff > policy.MaxMajorJump:
+		return false, ReasonMajorJumpTooLarge
+	case majorDiff == 0:
+		if policy.MaxMinorSkew > 0 && candidate.minor-cur.minor > policy.MaxMinorSkew {
+			return false, ReasonMinorSkewTooLarge
+		}
+		return true, ReasonOK
+	default: // 0 < majorDiff <= policy.MaxMajorJump
+		if policy.RequireLatestPatchBeforeMajorJump && latestOfCurrentMajor != nil && compare(cur, *latestOfCurrentMajor) < 0 {
+			return false, ReasonIntermediateStopRequired
+		}
+		return true, ReasonOK
+	}
+}
+
+// Resolve computes the version an agent on currentVersion should move to
+// next in order to eventually reach target, without violating policy in a
+// single step. history is every version the channel is known to have
+// served (any order, target need not be included). It supplies the latest
+// known patch of currentVersion's major, which
+// Policy.RequireLatestPatchBeforeMajorJump checks against, and the
+// candidates for a safe intermediate stop when jumping straight to target
+// would violate policy.
+func Resolve(policy Policy, currentVersion, target string, history []string) (Decision, error) {
+	policy = policy.withDefaults()
+
+	cur, err := parse(currentVersion)
+	if err != nil {
+		return Decision{}, trace.Wrap(err)
+	}
+	tgt, err := parse(target)
+	if err != nil {
+		return Decision{}, trace.Wrap(err)
+	}
+
+	if cmp := compare(tgt, cur); cmp < 0 {
+		return Decision{
+			Version: currentVersion,
+			Reason:  ReasonDowngradeBlocked,
+			Message: fmt.Sprintf("target version %s is older than current version %s; refusing to downgrade", target, currentVersion),
+		}, nil
+	} else if cmp == 0 {
+		return Decision{Version: currentVersion, Reason: ReasonOK, Message: "already on target version"}, nil
+	}
+
+	candidates := make([]semver, 0, len(history)+1)
+	seen := make(map[string]bool, len(history)+1)
+	for _, raw := range append(append([]string{}, history...), target) {
+		if seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		v, err := parse(raw)
+		if err != nil {
+			// Tolerate unparsable history entries rather than failing the
+			// whole resolution over one bad config value.
+			continue
+		}
+		candidates = append(candidates, v)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return compare(candidates[i], candidates[j]) < 0 })
+
+	var latestOfCurrentMajor *semver
+	for i := range candidates {
+		if candidates[i].major == cur.major {
+			v := candidates[i]
+			latestOfCurrentMajor = &v
+		}
+	}
+
+	if ok, _ := step(policy, cur, tgt, latestOfCurrentMajor); ok {
+		return Decision{Version: target, Reason: ReasonOK, Message: "target version satisfies upgrade policy"}, nil
+	}
+	_, blockedReason := step(policy, cur, tgt, latestOfCurrentMajor)
+
+	for i := len(candidates) - 1; i >= 0; i-- {
+		c := candidates[i]
+		if compare(c, cur) <= 0 {
+			break
+		}
+		if compare(c, tgt) > 0 {
+			continue
+		}
+		if ok, _ := step(policy, cur, c, latestOfCurrentMajor); ok {
+			return Decision{
+				Version: c.raw,
+				Reason:  blockedReason,
+				Message: fmt.Sprintf("target version %s violates upgrade policy (%s); stopping at safe intermediate version %s instead", target, blockedReason, c.raw),
+			}, nil
+		}
+	}
+
+	return Decision{
+		Version: currentVersion,
+		Reason:  blockedReason,
+		Message: fmt.Sprintf("no safe intermediate version found between %s and %s (%s); staying on current version", currentVersion, target, blockedReason),
+	}, nil
+}
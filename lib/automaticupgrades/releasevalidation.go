@@ -0,0 +1,178 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package automaticupgrades
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gravitational/trace"
+)
+
+// ReleaseValidator confirms that a candidate version's release artifacts
+// actually exist and have finished publishing before a channel advertises
+// it, mirroring how clusterctl checks for a metadata.yaml asset in a GitHub
+// release before trusting its tag. Returns a trace.NotFound-style error
+// (checked with trace.IsNotFound by callers) when the release isn't ready.
+type ReleaseValidator interface {
+	Validate(ctx context.Context, targetVersion string) error
+}
+
+// noopReleaseValidator considers every version valid, for channels that
+// don't configure release validation.
+type noopReleaseValidator struct{}
+
+// Validate implements ReleaseValidator.
+func (noopReleaseValidator) Validate(_ context.Context, _ string) error { return nil }
+
+// defaultReleaseAssetName is the asset githubReleaseValidator requires a
+// release to carry, absent an explicit AssetName override.
+const defaultReleaseAssetName = "metadata.yaml"
+
+// githubReleaseValidator validates a version by checking that a GitHub
+// release tagged with it exists and carries the expected asset.
+type githubReleaseValidator struct {
+	// repo is "owner/repo".
+	repo      string
+	assetName string
+}
+
+// Validate implements ReleaseValidator.
+func (v *githubReleaseValidator) Validate(ctx context.Context, targetVersion string) error {
+	tag := targetVersion
+	if !strings.HasPrefix(tag, "v") {
+		tag = "v" + tag
+	}
+
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/releases/tags/%s", v.repo, tag)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return trace.NotFound("no GitHub release found for tag %s", tag)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return trace.BadParameter("GitHub release API returned status %d for tag %s", resp.StatusCode, tag)
+	}
+
+	var release struct {
+		Assets []struct {
+			Name string `json:"name"`
+		} `json:"assets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return trace.Wrap(err, "decoding GitHub release %s", tag)
+	}
+
+	assetName := v.assetName
+	if assetName == "" {
+		assetName = defaultReleaseAssetName
+	}
+	for _, asset := range release.Assets {
+		if asset.Name == assetName {
+			return nil
+		}
+	}
+
+	return trace.NotFound("GitHub release %s does not yet carry the %s asset", tag, assetName)
+}
+
+// releaseVersionPlaceholder is substituted with the candidate version in an
+// httpHeadReleaseValidator's URL template.
+const releaseVersionPlaceholder = "{version}"
+
+// httpHeadReleaseValidator validates a version by issuing an HTTPS HEAD
+// request against a configurable artifact URL template, for release
+// servers that don't have a GitHub Releases API to check against.
+type httpHeadReleaseValidator struct {
+	urlTemplate string
+}
+
+// Validate implements ReleaseValidator.
+func (v *httpHeadReleaseValidator) Validate(ctx context.Context, targetVersion string) error {
+	probeURL := strings.ReplaceAll(v.urlTemplate, releaseVersionPlaceholder, targetVersion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, probeURL, nil)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return trace.NotFound("artifact probe for version %s returned status %d", targetVersion, resp.StatusCode)
+	}
+	return nil
+}
+
+// defaultReleaseValidationCacheTTL is how long a release validation result
+// (success or failure) is cached for, absent a Channel.ReleaseValidation.CacheTTL
+// override, so a broken release doesn't get hammered by every updater
+// checking in during the outage.
+const defaultReleaseValidationCacheTTL = 5 * time.Minute
+
+// cachingReleaseValidator wraps another ReleaseValidator and remembers its
+// result (including failures) for ttl, keyed by version.
+type cachingReleaseValidator struct {
+	inner ReleaseValidator
+	ttl   time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedValidation
+}
+
+type cachedValidation struct {
+	err     error
+	expires time.Time
+}
+
+// Validate implements ReleaseValidator.
+func (c *cachingReleaseValidator) Validate(ctx context.Context, targetVersion string) error {
+	c.mu.Lock()
+	if entry, ok := c.entries[targetVersion]; ok && time.Now().Before(entry.expires) {
+		c.mu.Unlock()
+		return entry.err
+	}
+	c.mu.Unlock()
+
+	err := c.inner.Validate(ctx, targetVersion)
+
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]cachedValidation)
+	}
+	c.entries[targetVersion] = cachedValidation{err: err, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return err
+}
@@ -0,0 +1,125 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package automaticupgrades
+
+import (
+	"context"
+
+	"github.com/gravitational/trace"
+	"golang.org/x/mod/semver"
+
+	"github.com/gravitational/teleport/integrations/kube-agent-updater/pkg/version"
+)
+
+// RetractedRange declares an inclusive range of versions, [Low, High], that
+// a channel must never serve as a target version, and why, mirroring how
+// `go mod` lets a module retract bad releases instead of requiring a
+// strictly-higher one to supersede them.
+type RetractedRange struct {
+	Low    string `yaml:"low" json:"low"`
+	High   string `yaml:"high" json:"high"`
+	Reason string `yaml:"reason" json:"reason"`
+}
+
+// contains reports whether targetVersion falls within [Low, High].
+func (r RetractedRange) contains(targetVersion string) (bool, error) {
+	low, err := version.EnsureSemver(r.Low)
+	if err != nil {
+		return false, trace.Wrap(err, "invalid retracted range low bound %q", r.Low)
+	}
+	high, err := version.EnsureSemver(r.High)
+	if err != nil {
+		return false, trace.Wrap(err, "invalid retracted range high bound %q", r.High)
+	}
+	target, err := version.EnsureSemver(targetVersion)
+	if err != nil {
+		return false, trace.Wrap(err, "invalid version %q", targetVersion)
+	}
+
+	return semver.Compare(target, low) >= 0 && semver.Compare(target, high) <= 0, nil
+}
+
+// matchRetraction returns the first range in ranges that targetVersion
+// falls within, or nil if none match.
+func matchRetraction(ranges []RetractedRange, targetVersion string) (*RetractedRange, error) {
+	for i, r := range ranges {
+		hit, err := r.contains(targetVersion)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		if hit {
+			return &ranges[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Retracted returns the channel's configured retracted version ranges.
+func (c *Channel) Retracted(ctx context.Context) ([]RetractedRange, error) {
+	return c.RetractedVersions, nil
+}
+
+// ResolveVersion checks targetVersion (as returned by GetVersion) against
+// the channel's retracted ranges. If it isn't retracted, it's returned
+// unchanged. If it is, ResolveVersion walks VersionHistory backwards,
+// newest to oldest, for the highest version <= targetVersion that isn't
+// itself retracted, and returns that instead. If every candidate <=
+// targetVersion is retracted (or VersionHistory is empty), it returns ""
+// so the caller can serve an empty response rather than ever knowingly
+// hand out a bad release. The matched RetractedRange is always returned
+// alongside the resolved version so a caller can explain why a fallback
+// happened.
+func (c *Channel) ResolveVersion(ctx context.Context, targetVersion string) (resolved string, retraction *RetractedRange, err error) {
+	ranges, err := c.Retracted(ctx)
+	if err != nil {
+		return "", nil, trace.Wrap(err)
+	}
+
+	match, err := matchRetraction(ranges, targetVersion)
+	if err != nil {
+		return "", nil, trace.Wrap(err)
+	}
+	if match == nil {
+		return targetVersion, nil, nil
+	}
+
+	target, err := version.EnsureSemver(targetVersion)
+	if err != nil {
+		return "", nil, trace.Wrap(err, "invalid version %q", targetVersion)
+	}
+
+	for i := len(c.VersionHistory) - 1; i >= 0; i-- {
+		candidate := c.VersionHistory[i]
+
+		candidateSemver, err := version.EnsureSemver(candidate)
+		if err != nil {
+			return "", nil, trace.Wrap(err, "invalid entry in VersionHistory: %q", candidate)
+		}
+		if semver.Compare(candidateSemver, target) > 0 {
+			// Only consider history at or below the retracted target.
+			continue
+		}
+
+		candidateMatch, err := matchRetraction(ranges, candidate)
+		if err != nil {
+			return "", nil, trace.Wrap(err)
+		}
+		if candidateMatch == nil {
+			return candidate, match, nil
+		}
+	}
+
+	return "", match, nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package automaticupgrades
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// Step is one stage of a Rollout's StepSchedule: at Delta after the
+// rollout's StartedAt, the rollout ratchets up to (at least) Percentage.
+type Step struct {
+	Delta      time.Duration `yaml:"delta"`
+	Percentage int           `yaml:"percentage"`
+}
+
+// Rollout stages a version change behind a percentage of agents, bucketed
+// stably by agent ID, so a bad release only affects a fraction of a fleet
+// instead of all of it at once.
+type Rollout struct {
+	// ID identifies this rollout for bucket hashing. Defaults to
+	// "<PreviousVersion>-><TargetVersion>" if unset; only needs setting
+	// explicitly if a channel runs back-to-back rollouts between the same
+	// two versions and wants a fresh bucket assignment for the second one.
+	ID string `yaml:"id,omitempty"`
+	// PreviousVersion is served to agents outside the rollout's current
+	// percentage.
+	PreviousVersion string `yaml:"previous_version"`
+	// TargetVersion is served to agents inside the rollout's current
+	// percentage.
+	TargetVersion string `yaml:"target_version"`
+	// Percentage is the rollout's base stage, 0-100. Acts as a floor: when
+	// StepSchedule is set, the effective percentage is the highest stage
+	// reached by either this value or an elapsed schedule step.
+	Percentage int `yaml:"percentage"`
+	// StartedAt anchors StepSchedule's deltas.
+	StartedAt time.Time `yaml:"started_at"`
+	// StepSchedule ratchets Percentage upward over time, e.g.
+	// 1%->10%->50%->100% at configured offsets from StartedAt.
+	StepSchedule []Step `yaml:"step_schedule,omitempty"`
+	// AdminToken is a shared secret an operator must present (in the
+	// Teleport-Rollout-Admin-Token header) to pause, resume, or roll back
+	// this rollout through the webapi rollout route - that route has no
+	// session of its own to check a role against, so, like the SCEP
+	// provisioner's challenge password, a shared secret is the trust
+	// boundary. A rollout with no AdminToken configured cannot be
+	// controlled over the network at all; its percentage can still only be
+	// changed by editing the channel config.
+	AdminToken string `yaml:"admin_token,omitempty"`
+
+	mu               sync.RWMutex
+	paused           bool
+	frozenPercentage int
+	rolledBack       bool
+}
+
+// id returns the identifier used to hash agents into buckets.
+func (r *Rollout) id() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	return r.PreviousVersion + "->" + r.TargetVersion
+}
+
+// Bucket deterministically places agentID into a stable 0-99 bucket for
+// this rollout. The same agent ID always lands in the same bucket for a
+// given rollout, across proxy restarts and across every proxy in a
+// cluster, since it depends only on the rollout's own identity and the
+// agent ID, not on any in-memory state.
+func (r *Rollout) Bucket(agentID string) int {
+	sum := sha256.Sum256([]byte(r.id() + "|" + agentID))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// scheduledPercentageLocked computes the rollout's stage at now, before
+// the pause/rollback overrides in CurrentPercentage are applied. Callers
+// must hold r.mu.
+func (r *Rollout) scheduledPercentageLocked(now time.Time) int {
+	pct := r.Percentage
+	for _, step := range r.StepSchedule {
+		if now.Sub(r.StartedAt) >= step.Delta && step.Percentage > pct {
+			pct = step.Percentage
+		}
+	}
+	switch {
+	case pct > 100:
+		return 100
+	case pct < 0:
+		return 0
+	default:
+		return pct
+	}
+}
+
+// CurrentPercentage returns the rollout's effective percentage right now:
+// 0 if it's been rolled back, 100 if critical is true (a critical release
+// always goes out to everyone immediately), the percentage frozen at the
+// last Pause() if paused, or otherwise the highest stage reached by
+// Percentage or an elapsed StepSchedule step.
+func (r *Rollout) CurrentPercentage(critical bool) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	switch {
+	case r.rolledBack:
+		return 0
+	case critical:
+		return 100
+	case r.paused:
+		return r.frozenPercentage
+	default:
+		return r.scheduledPercentageLocked(time.Now())
+	}
+}
+
+// ResolveVersion returns TargetVersion if agentID's bucket falls within
+// the rollout's current percentage, otherwise PreviousVersion.
+func (r *Rollout) ResolveVersion(agentID string, critical bool) string {
+	if r.Bucket(agentID) < r.CurrentPercentage(critical) {
+		return r.TargetVersion
+	}
+	return r.PreviousVersion
+}
+
+// AuthorizeAdmin reports whether token authorizes a control action (pause,
+// resume, rollback) against this rollout. It's deliberately constant-time
+// and deliberately fails closed: a rollout with no AdminToken configured
+// authorizes nothing, rather than accepting an empty token as a match.
+func (r *Rollout) AuthorizeAdmin(token string) bool {
+	if r.AdminToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(r.AdminToken)) == 1
+}
+
+// Pause freezes the rollout at its current percentage, so it stops
+// ratcheting up through StepSchedule until Resume is called.
+func (r *Rollout) Pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused {
+		return
+	}
+	r.paused = true
+	r.frozenPercentage = r.scheduledPercentageLocked(time.Now())
+}
+
+// Resume lets a paused rollout continue ratcheting up through
+// StepSchedule. A no-op if the rollout isn't paused.
+func (r *Rollout) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = false
+}
+
+// RollBack pins the rollout to 0% for good: every agent gets
+// PreviousVersion until the channel config itself is changed. There is no
+// corresponding "un-rollback"; starting the rollout over requires a fresh
+// Rollout (typically with a new ID, so agents get reshuffled into buckets
+// rather than reusing their prior assignment for a different release).
+func (r *Rollout) RollBack() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rolledBack = true
+}
+
+// Paused reports whether the rollout is currently paused.
+func (r *Rollout) Paused() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.paused
+}
+
+// RolledBack reports whether the rollout has been rolled back.
+func (r *Rollout) RolledBack() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.rolledBack
+}
+
+// RolloutStatus is the JSON form of a Rollout's current state, served by
+// the admin rollout endpoint.
+type RolloutStatus struct {
+	Percentage int  `json:"percentage"`
+	Paused     bool `json:"paused"`
+	RolledBack bool `json:"rolled_back"`
+}
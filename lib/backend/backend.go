@@ -0,0 +1,58 @@
+// Copyright 2016 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package backend provides the storage abstraction used by the auth server
+// to persist cluster state.
+package backend
+
+import "time"
+
+// Forever means that the object's associated value will not expire unless
+// explicitly deleted.
+const Forever time.Duration = 0
+
+// Backend implements abstraction over local or remote storage backend
+type Backend interface {
+	// GetKeys returns a list of keys for a given path
+	GetKeys(path []string) ([]string, error)
+
+	// CreateVal creates value with a given TTL and key in the bucket
+	// if the value already exists, returns AlreadyExistsError
+	CreateVal(path []string, key string, val []byte, ttl time.Duration) error
+
+	// UpsertVal updates or inserts value with a given TTL into a bucket
+	UpsertVal(path []string, key string, val []byte, ttl time.Duration) error
+
+	// CompareAndSwapVal updates the value at key to newVal, with the given
+	// ttl, only if its current value equals expected. It returns a
+	// CompareFailed error if the key does not exist or does not match
+	// expected.
+	CompareAndSwapVal(path []string, key string, newVal, expected []byte, ttl time.Duration) error
+
+	// GetVal returns a value for a given key in the bucket
+	GetVal(path []string, key string) ([]byte, error)
+
+	// DeleteKey deletes a key in a bucket
+	DeleteKey(path []string, key string) error
+
+	// DeleteBucket deletes the bucket by a given path
+	DeleteBucket(path []string, bucket string) error
+
+	// AcquireLock grabs a lock that will be released automatically
+	// in ttl time
+	AcquireLock(token string, ttl time.Duration) error
+
+	// ReleaseLock forces lock release before TTL
+	ReleaseLock(token string) error
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/gravitational/trace"
+)
+
+// compressionThreshold is the minimum value size, in bytes, before a value
+// is transparently gzip-compressed on disk. Small values are left alone
+// since the gzip header/footer overhead outweighs any space savings.
+const compressionThreshold = 1024
+
+// encodingRaw and encodingGzip are one-byte prefixes written ahead of every
+// stored value so that readVal can tell whether it needs to decompress the
+// remainder of the file before returning it to the caller.
+const (
+	encodingRaw  byte = 0
+	encodingGzip byte = 1
+)
+
+// encodeVal prefixes val with an encoding marker, gzip-compressing it first
+// if it is at least compressionThreshold bytes long.
+func encodeVal(val []byte) ([]byte, error) {
+	if len(val) < compressionThreshold {
+		return append([]byte{encodingRaw}, val...), nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(encodingGzip)
+
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(val); err != nil {
+		return nil, trace.Wrap(err, "compressing value")
+	}
+	if err := gz.Close(); err != nil {
+		return nil, trace.Wrap(err, "compressing value")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeVal reverses encodeVal, transparently decompressing the value if it
+// was stored gzip-compressed.
+func decodeVal(stored []byte) ([]byte, error) {
+	if len(stored) == 0 {
+		return nil, nil
+	}
+
+	switch stored[0] {
+	case encodingRaw:
+		return stored[1:], nil
+	case encodingGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(stored[1:]))
+		if err != nil {
+			return nil, trace.Wrap(err, "decompressing value")
+		}
+		defer gz.Close()
+
+		val, err := io.ReadAll(gz)
+		if err != nil {
+			return nil, trace.Wrap(err, "decompressing value")
+		}
+		return val, nil
+	default:
+		return nil, trace.BadParameter("unknown value encoding %d", stored[0])
+	}
+}
@@ -0,0 +1,309 @@
+// Copyright 2016 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fs implements a [backend.Backend] that stores values as files on
+// the local filesystem, with buckets mapped to directories.
+package fs
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/backend"
+)
+
+// ttlSuffix is appended to a key's filename to store the companion file
+// holding its expiry time, when one was set.
+const ttlSuffix = ".ttl"
+
+// Clock is the subset of clock behavior the fs backend depends on. It is
+// satisfied by [realClock] in production and may be swapped out in tests to
+// control time deterministically.
+type Clock interface {
+	UtcNow() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) UtcNow() time.Time                      { return time.Now().UTC() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Config is the JSON configuration accepted by [FromJSON].
+type Config struct {
+	// Path is the root directory values are stored under.
+	Path string `json:"path"`
+}
+
+// Backend is a [backend.Backend] implementation that persists values as
+// files under RootDir.
+type Backend struct {
+	// RootDir is the directory all buckets and keys are stored under.
+	RootDir string
+	// Clock is used to read the current time and to back off while waiting
+	// on locks. Defaults to the real system clock.
+	Clock Clock
+
+	locksMu sync.Mutex
+	locks   map[string]time.Time
+
+	// casMu serializes CompareAndSwapVal calls.
+	casMu sync.Mutex
+}
+
+// FromJSON creates a new [Backend] from a JSON encoded [Config], e.g.
+// `{"path": "/var/lib/teleport/storage"}`.
+func FromJSON(params string) (*Backend, error) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(params), &cfg); err != nil {
+		return nil, trace.Wrap(err, "parsing fs backend config")
+	}
+
+	if cfg.Path == "" {
+		return nil, trace.BadParameter("path is not set in fs backend config")
+	}
+
+	if err := os.MkdirAll(cfg.Path, 0o700); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	return &Backend{
+		RootDir: cfg.Path,
+		Clock:   realClock{},
+		locks:   make(map[string]time.Time),
+	}, nil
+}
+
+var _ backend.Backend = (*Backend)(nil)
+
+func (b *Backend) bucketDir(path []string) string {
+	parts := append([]string{b.RootDir}, path...)
+	return filepath.Join(parts...)
+}
+
+func (b *Backend) keyPath(path []string, key string) string {
+	return filepath.Join(b.bucketDir(path), key)
+}
+
+// GetKeys returns the sorted list of keys stored directly under path. It
+// returns an empty list, not an error, if the bucket does not exist.
+func (b *Backend) GetKeys(path []string) ([]string, error) {
+	dir := b.bucketDir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	var keys []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) == ttlSuffix {
+			continue
+		}
+		keys = append(keys, name)
+	}
+
+	return keys, nil
+}
+
+// CreateVal creates key with val and ttl in the bucket at path. It returns
+// an AlreadyExists error if the key is already present and unexpired.
+func (b *Backend) CreateVal(path []string, key string, val []byte, ttl time.Duration) error {
+	if _, err := b.readVal(path, key); err == nil {
+		return trace.AlreadyExists("key %q already exists", key)
+	}
+
+	return b.writeVal(path, key, val, ttl)
+}
+
+// UpsertVal creates or overwrites key with val and ttl in the bucket at path.
+func (b *Backend) UpsertVal(path []string, key string, val []byte, ttl time.Duration) error {
+	return b.writeVal(path, key, val, ttl)
+}
+
+func (b *Backend) writeVal(path []string, key string, val []byte, ttl time.Duration) error {
+	dir := b.bucketDir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	encoded, err := encodeVal(val)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, key), encoded, 0o600); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	ttlPath := filepath.Join(dir, key+ttlSuffix)
+	if ttl <= backend.Forever {
+		_ = os.Remove(ttlPath)
+		return nil
+	}
+
+	expiry := b.clock().UtcNow().Add(ttl)
+	if err := os.WriteFile(ttlPath, []byte(expiry.Format(time.RFC3339Nano)), 0o600); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	return nil
+}
+
+// GetVal returns the value stored at key in the bucket at path, or a
+// NotFound error if it does not exist or has expired.
+func (b *Backend) GetVal(path []string, key string) ([]byte, error) {
+	return b.readVal(path, key)
+}
+
+// CompareAndSwapVal updates key to newVal, with the given ttl, only if its
+// current value is equal to expected. It returns a CompareFailed error if
+// the key does not exist or its current value does not match expected.
+//
+// casMu is held across the read and write below, so concurrent
+// CompareAndSwapVal calls on the same Backend cannot both succeed against
+// the same expected value. Writes made through CreateVal or UpsertVal, or by
+// another process sharing RootDir, are not excluded; teleport's auth server
+// only ever uses the fs backend as a single-process store, so this matches
+// its other locking primitives.
+func (b *Backend) CompareAndSwapVal(path []string, key string, newVal, expected []byte, ttl time.Duration) error {
+	b.casMu.Lock()
+	defer b.casMu.Unlock()
+
+	current, err := b.readVal(path, key)
+	if err != nil {
+		if trace.IsNotFound(err) {
+			return trace.CompareFailed("key %q does not exist", key)
+		}
+		return trace.Wrap(err)
+	}
+
+	if !bytes.Equal(current, expected) {
+		return trace.CompareFailed("current value of key %q does not match expected", key)
+	}
+
+	return b.writeVal(path, key, newVal, ttl)
+}
+
+func (b *Backend) readVal(path []string, key string) ([]byte, error) {
+	dir := b.bucketDir(path)
+	keyPath := filepath.Join(dir, key)
+
+	val, err := os.ReadFile(keyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, trace.NotFound("key '%v' is not found", key)
+		}
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	ttlPath := filepath.Join(dir, key+ttlSuffix)
+	if raw, err := os.ReadFile(ttlPath); err == nil {
+		expiry, err := time.Parse(time.RFC3339Nano, string(raw))
+		if err == nil && !b.clock().UtcNow().Before(expiry) {
+			_ = os.Remove(keyPath)
+			_ = os.Remove(ttlPath)
+			return nil, trace.NotFound("key '%v' is not found", key)
+		}
+	}
+
+	decoded, err := decodeVal(val)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return decoded, nil
+}
+
+// DeleteKey deletes key from the bucket at path.
+func (b *Backend) DeleteKey(path []string, key string) error {
+	keyPath := b.keyPath(path, key)
+	if err := os.Remove(keyPath); err != nil {
+		if os.IsNotExist(err) {
+			return trace.NotFound("key %q is not found", key)
+		}
+		return trace.ConvertSystemError(err)
+	}
+
+	_ = os.Remove(keyPath + ttlSuffix)
+	return nil
+}
+
+// DeleteBucket deletes the bucket named bucket under path, along with all
+// the keys it contains.
+func (b *Backend) DeleteBucket(path []string, bucket string) error {
+	dir := filepath.Join(b.bucketDir(path), bucket)
+	if err := os.RemoveAll(dir); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return nil
+}
+
+const lockRetryInterval = 250 * time.Millisecond
+
+// AcquireLock blocks until it obtains an exclusive lock identified by token,
+// which is automatically released after ttl elapses. Locks are held in this
+// Backend's memory only, so they do not exclude other processes or other
+// Backend values sharing RootDir.
+func (b *Backend) AcquireLock(token string, ttl time.Duration) error {
+	for {
+		now := b.clock().UtcNow()
+
+		b.locksMu.Lock()
+		expiry, locked := b.locks[token]
+		if !locked || !now.Before(expiry) {
+			newExpiry := now.Add(ttl)
+			if ttl <= backend.Forever {
+				newExpiry = now.Add(24 * time.Hour)
+			}
+			b.locks[token] = newExpiry
+			b.locksMu.Unlock()
+			return nil
+		}
+		b.locksMu.Unlock()
+
+		b.clock().Sleep(lockRetryInterval)
+	}
+}
+
+// ReleaseLock releases the lock identified by token before its TTL expires.
+func (b *Backend) ReleaseLock(token string) error {
+	b.locksMu.Lock()
+	defer b.locksMu.Unlock()
+
+	if _, locked := b.locks[token]; !locked {
+		return trace.NotFound("lock %q is not held", token)
+	}
+
+	delete(b.locks, token)
+	return nil
+}
+
+func (b *Backend) clock() Clock {
+	if b.Clock == nil {
+		return realClock{}
+	}
+	return b.Clock
+}
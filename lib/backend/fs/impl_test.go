@@ -1,7 +1,11 @@
 package fs
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -99,6 +103,85 @@ func (s *Suite) TestCreateAndRead(c *check.C) {
 	c.Assert(trace.IsNotFound(err), check.Equals, true)
 }
 
+func (s *Suite) TestCompareAndSwap(c *check.C) {
+	bucket := []string{"cas"}
+
+	err := s.bk.CreateVal(bucket, "key", []byte("v1"), backend.Forever)
+	c.Assert(err, check.IsNil)
+
+	// mismatched expected value must fail and leave the value unchanged:
+	err = s.bk.CompareAndSwapVal(bucket, "key", []byte("v2"), []byte("not-v1"), backend.Forever)
+	c.Assert(trace.IsCompareFailed(err), check.Equals, true)
+
+	val, err := s.bk.GetVal(bucket, "key")
+	c.Assert(err, check.IsNil)
+	c.Assert(string(val), check.Equals, "v1")
+
+	// matching expected value must succeed:
+	err = s.bk.CompareAndSwapVal(bucket, "key", []byte("v2"), []byte("v1"), backend.Forever)
+	c.Assert(err, check.IsNil)
+
+	val, err = s.bk.GetVal(bucket, "key")
+	c.Assert(err, check.IsNil)
+	c.Assert(string(val), check.Equals, "v2")
+
+	// swapping a non-existing key must fail:
+	err = s.bk.CompareAndSwapVal(bucket, "missing", []byte("v2"), []byte("v1"), backend.Forever)
+	c.Assert(trace.IsCompareFailed(err), check.Equals, true)
+}
+
+func (s *Suite) TestLargeValueCompression(c *check.C) {
+	bucket := []string{"large"}
+
+	large := bytes.Repeat([]byte("teleport-compression-test"), 1000)
+
+	err := s.bk.CreateVal(bucket, "key", large, backend.Forever)
+	c.Assert(err, check.IsNil)
+
+	// the on-disk file should be meaningfully smaller than the original
+	// value since it compresses well:
+	encoded, err := os.ReadFile(filepath.Join(s.bk.(*Backend).RootDir, "large", "key"))
+	c.Assert(err, check.IsNil)
+	c.Assert(len(encoded) < len(large), check.Equals, true)
+
+	val, err := s.bk.GetVal(bucket, "key")
+	c.Assert(err, check.IsNil)
+	c.Assert(bytes.Equal(val, large), check.Equals, true)
+}
+
+func (s *Suite) TestWatcher(c *check.C) {
+	bucket := []string{"watched"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w, err := s.bk.(*Backend).NewWatcher(ctx, bucket)
+	c.Assert(err, check.IsNil)
+	defer w.Close()
+
+	err = s.bk.CreateVal(bucket, "key", []byte("v1"), backend.Forever)
+	c.Assert(err, check.IsNil)
+
+	select {
+	case e := <-w.Events():
+		c.Assert(e.Type, check.Equals, EventTypePut)
+		c.Assert(e.Key, check.Equals, "key")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for put event")
+	}
+
+	err = s.bk.DeleteKey(bucket, "key")
+	c.Assert(err, check.IsNil)
+
+	select {
+	case e := <-w.Events():
+		c.Assert(e.Type, check.Equals, EventTypeDelete)
+		c.Assert(e.Key, check.Equals, "key")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for delete event")
+	}
+}
+
 func (s *Suite) TestListDelete(c *check.C) {
 	root := []string{"root"}
 	kid := []string{"root", "kid"}
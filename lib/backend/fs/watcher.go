@@ -0,0 +1,156 @@
+// Copyright 2016 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// watchPollInterval is how often a [Watcher] re-reads the bucket directory
+// looking for changes. The fs backend has no access to OS-level filesystem
+// notifications across all supported platforms, so polling is used instead.
+const watchPollInterval = 500 * time.Millisecond
+
+// EventType identifies the kind of change a [Watcher] observed.
+type EventType int
+
+const (
+	// EventTypePut is emitted when a key is created or its value changes.
+	EventTypePut EventType = iota
+	// EventTypeDelete is emitted when a key is removed, including via
+	// expiry.
+	EventTypeDelete
+)
+
+// Event describes a single change observed by a [Watcher].
+type Event struct {
+	// Type is the kind of change that occurred.
+	Type EventType
+	// Key is the name of the key that changed.
+	Key string
+}
+
+// Watcher streams change events for a single bucket in a [Backend].
+type Watcher struct {
+	eventsC chan Event
+	done    chan struct{}
+}
+
+// Events returns the channel change events are delivered on. It is closed
+// when the [Watcher] is closed or its context is canceled.
+func (w *Watcher) Events() <-chan Event {
+	return w.eventsC
+}
+
+// Close stops the watcher and releases its resources.
+func (w *Watcher) Close() error {
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+	return nil
+}
+
+// NewWatcher returns a [Watcher] that emits an [Event] whenever a key is
+// created, updated, or deleted (including via TTL expiry) in the bucket at
+// path. The watcher stops, closing its Events channel, when ctx is canceled
+// or Close is called.
+func (b *Backend) NewWatcher(ctx context.Context, path []string) (*Watcher, error) {
+	w := &Watcher{
+		eventsC: make(chan Event),
+		done:    make(chan struct{}),
+	}
+
+	go b.watchLoop(ctx, path, w)
+
+	return w, nil
+}
+
+func (b *Backend) watchLoop(ctx context.Context, path []string, w *Watcher) {
+	defer close(w.eventsC)
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	prev := b.snapshot(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.done:
+			return
+		case <-ticker.C:
+			next := b.snapshot(path)
+
+			for key, modTime := range next {
+				if old, ok := prev[key]; !ok || !old.Equal(modTime) {
+					if !b.deliver(ctx, w, Event{Type: EventTypePut, Key: key}) {
+						return
+					}
+				}
+			}
+
+			for key := range prev {
+				if _, ok := next[key]; !ok {
+					if !b.deliver(ctx, w, Event{Type: EventTypeDelete, Key: key}) {
+						return
+					}
+				}
+			}
+
+			prev = next
+		}
+	}
+}
+
+func (b *Backend) deliver(ctx context.Context, w *Watcher, e Event) bool {
+	select {
+	case w.eventsC <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-w.done:
+		return false
+	}
+}
+
+// snapshot returns the modification time of every live key in the bucket at
+// path, used by watchLoop to detect changes between polls.
+func (b *Backend) snapshot(path []string) map[string]time.Time {
+	keys, err := b.GetKeys(path)
+	if err != nil {
+		return nil
+	}
+
+	snap := make(map[string]time.Time, len(keys))
+	for _, key := range keys {
+		// readVal removes a key whose TTL has elapsed and reports it as not
+		// found, so an expired key drops out of the snapshot.
+		if _, err := b.readVal(path, key); err != nil {
+			continue
+		}
+		info, err := os.Stat(b.keyPath(path, key))
+		if err != nil {
+			continue
+		}
+		snap[key] = info.ModTime()
+	}
+
+	return snap
+}
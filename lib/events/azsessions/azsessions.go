@@ -20,18 +20,26 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/url"
+	"os"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/streaming"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azkeys"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/lease"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 	"github.com/google/uuid"
 	"github.com/gravitational/trace"
 	"github.com/sirupsen/logrus"
@@ -49,8 +57,80 @@ const (
 
 	// clientIDFragParam is the parameter in the fragment that specifies the optional client ID.
 	clientIDFragParam = "azure_client_id"
+	// authModeFragParam selects the credential chain used to authenticate,
+	// see AuthMode.
+	authModeFragParam = "azure_auth_mode"
+	// tenantIDFragParam is the Azure AD tenant used by the workload identity
+	// and service principal auth modes.
+	tenantIDFragParam = "azure_tenant_id"
+	// clientSecretPathFragParam points at a file holding the service
+	// principal's client secret, for the service principal auth mode.
+	clientSecretPathFragParam = "azure_client_secret_path"
+	// certificatePathFragParam points at a PEM file holding the service
+	// principal's client certificate and key, for the service principal auth
+	// mode, as an alternative to clientSecretPathFragParam.
+	certificatePathFragParam = "azure_certificate_path"
+	// federatedTokenFileFragParam points at the projected federated token
+	// file used by the workload identity auth mode.
+	federatedTokenFileFragParam = "azure_federated_token_file"
+	// cloudFragParam selects the Azure cloud the storage account and AAD
+	// tenant live in, see Cloud.
+	cloudFragParam = "azure_cloud"
+	// encryptionFragParam selects the client-side encryption mode, see
+	// EncryptionMode.
+	encryptionFragParam = "azure_encryption"
+	// keyVaultURLFragParam is the URL of the Key Vault holding the key used
+	// to wrap the session encryption keys, required by EncryptionAKVEnvelope.
+	keyVaultURLFragParam = "azure_key_vault_url"
+	// keyNameFragParam is the name of the Key Vault key used to wrap the
+	// session encryption keys, required by EncryptionAKVEnvelope.
+	keyNameFragParam = "azure_key_name"
+	// keyVersionFragParam optionally pins the Key Vault key version used to
+	// wrap new session encryption keys; if unset, the latest version is used.
+	keyVersionFragParam = "azure_key_version"
 )
 
+// Cloud selects the Azure cloud (public or sovereign) that the storage
+// account and Azure AD tenant live in. This affects the AAD authority used
+// for authentication, the token scope used to authorize blob operations,
+// and the expected suffix of ServiceURL's host.
+type Cloud string
+
+const (
+	// AzurePublic is the commercial, worldwide Azure cloud. It's the default
+	// when Cloud is unset.
+	AzurePublic Cloud = "AzurePublic"
+	// AzureChina is the Azure China cloud, operated by 21Vianet.
+	AzureChina Cloud = "AzureChina"
+	// AzureGovernment is the Azure US Government cloud.
+	AzureGovernment Cloud = "AzureGovernment"
+)
+
+// storageHostSuffixes maps each supported Cloud to the hostname suffix its
+// blob storage endpoints use, so ServiceURL can be validated against Cloud.
+var storageHostSuffixes = map[Cloud]string{
+	AzurePublic:     "core.windows.net",
+	AzureChina:      "core.chinacloudapi.cn",
+	AzureGovernment: "core.usgovcloudapi.net",
+}
+
+// cloudConfigurations maps each supported Cloud to the azcore cloud
+// configuration that points credentials at the right AAD authority.
+var cloudConfigurations = map[Cloud]cloud.Configuration{
+	AzurePublic:     cloud.AzurePublic,
+	AzureChina:      cloud.AzureChina,
+	AzureGovernment: cloud.AzureGovernment,
+}
+
+// storageScopes maps each supported Cloud to the OAuth scope that
+// authorizes blob data plane operations (e.g. Put Block From URL), which
+// isn't the same top-level domain as the storage suffix in every cloud.
+var storageScopes = map[Cloud]string{
+	AzurePublic:     "https://storage.azure.com/.default",
+	AzureChina:      "https://storage.azure.cn/.default",
+	AzureGovernment: "https://storage.azure.us/.default",
+}
+
 // sessionName returns the name of the blob that contains the recording for a
 // given session.
 func sessionName(sid session.ID) string {
@@ -86,15 +166,118 @@ const (
 	fieldPartCount  = "parts"
 )
 
+// blob index tag names, set with Set Blob Tags (or at write time) so that
+// FindSessions and the upload marker cleanup can be answered with Find Blobs
+// by Tags instead of listing (and parsing) every blob in the container.
+const (
+	tagSessionID     = "session_id"
+	tagInitiatedUnix = "initiated_unix"
+	tagEndTimeUnix   = "end_time_unix"
+)
+
+// sessionBlobTags returns the index tags written on a completed session
+// recording blob.
+//
+// TODO(espadolini): also tag cluster, user, resource and kind once
+// events.UploadMetadata/StreamUpload carry that information through to the
+// handler; today Upload/CompleteUpload only ever see a session.ID.
+func sessionBlobTags(sessionID session.ID) map[string]string {
+	return map[string]string{
+		tagSessionID:   sessionID.String(),
+		tagEndTimeUnix: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+}
+
+// markerBlobTags returns the index tags written on an upload marker blob,
+// letting stale uploads be found by initiation age without listing (and
+// stat-ing) every marker blob in the inprogress container.
+func markerBlobTags(sessionID session.ID) map[string]string {
+	return map[string]string{
+		tagSessionID:     sessionID.String(),
+		tagInitiatedUnix: strconv.FormatInt(time.Now().Unix(), 10),
+	}
+}
+
+// AuthMode selects which Azure credential (or chain of credentials)
+// NewHandler authenticates to the storage account with.
+type AuthMode string
+
+const (
+	// AuthModeDefault authenticates with NewDefaultAzureCredential, trying
+	// the credential types azidentity considers standard, in order.
+	AuthModeDefault AuthMode = "default"
+	// AuthModeManagedIdentity authenticates as the managed identity named by
+	// ClientID, or the system-assigned identity if ClientID is unset.
+	AuthModeManagedIdentity AuthMode = "msi"
+	// AuthModeWorkloadIdentity authenticates with an AKS workload identity
+	// federated token, using FederatedTokenFile, TenantID and ClientID.
+	AuthModeWorkloadIdentity AuthMode = "workload"
+	// AuthModeServicePrincipal authenticates as a service principal, using
+	// TenantID, ClientID, and either ClientSecretPath or CertificatePath.
+	AuthModeServicePrincipal AuthMode = "spn"
+	// AuthModeCLI authenticates as whoever is currently logged in through the
+	// Azure CLI (az login), for local development and CI.
+	AuthModeCLI AuthMode = "cli"
+	// AuthModeChain tries, in order, whichever of the service principal,
+	// workload identity, managed identity and CLI credentials have their
+	// required fields set.
+	AuthModeChain AuthMode = "chain"
+)
+
 // Config is a struct of parameters to define the behavior of Handler.
 type Config struct {
 	// ServiceURL is the URL for the storage account to use.
 	ServiceURL url.URL
 
-	// ClientID, when set, defines the managed identity's client ID to use for
-	// authentication.
+	// AuthMode selects the credential used to authenticate to the storage
+	// account. If unset, it defaults to AuthModeManagedIdentity when
+	// ClientID is set, and AuthModeDefault otherwise.
+	AuthMode AuthMode
+
+	// ClientID, depending on AuthMode, is either the managed identity's or
+	// the service principal's client ID to use for authentication.
 	ClientID string
 
+	// TenantID is the Azure AD tenant to authenticate against, required by
+	// AuthModeWorkloadIdentity and AuthModeServicePrincipal.
+	TenantID string
+
+	// ClientSecretPath, for AuthModeServicePrincipal, is the path to a file
+	// holding the service principal's client secret.
+	ClientSecretPath string
+
+	// CertificatePath, for AuthModeServicePrincipal, is the path to a PEM
+	// file holding the service principal's client certificate and private
+	// key, used instead of ClientSecretPath.
+	CertificatePath string
+
+	// FederatedTokenFile, for AuthModeWorkloadIdentity, is the path to the
+	// projected federated token file injected by AKS workload identity.
+	FederatedTokenFile string
+
+	// Cloud selects the Azure cloud the storage account and AAD tenant live
+	// in. If unset, it defaults to AzurePublic.
+	Cloud Cloud
+
+	// Encryption selects whether session recordings are client-side
+	// encrypted before being uploaded. If unset, it defaults to
+	// EncryptionNone.
+	Encryption EncryptionMode
+
+	// KeyVaultURL is the URL of the Key Vault holding KeyName, required by
+	// EncryptionAKVEnvelope.
+	KeyVaultURL string
+
+	// KeyName is the name of the Key Vault key used to wrap session
+	// encryption keys, required by EncryptionAKVEnvelope.
+	KeyName string
+
+	// KeyVersion optionally pins the Key Vault key version used to wrap new
+	// session encryption keys. If unset, the latest version is used; DEKs
+	// wrapped under an older version are still unwrapped correctly, as the
+	// version actually used is recorded in the blob metadata.
+	KeyVersion string
+
 	// Log is the logger to use. If unset, it will default to the global logger
 	// with a component of "azblob".
 	Log logrus.FieldLogger
@@ -126,6 +309,16 @@ func (c *Config) SetFromURL(u *url.URL) error {
 	c.ServiceURL.RawFragment = ""
 
 	c.ClientID = params.Get(clientIDFragParam)
+	c.AuthMode = AuthMode(params.Get(authModeFragParam))
+	c.TenantID = params.Get(tenantIDFragParam)
+	c.ClientSecretPath = params.Get(clientSecretPathFragParam)
+	c.CertificatePath = params.Get(certificatePathFragParam)
+	c.FederatedTokenFile = params.Get(federatedTokenFileFragParam)
+	c.Cloud = Cloud(params.Get(cloudFragParam))
+	c.Encryption = EncryptionMode(params.Get(encryptionFragParam))
+	c.KeyVaultURL = params.Get(keyVaultURLFragParam)
+	c.KeyName = params.Get(keyNameFragParam)
+	c.KeyVersion = params.Get(keyVersionFragParam)
 
 	return nil
 }
@@ -135,29 +328,157 @@ func (c *Config) CheckAndSetDefaults() error {
 		c.Log = logrus.WithField(trace.Component, teleport.SchemeAZBlob)
 	}
 
+	if c.AuthMode == "" {
+		if c.ClientID != "" {
+			c.AuthMode = AuthModeManagedIdentity
+		} else {
+			c.AuthMode = AuthModeDefault
+		}
+	}
+
+	if c.Cloud == "" {
+		c.Cloud = AzurePublic
+	}
+	suffix, ok := storageHostSuffixes[c.Cloud]
+	if !ok {
+		return trace.BadParameter("unsupported azure cloud %q", c.Cloud)
+	}
+	if c.ServiceURL.Host != "" && !strings.HasSuffix(c.ServiceURL.Host, suffix) {
+		return trace.BadParameter("service URL host %q does not match the %v storage suffix %q", c.ServiceURL.Host, c.Cloud, suffix)
+	}
+
+	if c.Encryption == "" {
+		c.Encryption = EncryptionNone
+	}
+	if c.Encryption == EncryptionAKVEnvelope {
+		if c.KeyVaultURL == "" {
+			return trace.BadParameter("a key vault URL is required for the %q encryption mode", EncryptionAKVEnvelope)
+		}
+		if c.KeyName == "" {
+			return trace.BadParameter("a key name is required for the %q encryption mode", EncryptionAKVEnvelope)
+		}
+	}
+
 	return nil
 }
 
-func NewHandler(ctx context.Context, cfg Config) (*Handler, error) {
-	if err := cfg.CheckAndSetDefaults(); err != nil {
-		return nil, trace.Wrap(err)
+// clientOptions returns the azcore client options that point the
+// credentials built by newCredential at the right AAD authority for c.Cloud.
+func (c *Config) clientOptions() azcore.ClientOptions {
+	return azcore.ClientOptions{Cloud: cloudConfigurations[c.Cloud]}
+}
+
+// newCredential builds the azcore.TokenCredential selected by c.AuthMode.
+func (c *Config) newCredential() (azcore.TokenCredential, error) {
+	switch c.AuthMode {
+	case AuthModeDefault:
+		return azidentity.NewDefaultAzureCredential(&azidentity.DefaultAzureCredentialOptions{
+			ClientOptions: c.clientOptions(),
+		})
+	case AuthModeManagedIdentity:
+		opts := &azidentity.ManagedIdentityCredentialOptions{ClientOptions: c.clientOptions()}
+		if c.ClientID != "" {
+			opts.ID = azidentity.ClientID(c.ClientID)
+		}
+		return azidentity.NewManagedIdentityCredential(opts)
+	case AuthModeWorkloadIdentity:
+		return c.newWorkloadIdentityCredential()
+	case AuthModeServicePrincipal:
+		return c.newServicePrincipalCredential()
+	case AuthModeCLI:
+		return azidentity.NewAzureCLICredential(nil)
+	case AuthModeChain:
+		return c.newChainedCredential()
+	default:
+		return nil, trace.BadParameter("unsupported azure auth mode %q", c.AuthMode)
 	}
+}
 
-	var cred azcore.TokenCredential
-	if cfg.ClientID != "" {
-		c, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
-			ID: azidentity.ClientID(cfg.ClientID),
+func (c *Config) newWorkloadIdentityCredential() (azcore.TokenCredential, error) {
+	return azidentity.NewWorkloadIdentityCredential(&azidentity.WorkloadIdentityCredentialOptions{
+		ClientOptions: c.clientOptions(),
+		TenantID:      c.TenantID,
+		ClientID:      c.ClientID,
+		TokenFilePath: c.FederatedTokenFile,
+	})
+}
+
+func (c *Config) newServicePrincipalCredential() (azcore.TokenCredential, error) {
+	switch {
+	case c.ClientSecretPath != "":
+		secret, err := os.ReadFile(c.ClientSecretPath)
+		if err != nil {
+			return nil, trace.ConvertSystemError(err)
+		}
+		return azidentity.NewClientSecretCredential(c.TenantID, c.ClientID, strings.TrimSpace(string(secret)), &azidentity.ClientSecretCredentialOptions{
+			ClientOptions: c.clientOptions(),
 		})
+	case c.CertificatePath != "":
+		pemData, err := os.ReadFile(c.CertificatePath)
+		if err != nil {
+			return nil, trace.ConvertSystemError(err)
+		}
+		certs, key, err := azidentity.ParseCertificates(pemData, nil)
+		if err != nil {
+			return nil, trace.Wrap(err, "parsing client certificate")
+		}
+		return azidentity.NewClientCertificateCredential(c.TenantID, c.ClientID, certs, key, &azidentity.ClientCertificateCredentialOptions{
+			ClientOptions: c.clientOptions(),
+		})
+	default:
+		return nil, trace.BadParameter("one of ClientSecretPath or CertificatePath must be set for the %q auth mode", AuthModeServicePrincipal)
+	}
+}
+
+// newChainedCredential composes a ChainedTokenCredential out of whichever of
+// the service principal, workload identity, managed identity and CLI
+// credentials have the fields they need set, trying them in that order.
+func (c *Config) newChainedCredential() (azcore.TokenCredential, error) {
+	var creds []azcore.TokenCredential
+
+	if c.ClientSecretPath != "" || c.CertificatePath != "" {
+		cred, err := c.newServicePrincipalCredential()
 		if err != nil {
 			return nil, trace.Wrap(err)
 		}
-		cred = c
-	} else {
-		c, err := azidentity.NewDefaultAzureCredential(nil)
+		creds = append(creds, cred)
+	}
+	if c.FederatedTokenFile != "" {
+		cred, err := c.newWorkloadIdentityCredential()
 		if err != nil {
 			return nil, trace.Wrap(err)
 		}
-		cred = c
+		creds = append(creds, cred)
+	}
+	if c.ClientID != "" {
+		cred, err := azidentity.NewManagedIdentityCredential(&azidentity.ManagedIdentityCredentialOptions{
+			ClientOptions: c.clientOptions(),
+			ID:            azidentity.ClientID(c.ClientID),
+		})
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		creds = append(creds, cred)
+	}
+	if cliCred, err := azidentity.NewAzureCLICredential(nil); err == nil {
+		creds = append(creds, cliCred)
+	}
+
+	if len(creds) == 0 {
+		return nil, trace.BadParameter("no credentials are configured for the %q auth mode", AuthModeChain)
+	}
+
+	return azidentity.NewChainedTokenCredential(creds, nil)
+}
+
+func NewHandler(ctx context.Context, cfg Config) (*Handler, error) {
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	cred, err := cfg.newCredential()
+	if err != nil {
+		return nil, trace.Wrap(err)
 	}
 
 	cred = &cachedTokenCredential{TokenCredential: cred}
@@ -204,7 +525,33 @@ func NewHandler(ctx context.Context, cfg Config) (*Handler, error) {
 		return nil, trace.Wrap(err)
 	}
 
-	return &Handler{c: cfg, cred: cred, session: session, inprogress: inprogress}, nil
+	// the service client is only used for the account-wide Find Blobs by Tags
+	// API, which is how FindSessions and stale upload lookups are answered
+	// without listing every blob.
+	svcURL := cfg.ServiceURL
+	svcURL.Path = ""
+	svc, err := service.NewClient(svcURL.String(), cred, nil)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	var keys *azkeys.Client
+	if cfg.Encryption == EncryptionAKVEnvelope {
+		keys, err = azkeys.NewClient(cfg.KeyVaultURL, cred, &azkeys.ClientOptions{ClientOptions: cfg.clientOptions()})
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+
+	return &Handler{
+		c:          cfg,
+		cred:       cred,
+		session:    session,
+		inprogress: inprogress,
+		service:    svc,
+		keys:       keys,
+		dekCache:   newSessionDEKCache(),
+	}, nil
 }
 
 // Handler is a MultipartHandler that stores data in Azure Blob Storage.
@@ -213,6 +560,15 @@ type Handler struct {
 	cred       azcore.TokenCredential
 	session    *container.Client
 	inprogress *container.Client
+	service    *service.Client
+
+	// keys is the Key Vault client used to wrap and unwrap session
+	// encryption keys when c.Encryption is EncryptionAKVEnvelope; nil
+	// otherwise.
+	keys *azkeys.Client
+	// dekCache caches unwrapped per-upload session encryption keys so
+	// UploadPart doesn't round-trip to Key Vault for every part.
+	dekCache *sessionDEKCache
 }
 
 var _ events.MultipartHandler = (*Handler)(nil)
@@ -239,9 +595,30 @@ func (h *Handler) partBlob(upload events.StreamUpload, partNumber int64) *blockb
 func (h *Handler) Upload(ctx context.Context, sessionID session.ID, reader io.Reader) (string, error) {
 	blob := h.sessionBlob(sessionID)
 
-	if _, err := cErr2(blob.UploadStream(ctx, reader, &blockblob.UploadStreamOptions{
+	opts := &blockblob.UploadStreamOptions{
 		AccessConditions: &blobDoesNotExist,
-	})); err != nil {
+		Tags:             sessionBlobTags(sessionID),
+	}
+
+	if h.c.Encryption == EncryptionAKVEnvelope {
+		dek, err := newDataEncryptionKey()
+		if err != nil {
+			return "", trace.Wrap(err)
+		}
+		meta, err := h.wrap(ctx, dek)
+		if err != nil {
+			return "", trace.Wrap(err)
+		}
+		opts.Metadata = meta
+
+		encReader, err := newEncryptingReader(reader, dek, 0)
+		if err != nil {
+			return "", trace.Wrap(err)
+		}
+		reader = encReader
+	}
+
+	if _, err := cErr2(blob.UploadStream(ctx, reader, opts)); err != nil {
 		return "", trace.Wrap(err)
 	}
 	h.c.Log.WithField(fieldSessionID, sessionID).Debug("Uploaded session.")
@@ -270,9 +647,25 @@ func (h *Handler) Download(ctx context.Context, sessionID session.ID, writer io.
 		}
 	}()
 
-	_, err = io.Copy(io.NewOffsetWriter(writer, beginOffset), resp.Body)
-	if cerr := cErr(err); cerr != nil {
-		return trace.Wrap(cerr)
+	dek, err := h.unwrap(ctx, resp.Metadata)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if dek == nil {
+		if _, err := io.Copy(io.NewOffsetWriter(writer, beginOffset), resp.Body); err != nil {
+			if cerr := cErr(err); cerr != nil {
+				return trace.Wrap(cerr)
+			}
+		}
+	} else {
+		regionSize := encryptionRegionSize
+		if n, err := strconv.Atoi(stringMeta(resp.Metadata, metaEncryptionRegion)); err == nil && n > 0 {
+			regionSize = n
+		}
+		if err := decryptRegionsTo(writer, beginOffset, resp.Body, dek, regionSize); err != nil {
+			return trace.Wrap(err)
+		}
 	}
 
 	h.c.Log.WithField(fieldSessionID, sessionID).Debug("Downloaded session.")
@@ -288,10 +681,26 @@ func (h *Handler) CreateUpload(ctx context.Context, sessionID session.ID) (*even
 
 	blob := h.uploadMarkerBlob(upload)
 
-	emptyBody := streaming.NopCloser(&bytes.Reader{})
-	if _, err := cErr2(blob.Upload(ctx, emptyBody, &blockblob.UploadOptions{
+	uploadOpts := &blockblob.UploadOptions{
 		AccessConditions: &blobDoesNotExist,
-	})); err != nil {
+		Tags:             markerBlobTags(sessionID),
+	}
+
+	if h.c.Encryption == EncryptionAKVEnvelope {
+		dek, err := newDataEncryptionKey()
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		meta, err := h.wrap(ctx, dek)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		uploadOpts.Metadata = meta
+		h.dekCache.set(sessionID, upload.ID, dek)
+	}
+
+	emptyBody := streaming.NopCloser(&bytes.Reader{})
+	if _, err := cErr2(blob.Upload(ctx, emptyBody, uploadOpts)); err != nil {
 		return nil, trace.Wrap(err)
 	}
 	h.c.Log.WithField(fieldSessionID, sessionID).Debug("Created upload marker.")
@@ -307,21 +716,35 @@ func (h *Handler) CompleteUpload(ctx context.Context, upload events.StreamUpload
 	blob := h.sessionBlob(upload.SessionID)
 	markerBlob := h.uploadMarkerBlob(upload)
 
-	// TODO(espadolini): explore the possibility of using leases to get
-	// exclusive access while writing, and to guarantee that leftover parts are
-	// cleaned up before a new attempt
+	log := h.c.Log.WithFields(logrus.Fields{
+		fieldSessionID: upload.SessionID,
+		fieldUploadID:  upload.ID,
+	})
+
+	completionLease, err := h.acquireCompletionLease(ctx, markerBlob, log)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	stopRenewal := h.renewCompletionLease(ctx, completionLease, log)
+	defer stopRenewal()
 
 	parts = slices.Clone(parts)
 	slices.SortFunc(parts, func(a, b events.StreamPart) bool { return a.Number < b.Number })
 
+	h.cleanupOrphanParts(ctx, upload, parts, log)
+
 	partURLs := make([]string, 0, len(parts))
 	for _, part := range parts {
 		b := h.partBlob(upload, part.Number)
 		partURLs = append(partURLs, b.URL())
 	}
 
+	storageScope, ok := storageScopes[h.c.Cloud]
+	if !ok {
+		storageScope = storageScopes[AzurePublic]
+	}
 	token, err := h.cred.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{"https://storage.azure.com/.default"},
+		Scopes: []string{storageScope},
 	})
 	if err != nil {
 		return trace.Wrap(err)
@@ -331,10 +754,14 @@ func (h *Handler) CompleteUpload(ctx context.Context, upload events.StreamUpload
 		CopySourceAuthorization: &copySourceAuthorization,
 	}
 
-	log := h.c.Log.WithFields(logrus.Fields{
-		fieldSessionID: upload.SessionID,
-		fieldUploadID:  upload.ID,
-	})
+	var encryptionMeta map[string]*string
+	if h.c.Encryption == EncryptionAKVEnvelope {
+		markerProps, err := cErr2(markerBlob.GetProperties(ctx, nil))
+		if err != nil {
+			return trace.Wrap(err, "reading upload marker encryption metadata")
+		}
+		encryptionMeta = markerProps.Metadata
+	}
 
 	eg, egCtx := errgroup.WithContext(ctx)
 	eg.SetLimit(5) // default parallelism as used by azblob.DoBatchTransfer
@@ -367,6 +794,8 @@ func (h *Handler) CompleteUpload(ctx context.Context, upload events.StreamUpload
 	log.Debug("Committing part list.")
 	if _, err := cErr2(blob.CommitBlockList(ctx, blockNames, &blockblob.CommitBlockListOptions{
 		AccessConditions: &blobDoesNotExist,
+		Tags:             sessionBlobTags(upload.SessionID),
+		Metadata:         encryptionMeta,
 	})); err != nil {
 		if !trace.IsAlreadyExists(err) {
 			return trace.Wrap(err)
@@ -377,23 +806,227 @@ func (h *Handler) CompleteUpload(ctx context.Context, upload events.StreamUpload
 		log.Debug("Completed session upload.")
 	}
 
+	if h.c.Encryption == EncryptionAKVEnvelope {
+		h.dekCache.delete(upload.SessionID, upload.ID)
+	}
+
+	// the lease must not be renewed once its blob is being deleted
+	stopRenewal()
+
 	// TODO(espadolini): should the cleanup run in its own goroutine? What
 	// should the cancellation context for the cleanup be in that case?
-	if _, err := cErr2(markerBlob.Delete(ctx, nil)); err != nil && !trace.IsNotFound(err) {
+	if _, err := cErr2(markerBlob.Delete(ctx, &azblob.DeleteBlobOptions{
+		AccessConditions: &azblob.AccessConditions{
+			LeaseAccessConditions: &azblob.LeaseAccessConditions{LeaseID: completionLease.LeaseID()},
+		},
+	})); err != nil && !trace.IsNotFound(err) {
 		log.WithError(err).WithField(fieldPartCount, len(parts)).Warn("Failed to clean up upload marker.")
 		return nil
 	}
 
-	// TODO(espadolini): group deletes together with Blob Batch, not supported
-	// by the SDK
+	h.batchDeletePartBlobs(ctx, upload, parts, log)
+
+	return nil
+}
+
+const (
+	// completionLeaseDuration is the length of the lease CompleteUpload holds
+	// on the upload marker blob while it runs, the maximum Azure Blob
+	// Storage allows for a fixed-duration lease.
+	completionLeaseDuration = 60 * time.Second
+	// completionLeaseRenewPeriod is how often the background goroutine
+	// renews the lease while CompleteUpload is still staging blocks, well
+	// inside completionLeaseDuration so a slow renewal round-trip can't let
+	// the lease lapse.
+	completionLeaseRenewPeriod = 20 * time.Second
+	// completionLeaseMaxRetries is how many times acquireCompletionLease
+	// retries after a LeaseAlreadyPresent before giving up.
+	completionLeaseMaxRetries = 5
+	// completionLeaseRetryBase is the base delay of the exponential backoff
+	// (with jitter) between lease acquisition attempts.
+	completionLeaseRetryBase = 500 * time.Millisecond
+)
+
+// acquireCompletionLease acquires an exclusive lease on the upload marker
+// blob, so that two concurrent CompleteUpload calls for the same upload
+// can't race. If the lease is already held, it backs off with jitter and
+// retries up to completionLeaseMaxRetries times before giving up with a
+// trace.CompareFailed error, so callers can distinguish "another completer
+// is already finishing this upload" from a real failure.
+func (h *Handler) acquireCompletionLease(ctx context.Context, markerBlob *blockblob.Client, log logrus.FieldLogger) (*lease.BlobClient, error) {
+	leaseClient, err := lease.NewBlobClient(markerBlob, nil)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	durationSeconds := int32(completionLeaseDuration / time.Second)
+	for attempt := 0; ; attempt++ {
+		_, err := leaseClient.AcquireLease(ctx, durationSeconds, nil)
+		if err == nil {
+			return leaseClient, nil
+		}
+		if !bloberror.HasCode(err, bloberror.LeaseAlreadyPresent) {
+			return nil, trace.Wrap(cErr(err))
+		}
+		if attempt >= completionLeaseMaxRetries {
+			return nil, trace.CompareFailed("another completer is already finishing this upload")
+		}
+
+		backoff := completionLeaseRetryBase * time.Duration(int64(1)<<attempt)
+		backoff += time.Duration(rand.Int63n(int64(backoff)))
+		log.WithField("attempt", attempt+1).Debug("Upload marker lease is held by another completer, retrying.")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, trace.Wrap(ctx.Err())
+		}
+	}
+}
+
+// renewCompletionLease renews completionLease in the background every
+// completionLeaseRenewPeriod, so it doesn't expire while CompleteUpload is
+// still staging blocks. The returned function stops the renewal goroutine
+// and waits for it to exit; it must be called before the lease's blob is
+// deleted or released.
+func (h *Handler) renewCompletionLease(ctx context.Context, completionLease *lease.BlobClient, log logrus.FieldLogger) (stop func()) {
+	renewCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(completionLeaseRenewPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := completionLease.RenewLease(renewCtx, nil); err != nil && renewCtx.Err() == nil {
+					log.WithError(err).Warn("Failed to renew upload completion lease.")
+				}
+			case <-renewCtx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// cleanupOrphanParts deletes any part blobs for upload that aren't in
+// parts, left behind by a previous CompleteUpload attempt that staged some
+// blocks and then failed before committing. It's best effort: failures are
+// logged, not returned, since leftover parts are just storage waste and
+// don't affect correctness of the current attempt.
+func (h *Handler) cleanupOrphanParts(ctx context.Context, upload events.StreamUpload, parts []events.StreamPart, log logrus.FieldLogger) {
+	existing, err := h.ListParts(ctx, upload)
+	if err != nil {
+		log.WithError(err).Warn("Failed to list part blobs for orphan cleanup.")
+		return
+	}
+
+	wanted := make(map[int64]struct{}, len(parts))
+	for _, part := range parts {
+		wanted[part.Number] = struct{}{}
+	}
+
+	var orphans []events.StreamPart
+	for _, part := range existing {
+		if _, ok := wanted[part.Number]; !ok {
+			orphans = append(orphans, part)
+		}
+	}
+	if len(orphans) == 0 {
+		return
+	}
+
+	log.WithField(fieldPartCount, len(orphans)).Info("Cleaning up orphan part blobs from a previous completion attempt.")
+	h.batchDeletePartBlobs(ctx, upload, orphans, log)
+}
+
+// maxBatchDeleteSize is the maximum number of sub-requests the Blob Batch API
+// accepts in a single multipart/mixed request.
+const maxBatchDeleteSize = 256
+
+// batchDeletePartBlobs deletes the part blobs for upload using the Blob
+// Batch API, in chunks of maxBatchDeleteSize submitted with the same
+// parallelism used for StageBlockFromURL above, so cleaning up after a
+// 10k-part recording doesn't take thousands of sequential DELETE
+// round-trips. Sub-requests that the batch reports as failed (and batches
+// that fail to submit at all) fall back to an individual delete.
+func (h *Handler) batchDeletePartBlobs(ctx context.Context, upload events.StreamUpload, parts []events.StreamPart, log logrus.FieldLogger) {
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(5) // default parallelism as used by azblob.DoBatchTransfer
+
+	for chunkStart := 0; chunkStart < len(parts); chunkStart += maxBatchDeleteSize {
+		chunkEnd := chunkStart + maxBatchDeleteSize
+		if chunkEnd > len(parts) {
+			chunkEnd = len(parts)
+		}
+		chunk := parts[chunkStart:chunkEnd]
+
+		eg.Go(func() error {
+			h.batchDeletePartBlobChunk(egCtx, upload, chunk, log)
+			return nil
+		})
+	}
+	_ = eg.Wait() // batchDeletePartBlobChunk only ever logs, it never returns an error
+}
+
+// batchDeletePartBlobChunk submits a single Blob Batch delete request for up
+// to maxBatchDeleteSize part blobs, falling back to an individual delete for
+// any part that the service reports a per-subrequest error for.
+func (h *Handler) batchDeletePartBlobChunk(ctx context.Context, upload events.StreamUpload, parts []events.StreamPart, log logrus.FieldLogger) {
+	batch, err := h.service.NewBatchBuilder()
+	if err != nil {
+		log.WithError(err).Warn("Failed to build part cleanup batch, deleting individually.")
+		h.deletePartBlobsIndividually(ctx, upload, parts, log)
+		return
+	}
+
+	batched := make([]events.StreamPart, 0, len(parts))
+	for _, part := range parts {
+		if err := batch.Delete(inprogressContainerName, partName(upload, part.Number), nil); err != nil {
+			log.WithField(fieldPartNumber, part.Number).WithError(err).Warn("Failed to add part to delete batch, deleting individually.")
+			h.deletePartBlobsIndividually(ctx, upload, []events.StreamPart{part}, log)
+			continue
+		}
+		batched = append(batched, part)
+	}
+	if len(batched) == 0 {
+		return
+	}
+
+	resp, err := h.service.SubmitBatch(ctx, batch, nil)
+	if err != nil {
+		log.WithError(err).Warn("Failed to submit part cleanup batch, deleting individually.")
+		h.deletePartBlobsIndividually(ctx, upload, batched, log)
+		return
+	}
+
+	for i, r := range resp.Responses {
+		if i >= len(batched) {
+			break
+		}
+		if r == nil || r.Error == nil {
+			continue
+		}
+		log.WithField(fieldPartNumber, batched[i].Number).WithError(r.Error).Warn("Failed to clean up part in batch, deleting individually.")
+		h.deletePartBlobsIndividually(ctx, upload, []events.StreamPart{batched[i]}, log)
+	}
+}
+
+// deletePartBlobsIndividually deletes each of parts with its own DELETE
+// request, the fallback path for when batching isn't available or fails.
+func (h *Handler) deletePartBlobsIndividually(ctx context.Context, upload events.StreamUpload, parts []events.StreamPart, log logrus.FieldLogger) {
 	for _, part := range parts {
 		b := h.partBlob(upload, part.Number)
 		if _, err := cErr2(b.Delete(ctx, nil)); err != nil {
 			log.WithField(fieldPartNumber, part.Number).WithError(err).Warn("Failed to clean up part.")
 		}
 	}
-
-	return nil
 }
 
 // ReserveUploadPart implements events.MultipartUploader by doing nothing.
@@ -407,7 +1040,17 @@ func (h *Handler) UploadPart(ctx context.Context, upload events.StreamUpload, pa
 
 	// our parts are just over 5 MiB (events.MinUploadPartSizeBytes) so we can
 	// upload them in one shot
-	if _, err := cErr2(blob.Upload(ctx, streaming.NopCloser(partBody), nil)); err != nil {
+	var body io.ReadSeekCloser = streaming.NopCloser(partBody)
+
+	if h.c.Encryption == EncryptionAKVEnvelope {
+		sealed, err := h.sealPart(ctx, upload, partNumber, partBody)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		body = streaming.NopCloser(bytes.NewReader(sealed))
+	}
+
+	if _, err := cErr2(blob.Upload(ctx, body, nil)); err != nil {
 		return nil, trace.Wrap(err)
 	}
 	h.c.Log.WithFields(logrus.Fields{
@@ -419,6 +1062,55 @@ func (h *Handler) UploadPart(ctx context.Context, upload events.StreamUpload, pa
 	return &events.StreamPart{Number: partNumber}, nil
 }
 
+// sealPart encrypts a whole part as a single AES-256-GCM region, using the
+// upload's session DEK. Parts are numbered from 1 with no gaps (the
+// MultipartUploader contract), so partNumber-1 is both the part's 0-based
+// position and the 0-based region index of the final composed blob that
+// CompleteUpload produces by concatenating the sealed parts in Number order.
+func (h *Handler) sealPart(ctx context.Context, upload events.StreamUpload, partNumber int64, partBody io.Reader) ([]byte, error) {
+	dek, err := h.sessionDEK(ctx, upload)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	plain, err := io.ReadAll(partBody)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	aead, err := dek.aead()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return aead.Seal(nil, dek.nonce(uint32(partNumber-1)), plain, nil), nil
+}
+
+// sessionDEK returns the unwrapped session encryption key for upload,
+// fetching and unwrapping it from the upload marker blob's metadata on
+// first use and caching the result for the rest of the upload.
+func (h *Handler) sessionDEK(ctx context.Context, upload events.StreamUpload) (*dataEncryptionKey, error) {
+	if dek := h.dekCache.get(upload.SessionID, upload.ID); dek != nil {
+		return dek, nil
+	}
+
+	markerProps, err := cErr2(h.uploadMarkerBlob(upload).GetProperties(ctx, nil))
+	if err != nil {
+		return nil, trace.Wrap(err, "reading upload marker encryption metadata")
+	}
+
+	dek, err := h.unwrap(ctx, markerProps.Metadata)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if dek == nil {
+		return nil, trace.BadParameter("upload %v for session %v has no session encryption metadata", upload.ID, upload.SessionID)
+	}
+
+	h.dekCache.set(upload.SessionID, upload.ID, dek)
+	return dek, nil
+}
+
 // ListParts implements events.MultipartUploader
 func (h *Handler) ListParts(ctx context.Context, upload events.StreamUpload) ([]events.StreamPart, error) {
 	prefix := partPrefix(upload)
@@ -520,4 +1212,83 @@ func (h *Handler) GetUploadMetadata(sessionID session.ID) events.UploadMetadata
 		URL:       url.String(),
 		SessionID: sessionID,
 	}
-}
\ No newline at end of file
+}
+
+// FindSessions queries the blob tag index of the session container with
+// tagFilter, a Find Blobs by Tags filter expression in terms of the tags set
+// by sessionBlobTags (e.g. `"session_id" = '1234...'`), so operators can
+// answer questions like "which sessions ended after time Y" in O(matches)
+// instead of listing every blob in the container. Only the session_id and
+// end_time_unix tags are set, so sessions cannot be filtered by user here.
+func (h *Handler) FindSessions(ctx context.Context, tagFilter string) ([]events.UploadMetadata, error) {
+	where := fmt.Sprintf("@container = '%v' AND %v", sessionContainerName, tagFilter)
+
+	var uploads []events.UploadMetadata
+	pager := h.service.NewFilterBlobsPager(&service.FilterBlobsOptions{
+		Where: &where,
+	})
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if cerr := cErr(err); cerr != nil {
+			return nil, trace.Wrap(cerr)
+		}
+
+		for _, b := range resp.Blobs {
+			if b == nil || b.Name == nil {
+				continue
+			}
+			sid, err := session.ParseID(*b.Name)
+			if err != nil {
+				continue
+			}
+			uploads = append(uploads, h.GetUploadMetadata(sid))
+		}
+	}
+
+	return uploads, nil
+}
+
+// FindStaleUploads returns the in-progress uploads whose marker blob was
+// created at least minAge ago, using the initiated_unix tag index on the
+// inprogress container (set by markerBlobTags) instead of listing every
+// marker blob and comparing its creation time, the way ListUploads does.
+func (h *Handler) FindStaleUploads(ctx context.Context, minAge time.Duration) ([]events.StreamUpload, error) {
+	cutoff := time.Now().Add(-minAge).Unix()
+	where := fmt.Sprintf("@container = '%v' AND \"%v\" <= '%v'", inprogressContainerName, tagInitiatedUnix, cutoff)
+
+	var uploads []events.StreamUpload
+	pager := h.service.NewFilterBlobsPager(&service.FilterBlobsOptions{
+		Where: &where,
+	})
+	for pager.More() {
+		resp, err := pager.NextPage(ctx)
+		if cerr := cErr(err); cerr != nil {
+			return nil, trace.Wrap(cerr)
+		}
+
+		for _, b := range resp.Blobs {
+			if b == nil || b.Name == nil || !strings.HasPrefix(*b.Name, uploadMarkerPrefix) {
+				continue
+			}
+
+			name := strings.TrimPrefix(*b.Name, uploadMarkerPrefix)
+			sid, uid, ok := strings.Cut(name, "/")
+			if !ok {
+				continue
+			}
+			if _, err := session.ParseID(sid); err != nil {
+				continue
+			}
+			if _, err := uuid.Parse(uid); err != nil {
+				continue
+			}
+
+			uploads = append(uploads, events.StreamUpload{
+				ID:        uid,
+				SessionID: session.ID(sid),
+			})
+		}
+	}
+
+	return uploads, nil
+}
@@ -0,0 +1,324 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azsessions
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azkeys"
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/session"
+)
+
+// EncryptionMode selects whether session recording content is client-side
+// encrypted before being sent to Azure Blob Storage.
+type EncryptionMode string
+
+const (
+	// EncryptionNone stores blob content as-is, relying entirely on
+	// server-side (storage account) encryption.
+	EncryptionNone EncryptionMode = "none"
+	// EncryptionAKVEnvelope envelope-encrypts blob content with a random
+	// per-session AES-256-GCM data encryption key (DEK), itself wrapped by
+	// an RSA key held in Azure Key Vault.
+	EncryptionAKVEnvelope EncryptionMode = "akv-envelope"
+)
+
+// wrapAlgorithm is the Key Vault key wrap algorithm used for the DEK.
+const wrapAlgorithm = azkeys.JSONWebKeyEncryptionAlgorithmRSAOAEP256
+
+// encryptionRegionSize is the amount of plaintext, in bytes, sealed into a
+// single AES-256-GCM region. It intentionally matches the size Teleport
+// uses for multipart upload parts (just over 5 MiB, see
+// events.MinUploadPartSizeBytes) so that a part blob is always exactly one
+// encrypted region: CompleteUpload's Put Block From URL compose then just
+// concatenates already-sealed regions, with no need to decrypt and
+// re-encrypt across part boundaries.
+const encryptionRegionSize = 5*1024*1024 + 1024*1024
+
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// blob metadata keys used to store the envelope encryption parameters,
+// surfaced over the wire as the x-ms-meta-encryption-* headers.
+const (
+	metaEncryptionMode       = "encryption-mode"
+	metaEncryptionAlgorithm  = "encryption-algorithm"
+	metaEncryptionKeyID      = "encryption-keyid"
+	metaEncryptionWrappedKey = "encryption-wrappedkey"
+	metaEncryptionIV         = "encryption-iv"
+	metaEncryptionRegion     = "encryption-regionsize"
+)
+
+// dataEncryptionKey is an unwrapped, ready to use session DEK together with
+// the base nonce its regions are derived from.
+type dataEncryptionKey struct {
+	key       []byte // 32 bytes, AES-256
+	baseNonce []byte // 12 bytes; the low 4 bytes are overwritten with the region counter
+}
+
+func (k *dataEncryptionKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return aead, nil
+}
+
+// nonce returns the per-region nonce for regionIndex, derived from the base
+// nonce by overwriting its last 4 bytes with a big-endian region counter.
+func (k *dataEncryptionKey) nonce(regionIndex uint32) []byte {
+	nonce := make([]byte, gcmNonceSize)
+	copy(nonce, k.baseNonce)
+	binary.BigEndian.PutUint32(nonce[gcmNonceSize-4:], regionIndex)
+	return nonce
+}
+
+// newDataEncryptionKey generates a random AES-256 DEK and base nonce for a
+// new session.
+func newDataEncryptionKey() (*dataEncryptionKey, error) {
+	dek := &dataEncryptionKey{
+		key:       make([]byte, 32),
+		baseNonce: make([]byte, gcmNonceSize),
+	}
+	if _, err := rand.Read(dek.key); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if _, err := rand.Read(dek.baseNonce); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return dek, nil
+}
+
+// wrap wraps dek.key with the configured Key Vault key, returning the
+// metadata to store on the blob.
+func (h *Handler) wrap(ctx context.Context, dek *dataEncryptionKey) (map[string]*string, error) {
+	resp, err := h.keys.WrapKey(ctx, h.c.KeyName, h.c.KeyVersion, azkeys.KeyOperationParameters{
+		Algorithm: to.Ptr(wrapAlgorithm),
+		Value:     dek.key,
+	}, nil)
+	if err != nil {
+		return nil, trace.Wrap(err, "wrapping session DEK")
+	}
+
+	return map[string]*string{
+		metaEncryptionMode:       to.Ptr(string(EncryptionAKVEnvelope)),
+		metaEncryptionAlgorithm:  to.Ptr(string(wrapAlgorithm)),
+		metaEncryptionKeyID:      resp.KID,
+		metaEncryptionWrappedKey: to.Ptr(base64.StdEncoding.EncodeToString(resp.Result)),
+		metaEncryptionIV:         to.Ptr(base64.StdEncoding.EncodeToString(dek.baseNonce)),
+		metaEncryptionRegion:     to.Ptr(strconv.Itoa(encryptionRegionSize)),
+	}, nil
+}
+
+// unwrap reads the envelope encryption metadata off a blob and unwraps the
+// DEK through Key Vault, returning (nil, nil) if the blob isn't encrypted.
+func (h *Handler) unwrap(ctx context.Context, meta map[string]*string) (*dataEncryptionKey, error) {
+	mode := stringMeta(meta, metaEncryptionMode)
+	if mode == "" {
+		return nil, nil
+	}
+	if EncryptionMode(mode) != EncryptionAKVEnvelope {
+		return nil, trace.BadParameter("unsupported session encryption mode %q", mode)
+	}
+
+	keyID := stringMeta(meta, metaEncryptionKeyID)
+	wrappedKey, err := base64.StdEncoding.DecodeString(stringMeta(meta, metaEncryptionWrappedKey))
+	if err != nil {
+		return nil, trace.Wrap(err, "decoding wrapped session DEK")
+	}
+	baseNonce, err := base64.StdEncoding.DecodeString(stringMeta(meta, metaEncryptionIV))
+	if err != nil {
+		return nil, trace.Wrap(err, "decoding session encryption IV")
+	}
+
+	keyName, keyVersion := h.c.KeyName, h.c.KeyVersion
+	if keyID != "" {
+		if name, version, ok := parseKeyID(keyID); ok {
+			keyName, keyVersion = name, version
+		}
+	}
+
+	resp, err := h.keys.UnwrapKey(ctx, keyName, keyVersion, azkeys.KeyOperationParameters{
+		Algorithm: to.Ptr(azkeys.JSONWebKeyEncryptionAlgorithm(stringMeta(meta, metaEncryptionAlgorithm))),
+		Value:     wrappedKey,
+	}, nil)
+	if err != nil {
+		return nil, trace.Wrap(err, "unwrapping session DEK")
+	}
+
+	return &dataEncryptionKey{key: resp.Result, baseNonce: baseNonce}, nil
+}
+
+func stringMeta(meta map[string]*string, key string) string {
+	if v := meta[key]; v != nil {
+		return *v
+	}
+	return ""
+}
+
+// parseKeyID extracts the key name and version from a Key Vault key
+// identifier URL (".../keys/<name>/<version>").
+func parseKeyID(keyID string) (name, version string, ok bool) {
+	const sep = "/keys/"
+	idx := strings.Index(keyID, sep)
+	if idx < 0 {
+		return "", "", false
+	}
+	rest := keyID[idx+len(sep):]
+	slash := strings.LastIndex(rest, "/")
+	if slash < 0 {
+		return rest, "", true
+	}
+	return rest[:slash], rest[slash+1:], true
+}
+
+// encryptingReader wraps an io.Reader of plaintext, sealing it into a
+// stream of AES-256-GCM regions of encryptionRegionSize plaintext bytes
+// each (the last region may be shorter), so it can be passed directly to
+// UploadStream without buffering the whole session in memory.
+type encryptingReader struct {
+	src    io.Reader
+	dek    *dataEncryptionKey
+	aead   cipher.AEAD
+	region uint32
+
+	buf    bytes.Buffer // sealed bytes not yet read out
+	plain  []byte       // reusable plaintext scratch buffer
+	closed bool
+}
+
+// newEncryptingReader wraps src, sealing it starting at region startRegion.
+func newEncryptingReader(src io.Reader, dek *dataEncryptionKey, startRegion uint32) (*encryptingReader, error) {
+	aead, err := dek.aead()
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &encryptingReader{
+		src:    src,
+		dek:    dek,
+		aead:   aead,
+		region: startRegion,
+		plain:  make([]byte, encryptionRegionSize),
+	}, nil
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && !r.closed {
+		n, err := io.ReadFull(r.src, r.plain)
+		if n > 0 {
+			sealed := r.aead.Seal(nil, r.dek.nonce(r.region), r.plain[:n], nil)
+			r.region++
+			r.buf.Write(sealed)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.closed = true
+		} else if err != nil {
+			return 0, trace.Wrap(err)
+		}
+	}
+	if r.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return r.buf.Read(p)
+}
+
+// decryptRegionsTo decrypts src, a stream of AES-256-GCM regions of
+// plaintextRegionSize plaintext bytes each (the last possibly shorter), and
+// writes the plaintext to dst starting at offset.
+func decryptRegionsTo(dst io.WriterAt, offset int64, src io.Reader, dek *dataEncryptionKey, plaintextRegionSize int) error {
+	aead, err := dek.aead()
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	sealedRegionSize := plaintextRegionSize + gcmTagSize
+	sealed := make([]byte, sealedRegionSize)
+	var region uint32
+	for {
+		n, err := io.ReadFull(src, sealed)
+		if n > 0 {
+			plain, err := aead.Open(sealed[:0], dek.nonce(region), sealed[:n], nil)
+			if err != nil {
+				return trace.Wrap(err, "decrypting session recording region %d", region)
+			}
+			if _, err := dst.WriteAt(plain, offset); err != nil {
+				return trace.Wrap(err)
+			}
+			offset += int64(len(plain))
+			region++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return trace.Wrap(err)
+		}
+	}
+}
+
+// sessionDEKCache caches unwrapped per-upload DEKs so that UploadPart
+// doesn't have to round-trip to Key Vault for every part of a multipart
+// upload.
+type sessionDEKCache struct {
+	mu    sync.Mutex
+	byKey map[session.ID]map[string]*dataEncryptionKey
+}
+
+func newSessionDEKCache() *sessionDEKCache {
+	return &sessionDEKCache{byKey: make(map[session.ID]map[string]*dataEncryptionKey)}
+}
+
+func (c *sessionDEKCache) get(sessionID session.ID, uploadID string) *dataEncryptionKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.byKey[sessionID][uploadID]
+}
+
+func (c *sessionDEKCache) set(sessionID session.ID, uploadID string, dek *dataEncryptionKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byKey[sessionID] == nil {
+		c.byKey[sessionID] = make(map[string]*dataEncryptionKey)
+	}
+	c.byKey[sessionID][uploadID] = dek
+}
+
+func (c *sessionDEKCache) delete(sessionID session.ID, uploadID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.byKey[sessionID], uploadID)
+}
@@ -0,0 +1,133 @@
+/*
+ * Teleport
+ * Copyright (C) 2023  Gravitational, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package blobsessions
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gravitational/teleport/lib/events"
+	"github.com/gravitational/teleport/lib/session"
+)
+
+func newTestHandler(t *testing.T) *Handler {
+	h, err := NewHandler(context.Background(), Config{BucketURL: "mem://"})
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, h.Close()) })
+	return h
+}
+
+func TestHandlerUploadDownloadRoundTrip(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	sessionID := session.ID("test-session-upload")
+
+	url, err := h.Upload(ctx, sessionID, bytes.NewReader([]byte("recording bytes")))
+	require.NoError(t, err)
+	require.Equal(t, h.GetUploadMetadata(sessionID).URL, url)
+
+	var buf bytesWriterAt
+	require.NoError(t, h.Download(ctx, sessionID, &buf))
+	require.Equal(t, "recording bytes", string(buf.data))
+}
+
+func TestHandlerDownloadNotFound(t *testing.T) {
+	h := newTestHandler(t)
+	var buf bytesWriterAt
+	err := h.Download(context.Background(), session.ID("missing-session"), &buf)
+	require.True(t, trace.IsNotFound(err), "expected a not-found error, got %v", err)
+}
+
+func TestHandlerMultipartUploadRoundTrip(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	sessionID := session.NewID()
+
+	upload, err := h.CreateUpload(ctx, sessionID)
+	require.NoError(t, err)
+	require.Equal(t, sessionID, upload.SessionID)
+
+	uploads, err := h.ListUploads(ctx)
+	require.NoError(t, err)
+	require.Len(t, uploads, 1)
+	require.Equal(t, upload.ID, uploads[0].ID)
+
+	part2, err := h.UploadPart(ctx, *upload, 2, bytes.NewReader([]byte("second ")))
+	require.NoError(t, err)
+	part1, err := h.UploadPart(ctx, *upload, 1, bytes.NewReader([]byte("first ")))
+	require.NoError(t, err)
+
+	parts, err := h.ListParts(ctx, *upload)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	require.Equal(t, int64(1), parts[0].Number)
+	require.Equal(t, int64(2), parts[1].Number)
+
+	require.NoError(t, h.CompleteUpload(ctx, *upload, []events.StreamPart{*part2, *part1}))
+
+	var buf bytesWriterAt
+	require.NoError(t, h.Download(ctx, sessionID, &buf))
+	require.Equal(t, "first second ", string(buf.data))
+
+	uploads, err = h.ListUploads(ctx)
+	require.NoError(t, err)
+	require.Empty(t, uploads, "upload marker and part blobs should be cleaned up on completion")
+}
+
+func TestHandlerAbortUpload(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	sessionID := session.ID("test-session-abort")
+
+	upload, err := h.CreateUpload(ctx, sessionID)
+	require.NoError(t, err)
+	_, err = h.UploadPart(ctx, *upload, 1, bytes.NewReader([]byte("abandoned")))
+	require.NoError(t, err)
+
+	require.NoError(t, h.AbortUpload(ctx, *upload))
+
+	uploads, err := h.ListUploads(ctx)
+	require.NoError(t, err)
+	require.Empty(t, uploads)
+
+	parts, err := h.ListParts(ctx, *upload)
+	require.NoError(t, err)
+	require.Empty(t, parts)
+}
+
+// bytesWriterAt is a minimal io.WriterAt backed by an in-memory buffer, used
+// in place of an *os.File so Download can be tested without touching disk.
+type bytesWriterAt struct {
+	data []byte
+}
+
+func (b *bytesWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	end := off + int64(len(p))
+	if int64(len(b.data)) < end {
+		grown := make([]byte, end)
+		copy(grown, b.data)
+		b.data = grown
+	}
+	copy(b.data[off:end], p)
+	return len(p), nil
+}
@@ -0,0 +1,184 @@
+/*
+ * Teleport
+ * Copyright (C) 2023  Gravitational, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package s3sessions
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/lib/events"
+	"github.com/gravitational/teleport/lib/session"
+	awsutils "github.com/gravitational/teleport/lib/utils/aws"
+)
+
+// manifestSuffix is appended to a session's object key to get the key of
+// its integrity manifest, written alongside the completed recording by
+// CompleteUpload.
+const manifestSuffix = ".sha256"
+
+// manifestKey returns the key of the integrity manifest for a session.
+func (h *Handler) manifestKey(sessionID session.ID) string {
+	return h.path(sessionID) + manifestSuffix
+}
+
+// ManifestSigner signs a recording's composite integrity hash, so a
+// verifier can confirm the manifest wasn't tampered with alongside the
+// recording it describes. If h.Config.ManifestSigner is unset, manifests
+// are written unsigned.
+type ManifestSigner interface {
+	Sign(digest []byte) (signature []byte, err error)
+}
+
+// partDigest is one part's entry in a recording's integrity manifest.
+type partDigest struct {
+	Number int64  `json:"part"`
+	SHA256 []byte `json:"sha256"`
+}
+
+// manifest is the per-recording integrity manifest CompleteUpload writes
+// to <sessionID>.sha256: the SHA-256 of each part, and a composite "hash
+// of hashes" of the whole recording, so operators can verify a recording
+// pulled straight from the bucket without going through Teleport.
+type manifest struct {
+	Parts     []partDigest `json:"parts"`
+	Composite []byte       `json:"composite_sha256"`
+	Signature []byte       `json:"signature,omitempty"`
+}
+
+// compositeHash computes SHA256(concat(part digests sorted by number)),
+// matching S3's own "checksum of checksums" convention for composing
+// digests across the parts of a multipart upload.
+func compositeHash(parts []partDigest) []byte {
+	sorted := make([]partDigest, len(parts))
+	copy(sorted, parts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Number < sorted[j].Number })
+
+	digest := sha256.New()
+	for _, part := range sorted {
+		digest.Write(part.SHA256)
+	}
+	return digest.Sum(nil)
+}
+
+// writeManifest builds and uploads the integrity manifest for a completed
+// recording from the per-part digests recorded on parts, signing the
+// composite hash with h.Config.ManifestSigner if one is configured.
+func (h *Handler) writeManifest(ctx context.Context, sessionID session.ID, parts []events.StreamPart) error {
+	digests := make([]partDigest, 0, len(parts))
+	for _, part := range parts {
+		if len(part.SHA256) == 0 {
+			// A part with no recorded digest (e.g. from an older Handler
+			// version, or a ListParts round-trip that doesn't carry
+			// SHA256) makes the composite hash meaningless; skip writing
+			// a manifest rather than writing a misleading one.
+			return trace.BadParameter("part %v has no recorded digest, skipping integrity manifest", part.Number)
+		}
+		digests = append(digests, partDigest{Number: part.Number, SHA256: part.SHA256})
+	}
+
+	m := manifest{Parts: digests, Composite: compositeHash(digests)}
+
+	if h.Config.ManifestSigner != nil {
+		sig, err := h.Config.ManifestSigner.Sign(m.Composite)
+		if err != nil {
+			return trace.Wrap(err, "signing integrity manifest")
+		}
+		m.Signature = sig
+	}
+
+	body, err := json.Marshal(m)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(h.Bucket),
+		Key:    aws.String(h.manifestKey(sessionID)),
+		Body:   bytes.NewReader(body),
+	}
+	if !h.Config.DisableServerSideEncryption {
+		input.ServerSideEncryption = aws.String(s3.ServerSideEncryptionAwsKms)
+		if h.Config.SSEKMSKey != "" {
+			input.SSEKMSKeyId = aws.String(h.Config.SSEKMSKey)
+		}
+	}
+
+	if _, err := h.client.PutObjectWithContext(ctx, input); err != nil {
+		return awsutils.ConvertS3Error(err)
+	}
+	return nil
+}
+
+// readManifest fetches and parses the integrity manifest for a session.
+func (h *Handler) readManifest(ctx context.Context, sessionID session.ID) (*manifest, error) {
+	resp, err := h.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(h.Bucket),
+		Key:    aws.String(h.manifestKey(sessionID)),
+	})
+	if err != nil {
+		return nil, awsutils.ConvertS3Error(err)
+	}
+	defer resp.Body.Close()
+
+	var m manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &m, nil
+}
+
+// VerifyRecording downloads the integrity manifest for sessionID and
+// confirms that partSHA256s — the SHA-256 of a recording downloaded
+// straight from the bucket (bypassing Teleport entirely), split along the
+// same part boundaries CompleteUpload used and ordered by part number —
+// matches the manifest CompleteUpload wrote alongside it. The manifest's
+// composite hash is a "checksum of checksums" over per-part digests, not
+// a single digest over the recording's raw bytes, so a plain whole-object
+// SHA-256 can never be compared against it directly; a caller must
+// replicate the part-boundary hashing scheme to verify a recording this
+// way.
+func (h *Handler) VerifyRecording(ctx context.Context, sessionID session.ID, partSHA256s [][]byte) error {
+	m, err := h.readManifest(ctx, sessionID)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	sorted := make([]partDigest, len(m.Parts))
+	copy(sorted, m.Parts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Number < sorted[j].Number })
+
+	if len(partSHA256s) != len(sorted) {
+		return trace.CompareFailed("recording %v failed integrity verification: manifest has %d parts, %d part digests were provided", sessionID, len(sorted), len(partSHA256s))
+	}
+
+	for i, sum := range partSHA256s {
+		if !bytes.Equal(sum, sorted[i].SHA256) {
+			return trace.CompareFailed("recording %v failed integrity verification: part %d digest does not match manifest", sessionID, sorted[i].Number)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+/*
+ * Teleport
+ * Copyright (C) 2023  Gravitational, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package s3sessions
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+// This file covers the Object Lock types chunk8-3 introduces. The actual
+// lock-application logic (Handler.objectLockParams, Handler.applyRetention,
+// Handler.GetObjectRetention, Handler.ListUploadsWithRetention) all go
+// through an S3 client (h.client), and this checkout doesn't include the
+// handler.go that defines Handler/Config/client, so those can't be
+// exercised with a fake S3 backend here.
+
+func TestObjectLockModeMatchesS3Constants(t *testing.T) {
+	require.Equal(t, s3.ObjectLockModeGovernance, string(ObjectLockGovernance))
+	require.Equal(t, s3.ObjectLockModeCompliance, string(ObjectLockCompliance))
+}
+
+func TestUploadRetentionEmbedsStreamUpload(t *testing.T) {
+	retention := &ObjectRetention{Mode: ObjectLockCompliance}
+	entry := UploadRetention{Retention: retention}
+	entry.ID = "upload-id"
+
+	require.Equal(t, "upload-id", entry.ID)
+	require.Same(t, retention, entry.Retention)
+}
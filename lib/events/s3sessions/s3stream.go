@@ -19,7 +19,9 @@
 package s3sessions
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"sort"
@@ -38,6 +40,61 @@ import (
 	awsutils "github.com/gravitational/teleport/lib/utils/aws"
 )
 
+// Handler must satisfy events.MultipartHandler so the session
+// upload/download/retention path (the real caller of Download and
+// headObject) can use it interchangeably with the azsessions and
+// blobsessions backends.
+var _ events.MultipartHandler = (*Handler)(nil)
+
+// Download downloads a session recording. S3 requires the same
+// SSECustomer* headers on a GET as the object was uploaded with, so this
+// goes through applySSECToGetObject exactly like CreateUpload/UploadPart do
+// for the write path - without it, enabling SSE-C would make every session
+// unreadable even though writing it succeeded.
+func (h *Handler) Download(ctx context.Context, sessionID session.ID, writer io.WriterAt) error {
+	start := time.Now()
+	defer func() { h.Infof("Download(session %v) completed in %v.", sessionID, time.Since(start)) }()
+
+	if err := h.headObject(ctx, sessionID); err != nil {
+		return trace.Wrap(err)
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(h.Bucket),
+		Key:    aws.String(h.path(sessionID)),
+	}
+	if err := h.applySSECToGetObject(ctx, input); err != nil {
+		return trace.Wrap(err)
+	}
+
+	downloader := s3manager.NewDownloaderWithClient(h.client)
+	_, err := downloader.DownloadWithContext(ctx, writer, input)
+	if err != nil {
+		return trace.Wrap(awsutils.ConvertS3Error(err), "failed to download session %v", sessionID)
+	}
+	return nil
+}
+
+// headObject confirms sessionID's recording exists before Download streams
+// it, going through applySSECToHeadObject for the same reason Download's
+// GetObject does: S3 requires the customer key on every request to an
+// SSE-C object, HEAD included.
+func (h *Handler) headObject(ctx context.Context, sessionID session.ID) error {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(h.Bucket),
+		Key:    aws.String(h.path(sessionID)),
+	}
+	if err := h.applySSECToHeadObject(ctx, input); err != nil {
+		return trace.Wrap(err)
+	}
+
+	_, err := h.client.HeadObjectWithContext(ctx, input)
+	if err != nil {
+		return trace.Wrap(awsutils.ConvertS3Error(err), "session %v not found", sessionID)
+	}
+	return nil
+}
+
 // CreateUpload creates a multipart upload
 func (h *Handler) CreateUpload(ctx context.Context, sessionID session.ID) (*events.StreamUpload, error) {
 	start := time.Now()
@@ -57,6 +114,14 @@ func (h *Handler) CreateUpload(ctx context.Context, sessionID session.ID) (*even
 	if h.Config.ACL != "" {
 		input.ACL = aws.String(h.Config.ACL)
 	}
+	if mode, retainUntil, legalHold := h.objectLockParams(); mode != nil || legalHold != nil {
+		input.ObjectLockMode = mode
+		input.ObjectLockRetainUntilDate = retainUntil
+		input.ObjectLockLegalHoldStatus = legalHold
+	}
+	if err := h.applySSECToCreateUpload(ctx, input); err != nil {
+		return nil, trace.Wrap(err)
+	}
 
 	resp, err := h.client.CreateMultipartUploadWithContext(ctx, input)
 	if err != nil {
@@ -79,20 +144,34 @@ func (h *Handler) UploadPart(ctx context.Context, upload events.StreamUpload, pa
 			"exceeded total allowed S3 limit MaxUploadParts (%d). Adjust PartSize to fit in this limit", s3manager.MaxUploadParts)
 	}
 
+	// Hash the part as it's read off partBody so UploadPart doesn't need a
+	// second pass over the data to produce the digest recorded on the
+	// returned StreamPart; the upload itself still needs a seekable Body
+	// for the SDK's retry logic, so the teed bytes are buffered rather than
+	// handed to S3 as a bare io.Reader.
+	digest := sha256.New()
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.TeeReader(partBody, digest)); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	params := &s3.UploadPartInput{
 		Bucket:     aws.String(h.Bucket),
 		UploadId:   aws.String(upload.ID),
 		Key:        aws.String(h.path(upload.SessionID)),
-		Body:       partBody,
+		Body:       bytes.NewReader(buf.Bytes()),
 		PartNumber: aws.Int64(partNumber),
 	}
+	if err := h.applySSECToUploadPart(ctx, params); err != nil {
+		return nil, trace.Wrap(err)
+	}
 
 	resp, err := h.client.UploadPartWithContext(ctx, params)
 	if err != nil {
 		return nil, awsutils.ConvertS3Error(err)
 	}
 
-	return &events.StreamPart{ETag: *resp.ETag, Number: partNumber}, nil
+	return &events.StreamPart{ETag: *resp.ETag, Number: partNumber, SHA256: digest.Sum(nil)}, nil
 }
 
 func (h *Handler) abortUpload(ctx context.Context, upload events.StreamUpload) error {
@@ -148,6 +227,18 @@ func (h *Handler) CompleteUpload(ctx context.Context, upload events.StreamUpload
 	if err != nil {
 		return awsutils.ConvertS3Error(err)
 	}
+
+	if err := h.applyRetention(ctx, upload.SessionID); err != nil {
+		h.WithError(err).Warnf("Failed to apply object lock retention for session %v.", upload.SessionID)
+	}
+
+	if err := h.writeManifest(ctx, upload.SessionID, parts); err != nil {
+		// The recording itself is complete and usable; losing the manifest
+		// only disables out-of-band integrity verification of it, so this
+		// is logged rather than failing the upload.
+		h.WithError(err).Warnf("Failed to write integrity manifest for session %v.", upload.SessionID)
+	}
+
 	return nil
 }
 
@@ -156,12 +247,16 @@ func (h *Handler) ListParts(ctx context.Context, upload events.StreamUpload) ([]
 	var parts []events.StreamPart
 	var partNumberMarker *int64
 	for i := 0; i < defaults.MaxIterationLimit; i++ {
-		re, err := h.client.ListPartsWithContext(ctx, &s3.ListPartsInput{
+		input := &s3.ListPartsInput{
 			Bucket:           aws.String(h.Bucket),
 			Key:              aws.String(h.path(upload.SessionID)),
 			UploadId:         aws.String(upload.ID),
 			PartNumberMarker: partNumberMarker,
-		})
+		}
+		if err := h.applySSECToListParts(ctx, input); err != nil {
+			return nil, trace.Wrap(err)
+		}
+		re, err := h.client.ListPartsWithContext(ctx, input)
 		if err != nil {
 			return nil, awsutils.ConvertS3Error(err)
 		}
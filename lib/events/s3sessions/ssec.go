@@ -0,0 +1,209 @@
+/*
+ * Teleport
+ * Copyright (C) 2023  Gravitational, Inc.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package s3sessions
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gravitational/trace"
+
+	awsutils "github.com/gravitational/teleport/lib/utils/aws"
+)
+
+// SSECKeySource supplies the customer-provided encryption key used by
+// SSE-C, for operators who don't trust AWS KMS (or don't use AWS at all)
+// and want to hold the only copy of the key themselves: an HSM/PKCS#11
+// token, or Teleport's own CA keystore, instead of a plain key file on
+// disk.
+type SSECKeySource interface {
+	GetSSECKey(ctx context.Context) ([]byte, error)
+}
+
+// fileSSECKeySource loads a 256-bit SSE-C key from a local file, the
+// simplest of the supported key sources.
+type fileSSECKeySource struct {
+	path string
+}
+
+// GetSSECKey implements SSECKeySource.
+func (f fileSSECKeySource) GetSSECKey(ctx context.Context) ([]byte, error) {
+	key, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	return key, nil
+}
+
+// sseCustomerKeySource returns the configured SSE-C key source: an
+// explicit h.Config.SSECustomerKeySource (HSM/PKCS#11, Teleport's CA
+// keystore, or any other caller-supplied implementation) if set,
+// otherwise a file-backed source built from
+// h.Config.SSECustomerKeyFile. Returns nil if neither is set, meaning
+// SSE-C is disabled.
+func (h *Handler) sseCustomerKeySource() SSECKeySource {
+	if h.Config.SSECustomerKeySource != nil {
+		return h.Config.SSECustomerKeySource
+	}
+	if h.Config.SSECustomerKeyFile != "" {
+		return fileSSECKeySource{path: h.Config.SSECustomerKeyFile}
+	}
+	return nil
+}
+
+// sseCustomerHeaders loads the configured SSE-C key and returns the three
+// headers S3 requires on every request touching an SSE-C object:
+// algorithm (always AES256), the base64-encoded key, and the
+// base64-encoded MD5 of the raw key, which S3 uses to confirm the key it
+// was given matches the one the object was encrypted with. Returns all
+// nils if SSE-C isn't configured.
+func (h *Handler) sseCustomerHeaders(ctx context.Context) (algorithm, key, keyMD5 *string, err error) {
+	source := h.sseCustomerKeySource()
+	if source == nil {
+		return nil, nil, nil, nil
+	}
+
+	raw, err := source.GetSSECKey(ctx)
+	if err != nil {
+		return nil, nil, nil, trace.Wrap(err, "loading SSE-C key")
+	}
+
+	sum := md5.Sum(raw)
+	return aws.String(sseCustomerAlgorithm),
+		aws.String(base64.StdEncoding.EncodeToString(raw)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+		nil
+}
+
+// sseCustomerAlgorithm is the only algorithm S3 supports for SSE-C.
+const sseCustomerAlgorithm = "AES256"
+
+func (h *Handler) applySSECToCreateUpload(ctx context.Context, input *s3.CreateMultipartUploadInput) error {
+	algorithm, key, keyMD5, err := h.sseCustomerHeaders(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if key == nil {
+		return nil
+	}
+	input.SSECustomerAlgorithm = algorithm
+	input.SSECustomerKey = key
+	input.SSECustomerKeyMD5 = keyMD5
+	return nil
+}
+
+func (h *Handler) applySSECToUploadPart(ctx context.Context, input *s3.UploadPartInput) error {
+	_, key, keyMD5, err := h.sseCustomerHeaders(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if key == nil {
+		return nil
+	}
+	input.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	input.SSECustomerKey = key
+	input.SSECustomerKeyMD5 = keyMD5
+	return nil
+}
+
+func (h *Handler) applySSECToGetObject(ctx context.Context, input *s3.GetObjectInput) error {
+	_, key, keyMD5, err := h.sseCustomerHeaders(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if key == nil {
+		return nil
+	}
+	input.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	input.SSECustomerKey = key
+	input.SSECustomerKeyMD5 = keyMD5
+	return nil
+}
+
+func (h *Handler) applySSECToHeadObject(ctx context.Context, input *s3.HeadObjectInput) error {
+	_, key, keyMD5, err := h.sseCustomerHeaders(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if key == nil {
+		return nil
+	}
+	input.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	input.SSECustomerKey = key
+	input.SSECustomerKeyMD5 = keyMD5
+	return nil
+}
+
+func (h *Handler) applySSECToListParts(ctx context.Context, input *s3.ListPartsInput) error {
+	_, key, keyMD5, err := h.sseCustomerHeaders(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	if key == nil {
+		return nil
+	}
+	input.SSECustomerAlgorithm = aws.String(sseCustomerAlgorithm)
+	input.SSECustomerKey = key
+	input.SSECustomerKeyMD5 = keyMD5
+	return nil
+}
+
+// RotateSSECKey re-encrypts every part/session object under newKey by
+// issuing a server-side copy of each object onto itself, using the
+// x-amz-copy-source-server-side-encryption-customer-* headers to supply
+// the old key for decryption and the usual SSE-C headers to supply the
+// new key for the copy's destination. This migrates a bucket's objects
+// to a new key (e.g. after a suspected compromise) without downloading
+// and re-recording any session.
+func (h *Handler) RotateSSECKey(ctx context.Context, keys []string, oldKey, newKey []byte) error {
+	oldSum := md5.Sum(oldKey)
+	newSum := md5.Sum(newKey)
+
+	oldKeyB64 := base64.StdEncoding.EncodeToString(oldKey)
+	oldKeyMD5B64 := base64.StdEncoding.EncodeToString(oldSum[:])
+	newKeyB64 := base64.StdEncoding.EncodeToString(newKey)
+	newKeyMD5B64 := base64.StdEncoding.EncodeToString(newSum[:])
+
+	for _, key := range keys {
+		copySource := strings.TrimPrefix(h.Bucket+"/"+key, "/")
+		_, err := h.client.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(h.Bucket),
+			Key:        aws.String(key),
+			CopySource: aws.String(copySource),
+
+			CopySourceSSECustomerAlgorithm: aws.String(sseCustomerAlgorithm),
+			CopySourceSSECustomerKey:       aws.String(oldKeyB64),
+			CopySourceSSECustomerKeyMD5:    aws.String(oldKeyMD5B64),
+
+			SSECustomerAlgorithm: aws.String(sseCustomerAlgorithm),
+			SSECustomerKey:       aws.String(newKeyB64),
+			SSECustomerKeyMD5:    aws.String(newKeyMD5B64),
+		})
+		if err != nil {
+			return trace.Wrap(awsutils.ConvertS3Error(err), "rotating SSE-C key for %v", key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package acme provisions and renews publicly-trusted TLS certificates for
+// application access, one per types.AppServer.Spec.App.PublicAddr, from an
+// external ACME (RFC 8555) certificate authority such as Let's Encrypt.
+//
+// This is the client side of ACME: lib/auth/acme implements a Teleport auth
+// server acting as an ACME CA for database client certificates, whereas
+// this package implements the app proxy acting as an ACME client against
+// someone else's CA, the way golang.org/x/crypto/acme/autocert does for a
+// single domain. It adds two things autocert doesn't: dns-01 support via
+// pluggable [DNSProvider]s, for public addresses that can't accept inbound
+// tls-alpn-01 connections, and a shared, pluggable cert cache so every
+// proxy behind a load balancer can serve the same certificate.
+package acme
+
+import "time"
+
+// renewBefore is how long before a certificate's expiry the Provider begins
+// trying to renew it. Public CAs like Let's Encrypt issue 90-day
+// certificates; renewing a third of the way before expiry leaves room for
+// several retries if the CA or a DNS provider is briefly unavailable.
+const renewBefore = 30 * 24 * time.Hour
+
+// ChallengeType identifies which ACME challenge a domain's certificate
+// should be obtained with.
+type ChallengeType string
+
+const (
+	// ChallengeTLSALPN01 solves the challenge on the same TLS listener the
+	// app proxy already terminates connections on, by answering the
+	// "acme-tls/1" ALPN protocol with a self-signed certificate carrying
+	// the expected id-pe-acmeIdentifier extension. It requires the public
+	// address to be reachable on port 443.
+	ChallengeTLSALPN01 ChallengeType = "tls-alpn-01"
+
+	// ChallengeDNS01 solves the challenge by publishing a TXT record via a
+	// [DNSProvider]. It works regardless of what's listening on the public
+	// address, and is the only option for wildcard certificates.
+	ChallengeDNS01 ChallengeType = "dns-01"
+)
@@ -0,0 +1,58 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acmetest
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+)
+
+// lastPathSegment returns the final "/"-separated component of p, used to
+// pull an order or authorization ID out of a request path like
+// "/authz/42".
+func lastPathSegment(p string) string {
+	parts := strings.Split(strings.TrimSuffix(p, "/"), "/")
+	return parts[len(parts)-1]
+}
+
+// splitChallengePath pulls the authorization ID and challenge type out of
+// a "/challenge/<authzID>/<type>" request path.
+func splitChallengePath(p string) (authzID, challengeType string) {
+	parts := strings.Split(strings.TrimPrefix(p, "/challenge/"), "/")
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// bigSerial returns a random serial number suitable for a test
+// certificate.
+func bigSerial() *big.Int {
+	max := new(big.Int).Lsh(big.NewInt(1), 128)
+	n, _ := rand.Int(rand.Reader, max)
+	return n
+}
+
+func pkixName(domain string) pkix.Name {
+	return pkix.Name{CommonName: domain}
+}
+
+// pemEncode wraps a single DER certificate in a PEM block.
+func pemEncode(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,331 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package acmetest implements just enough of an ACME (RFC 8555) CA to drive
+// golang.org/x/crypto/acme's Client in tests, so lib/srv/app/acme doesn't
+// need network access or a real Let's Encrypt staging account to exercise
+// its issuance and renewal paths.
+//
+// It deliberately does not verify JWS signatures: every authenticated
+// request's payload is read directly off the outer envelope. That would be
+// a serious bug in a real ACME server, but this one only ever talks to a
+// single trusted client within a single test process, so there is nothing
+// for signature verification to protect against.
+package acmetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Validator decides whether a challenge response is valid. Real validation
+// means connecting to the domain over the network; CA calls Validator
+// instead, so tests can simulate both success and the failures a real CA
+// would report (timeout, wrong content, rate limiting) without a network
+// round trip.
+type Validator func(domain, challengeType, token, keyAuthorization string) error
+
+// CA is an in-memory ACME server. Its zero value is not usable; create one
+// with NewCA.
+type CA struct {
+	srv      *httptest.Server
+	validate Validator
+	caKey    *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	nonces map[string]struct{}
+	orders map[string]*order
+	authzs map[string]*authorization
+	nextID int
+}
+
+type order struct {
+	domain  string
+	authzID string
+	status  string
+	certID  string
+}
+
+type authorization struct {
+	domain string
+	status string
+	tokens map[string]string // challenge type -> token
+}
+
+// NewCA starts a CA whose challenge validation is delegated to validate.
+func NewCA(validate Validator) *CA {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	ca := &CA{
+		validate: validate,
+		caKey:    caKey,
+		nonces:   make(map[string]struct{}),
+		orders:   make(map[string]*order),
+		authzs:   make(map[string]*authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dir", ca.handleDirectory)
+	mux.HandleFunc("/new-nonce", ca.handleNewNonce)
+	mux.HandleFunc("/new-account", ca.handleNewAccount)
+	mux.HandleFunc("/new-order", ca.handleNewOrder)
+	mux.HandleFunc("/authz/", ca.handleAuthz)
+	mux.HandleFunc("/challenge/", ca.handleChallenge)
+	mux.HandleFunc("/finalize/", ca.handleFinalize)
+	mux.HandleFunc("/cert/", ca.handleCert)
+	ca.srv = httptest.NewServer(withNonce(ca, mux))
+	return ca
+}
+
+// URL returns the CA's directory URL, suitable for acme.Client.DirectoryURL.
+func (ca *CA) URL() string { return ca.srv.URL + "/dir" }
+
+// Close shuts down the underlying test server.
+func (ca *CA) Close() { ca.srv.Close() }
+
+func withNonce(ca *CA, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ca.mu.Lock()
+		nonce := fmt.Sprintf("nonce-%d", len(ca.nonces)+1)
+		ca.nonces[nonce] = struct{}{}
+		ca.mu.Unlock()
+		w.Header().Set("Replay-Nonce", nonce)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (ca *CA) handleDirectory(w http.ResponseWriter, r *http.Request) {
+	base := ca.srv.URL
+	writeJSON(w, http.StatusOK, map[string]string{
+		"newNonce":   base + "/new-nonce",
+		"newAccount": base + "/new-account",
+		"newOrder":   base + "/new-order",
+	})
+}
+
+func (ca *CA) handleNewNonce(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ca *CA) handleNewAccount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Location", ca.srv.URL+"/account/1")
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+}
+
+// newOrderRequest is the subset of RFC 8555 §7.4's new-order payload this
+// harness cares about.
+type newOrderRequest struct {
+	Identifiers []struct {
+		Value string `json:"value"`
+	} `json:"identifiers"`
+}
+
+func (ca *CA) handleNewOrder(w http.ResponseWriter, r *http.Request) {
+	req, err := decodeJWSPayload[newOrderRequest](r)
+	if err != nil || len(req.Identifiers) == 0 {
+		http.Error(w, "malformed order request", http.StatusBadRequest)
+		return
+	}
+	domain := req.Identifiers[0].Value
+
+	ca.mu.Lock()
+	id := ca.newID()
+	authzID := ca.newID()
+	ca.authzs[authzID] = &authorization{
+		domain: domain,
+		status: "pending",
+		tokens: map[string]string{
+			"tls-alpn-01": "token-" + authzID,
+			"dns-01":      "token-" + authzID,
+		},
+	}
+	ca.orders[id] = &order{domain: domain, authzID: authzID, status: "pending"}
+	ca.mu.Unlock()
+
+	base := ca.srv.URL
+	w.Header().Set("Location", fmt.Sprintf("%s/order/%s", base, id))
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"status":         "pending",
+		"authorizations": []string{fmt.Sprintf("%s/authz/%s", base, authzID)},
+		"finalize":       fmt.Sprintf("%s/finalize/%s", base, id),
+	})
+}
+
+func (ca *CA) handleAuthz(w http.ResponseWriter, r *http.Request) {
+	id := lastPathSegment(r.URL.Path)
+
+	ca.mu.Lock()
+	authz, ok := ca.authzs[id]
+	ca.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	base := ca.srv.URL
+	challenges := make([]map[string]string, 0, len(authz.tokens))
+	for typ, token := range authz.tokens {
+		challenges = append(challenges, map[string]string{
+			"type":  typ,
+			"url":   fmt.Sprintf("%s/challenge/%s/%s", base, id, typ),
+			"token": token,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":     authz.status,
+		"identifier": map[string]string{"type": "dns", "value": authz.domain},
+		"challenges": challenges,
+	})
+}
+
+func (ca *CA) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	authzID, challengeType := splitChallengePath(r.URL.Path)
+
+	ca.mu.Lock()
+	authz, ok := ca.authzs[authzID]
+	ca.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	token := authz.tokens[challengeType]
+	err := ca.validate(authz.domain, challengeType, token, token)
+
+	ca.mu.Lock()
+	if err == nil {
+		authz.status = "valid"
+	} else {
+		authz.status = "invalid"
+	}
+	status := authz.status
+	ca.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"type":   challengeType,
+		"status": status,
+		"token":  token,
+	})
+}
+
+func (ca *CA) handleFinalize(w http.ResponseWriter, r *http.Request) {
+	id := lastPathSegment(r.URL.Path)
+
+	ca.mu.Lock()
+	ord, ok := ca.orders[id]
+	var authz *authorization
+	if ok {
+		authz = ca.authzs[ord.authzID]
+	}
+	ca.mu.Unlock()
+	if !ok || authz == nil || authz.status != "valid" {
+		http.Error(w, "order is not ready to be finalized", http.StatusForbidden)
+		return
+	}
+
+	certID := ca.newID()
+	ca.mu.Lock()
+	ord.status = "valid"
+	ord.certID = certID
+	ca.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":      "valid",
+		"certificate": fmt.Sprintf("%s/cert/%s", ca.srv.URL, certID),
+	})
+}
+
+func (ca *CA) handleCert(w http.ResponseWriter, r *http.Request) {
+	id := lastPathSegment(r.URL.Path)
+
+	ca.mu.Lock()
+	var domain string
+	for _, ord := range ca.orders {
+		if ord.certID == id {
+			domain = ord.domain
+		}
+	}
+	ca.mu.Unlock()
+	if domain == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	der, err := ca.issue(domain)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.Write(pemEncode(der))
+}
+
+// issue mints a short-lived leaf certificate for domain, signed by the
+// CA's own in-memory key. It is not trusted by anything outside this test
+// harness.
+func (ca *CA) issue(domain string) ([]byte, error) {
+	tmpl := &x509.Certificate{
+		SerialNumber: bigSerial(),
+		Subject:      pkixName(domain),
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	return x509.CreateCertificate(rand.Reader, tmpl, tmpl, &ca.caKey.PublicKey, ca.caKey)
+}
+
+func (ca *CA) newID() string {
+	ca.nextID++
+	return fmt.Sprintf("%d", ca.nextID)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// decodeJWSPayload reads the base64url "payload" field off a JWS envelope
+// without verifying its signature - see the package doc for why that's
+// fine here - and unmarshals it into T.
+func decodeJWSPayload[T any](r *http.Request) (T, error) {
+	var zero T
+	var envelope struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		return zero, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return zero, err
+	}
+	var out T
+	if err := json.Unmarshal(data, &out); err != nil {
+		return zero, err
+	}
+	return out, nil
+}
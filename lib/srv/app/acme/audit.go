@@ -0,0 +1,78 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+
+	apievents "github.com/gravitational/teleport/api/types/events"
+	"github.com/gravitational/teleport/lib/events"
+)
+
+// Emitter is the subset of auth.ClientI a Provider needs in order to record
+// certificate issuance, renewal, and failure as audit events.
+type Emitter interface {
+	EmitAuditEvent(ctx context.Context, event apievents.AuditEvent) error
+}
+
+// auditIssued records a successful initial issuance or renewal for domain.
+// renewal distinguishes the two in the emitted event, since a renewal
+// failure is more actionable (an existing certificate is about to expire)
+// than a first-issuance failure (the app simply isn't reachable yet).
+func auditIssued(ctx context.Context, emitter Emitter, log logger, domain string, challenge ChallengeType, renewal bool) {
+	emitCertEvent(ctx, emitter, log, domain, challenge, renewal, nil)
+}
+
+// auditFailed records a failed issuance or renewal attempt for domain.
+func auditFailed(ctx context.Context, emitter Emitter, log logger, domain string, challenge ChallengeType, renewal bool, cause error) {
+	emitCertEvent(ctx, emitter, log, domain, challenge, renewal, cause)
+}
+
+func emitCertEvent(ctx context.Context, emitter Emitter, log logger, domain string, challenge ChallengeType, renewal bool, cause error) {
+	event := &apievents.AppACMECertificate{
+		Metadata: apievents.Metadata{
+			Type: events.AppACMECertificateEvent,
+			Code: appACMECertificateCode(renewal, cause),
+		},
+		PublicAddr:    domain,
+		ChallengeType: string(challenge),
+		Renewal:       renewal,
+		Status:        apievents.Status{Success: cause == nil},
+	}
+	if cause != nil {
+		event.Status.Error = cause.Error()
+	}
+	if err := emitter.EmitAuditEvent(ctx, event); err != nil {
+		log.Warnf("Failed to emit app ACME certificate audit event for %v: %v.", domain, err)
+	}
+}
+
+func appACMECertificateCode(renewal bool, cause error) string {
+	switch {
+	case cause != nil:
+		return events.AppACMECertificateFailureCode
+	case renewal:
+		return events.AppACMECertificateRenewalCode
+	default:
+		return events.AppACMECertificateIssuedCode
+	}
+}
+
+// logger is the subset of logrus.FieldLogger a Provider needs, kept small
+// so tests can substitute a no-op implementation without pulling in a real
+// logger.
+type logger interface {
+	Warnf(format string, args ...any)
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"math/rand"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// minRetryBackoff is the base of retryBackoff's exponential backoff:
+	// the first retry waits a random duration below it, and each further
+	// failed attempt doubles that ceiling.
+	minRetryBackoff = 10 * time.Second
+	// maxRetryBackoff caps how long a single retry waits, regardless of
+	// how many consecutive failures an order has seen.
+	maxRetryBackoff = 15 * time.Minute
+)
+
+// retryBackoff computes how long to wait before retrying a failed order,
+// given how many attempts have already failed. It honors a rate-limited
+// CA's Retry-After value when err carries one (surfaced by the
+// golang.org/x/crypto/acme client as *acme.RateLimitError), and otherwise
+// falls back to exponential backoff with full jitter, so many proxies
+// retrying the same renewal after a transient failure don't all retry in
+// lockstep.
+func retryBackoff(attempt int, err error) time.Duration {
+	if rle, ok := err.(*acme.RateLimitError); ok && rle.Retry.After(time.Now()) {
+		return time.Until(rle.Retry)
+	}
+
+	backoff := minRetryBackoff << attempt
+	if backoff <= 0 || backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return time.Duration(rand.Int63n(int64(backoff)))
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+)
+
+// CertCache stores the most recently issued certificate for each domain.
+// Implementations that back it with a shared store (Redis, DynamoDB, the
+// cluster backend) let every proxy behind a load balancer serve a
+// certificate issued by whichever one of them ran the renewal, instead of
+// each proxy independently hitting the CA's rate limits for the same
+// domain.
+//
+// This mirrors the Backend split in lib/web/app/sessioncache: CertCache
+// knows nothing about ACME, renewal timing, or challenge solving, only how
+// to store and retrieve a certificate by domain.
+type CertCache interface {
+	// Get returns the certificate cached for domain, or ok == false if
+	// there is none.
+	Get(ctx context.Context, domain string) (cert *tls.Certificate, ok bool, err error)
+	// Put stores cert for domain, replacing any certificate already
+	// there.
+	Put(ctx context.Context, domain string, cert *tls.Certificate) error
+}
+
+// MemoryCertCache is an in-process CertCache. It is the default for a
+// single proxy and shares nothing with other proxies in the cluster.
+type MemoryCertCache struct {
+	mu    sync.RWMutex
+	certs map[string]*tls.Certificate
+}
+
+// NewMemoryCertCache creates an empty MemoryCertCache.
+func NewMemoryCertCache() *MemoryCertCache {
+	return &MemoryCertCache{certs: make(map[string]*tls.Certificate)}
+}
+
+// Get implements CertCache.
+func (m *MemoryCertCache) Get(_ context.Context, domain string) (*tls.Certificate, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cert, ok := m.certs[domain]
+	return cert, ok, nil
+}
+
+// Put implements CertCache.
+func (m *MemoryCertCache) Put(_ context.Context, domain string, cert *tls.Certificate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.certs[domain] = cert
+	return nil
+}
+
+var _ CertCache = (*MemoryCertCache)(nil)
@@ -0,0 +1,44 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCertCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCertCache()
+
+	_, ok, err := c.Get(ctx, "app.example.com")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	cert := &tls.Certificate{Certificate: [][]byte{[]byte("der")}}
+	require.NoError(t, c.Put(ctx, "app.example.com", cert))
+
+	got, ok, err := c.Get(ctx, "app.example.com")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Same(t, cert, got)
+
+	_, ok, err = c.Get(ctx, "other.example.com")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
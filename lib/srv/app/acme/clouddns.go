@@ -0,0 +1,71 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"fmt"
+
+	dns "google.golang.org/api/dns/v1"
+
+	"github.com/gravitational/trace"
+)
+
+// CloudDNSProvider is a [DNSProvider] backed by a Google Cloud DNS managed
+// zone.
+type CloudDNSProvider struct {
+	service     *dns.Service
+	project     string
+	managedZone string
+}
+
+// NewCloudDNSProvider creates a CloudDNSProvider that manages records in
+// managedZone, within project, using service.
+func NewCloudDNSProvider(service *dns.Service, project, managedZone string) *CloudDNSProvider {
+	return &CloudDNSProvider{service: service, project: project, managedZone: managedZone}
+}
+
+// Present implements DNSProvider.
+func (c *CloudDNSProvider) Present(ctx context.Context, fqdn, value string) error {
+	change := &dns.Change{
+		Additions: []*dns.ResourceRecordSet{c.recordSet(fqdn, value)},
+	}
+	if _, err := c.service.Changes.Create(c.project, c.managedZone, change).Context(ctx).Do(); err != nil {
+		return trace.Wrap(err, "creating Cloud DNS TXT record %s", fqdn)
+	}
+	return nil
+}
+
+// CleanUp implements DNSProvider.
+func (c *CloudDNSProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	change := &dns.Change{
+		Deletions: []*dns.ResourceRecordSet{c.recordSet(fqdn, value)},
+	}
+	if _, err := c.service.Changes.Create(c.project, c.managedZone, change).Context(ctx).Do(); err != nil {
+		return trace.Wrap(err, "removing Cloud DNS TXT record %s", fqdn)
+	}
+	return nil
+}
+
+func (c *CloudDNSProvider) recordSet(fqdn, value string) *dns.ResourceRecordSet {
+	return &dns.ResourceRecordSet{
+		Name:    fqdn,
+		Type:    "TXT",
+		Ttl:     60,
+		Rrdatas: []string{fmt.Sprintf("%q", value)},
+	}
+}
+
+var _ DNSProvider = (*CloudDNSProvider)(nil)
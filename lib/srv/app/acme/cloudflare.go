@@ -0,0 +1,74 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+
+	cloudflare "github.com/cloudflare/cloudflare-go"
+	"github.com/gravitational/trace"
+)
+
+// CloudflareProvider is a [DNSProvider] backed by a Cloudflare-managed
+// zone.
+type CloudflareProvider struct {
+	api    *cloudflare.API
+	zoneID string
+}
+
+// NewCloudflareProvider creates a CloudflareProvider that manages records
+// in the zone identified by zoneID using api.
+func NewCloudflareProvider(api *cloudflare.API, zoneID string) *CloudflareProvider {
+	return &CloudflareProvider{api: api, zoneID: zoneID}
+}
+
+// Present implements DNSProvider.
+func (c *CloudflareProvider) Present(ctx context.Context, fqdn, value string) error {
+	rc := cloudflare.ZoneIdentifier(c.zoneID)
+	_, err := c.api.CreateDNSRecord(ctx, rc, cloudflare.CreateDNSRecordParams{
+		Type:    "TXT",
+		Name:    fqdn,
+		Content: value,
+		TTL:     60,
+	})
+	if err != nil {
+		return trace.Wrap(err, "creating Cloudflare TXT record %s", fqdn)
+	}
+	return nil
+}
+
+// CleanUp implements DNSProvider.
+func (c *CloudflareProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	rc := cloudflare.ZoneIdentifier(c.zoneID)
+	records, _, err := c.api.ListDNSRecords(ctx, rc, cloudflare.ListDNSRecordsParams{
+		Type: "TXT",
+		Name: fqdn,
+	})
+	if err != nil {
+		return trace.Wrap(err, "listing Cloudflare TXT records for %s", fqdn)
+	}
+
+	for _, record := range records {
+		if record.Content != value {
+			continue
+		}
+		if err := c.api.DeleteDNSRecord(ctx, rc, record.ID); err != nil {
+			return trace.Wrap(err, "deleting Cloudflare TXT record %s", fqdn)
+		}
+	}
+	return nil
+}
+
+var _ DNSProvider = (*CloudflareProvider)(nil)
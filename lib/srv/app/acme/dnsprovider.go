@@ -0,0 +1,35 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import "context"
+
+// DNSProvider publishes and removes the TXT record a dns-01 challenge is
+// validated against. Implementations wrap a specific DNS host's API;
+// Route53Provider, CloudDNSProvider, and CloudflareProvider cover the hosts
+// Teleport customers use most.
+type DNSProvider interface {
+	// Present publishes a TXT record named fqdn (already in the
+	// "_acme-challenge.<domain>." form the CA expects) with the given
+	// value, and returns once the write has been accepted by the
+	// provider's API. It does not wait for the record to propagate; that
+	// is the caller's responsibility.
+	Present(ctx context.Context, fqdn, value string) error
+
+	// CleanUp removes the TXT record created by a prior Present call. It
+	// is called once validation has finished, successfully or not, so
+	// providers should not error if the record is already gone.
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
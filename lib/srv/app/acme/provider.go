@@ -0,0 +1,331 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"golang.org/x/crypto/acme"
+)
+
+// Config configures a Provider.
+type Config struct {
+	// Client is the ACME client to issue and renew certificates with. Its
+	// DirectoryURL and Key must already be set.
+	Client *acme.Client
+	// Cache stores issued certificates, shared across every proxy that
+	// serves the same PublicAddrs if Cache is backed by Redis or DynamoDB
+	// rather than NewMemoryCertCache.
+	Cache CertCache
+	// Solvers are tried, in order, against the challenge types offered by
+	// each domain's authorization; the first one whose ChallengeType
+	// matches an offered challenge is used. Configure a TLSALPN01Solver, a
+	// DNS01Solver, or both.
+	Solvers []ChallengeSolver
+	// Emitter records issuance, renewal, and failure as audit events.
+	Emitter Emitter
+	// Log receives warnings about failed audit event delivery and
+	// individual renewal attempts.
+	Log logger
+	// Clock is used to evaluate certificate expiry. Defaults to the real
+	// clock; overridden in tests.
+	Clock clockwork.Clock
+}
+
+// CheckAndSetDefaults validates c and fills in defaults.
+func (c *Config) CheckAndSetDefaults() error {
+	if c.Client == nil {
+		return trace.BadParameter("Client is required")
+	}
+	if len(c.Solvers) == 0 {
+		return trace.BadParameter("at least one ChallengeSolver is required")
+	}
+	if c.Emitter == nil {
+		return trace.BadParameter("Emitter is required")
+	}
+	if c.Cache == nil {
+		c.Cache = NewMemoryCertCache()
+	}
+	if c.Log == nil {
+		c.Log = noopLogger{}
+	}
+	if c.Clock == nil {
+		c.Clock = clockwork.NewRealClock()
+	}
+	return nil
+}
+
+// Provider issues and renews publicly-trusted certificates for application
+// public addresses, and serves them to the app proxy's TLS listener through
+// GetCertificate.
+type Provider struct {
+	cfg Config
+
+	mu      sync.Mutex
+	domains map[string]struct{}
+}
+
+// NewProvider creates a Provider from cfg.
+func NewProvider(cfg Config) (*Provider, error) {
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return &Provider{cfg: cfg, domains: make(map[string]struct{})}, nil
+}
+
+// Manage adds domain to the set of public addresses this Provider keeps a
+// certificate current for. It is idempotent; calling it for a domain
+// already managed is a no-op. It does not block on issuing a certificate -
+// that happens the next time Run ticks, or lazily on the first
+// GetCertificate call if no cached certificate exists yet.
+func (p *Provider) Manage(domain string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.domains[domain] = struct{}{}
+}
+
+// GetCertificate implements the tls.Config.GetCertificate hook. It answers
+// tls-alpn-01 challenges for domains currently being validated, and
+// otherwise serves the cached certificate for the requested SNI, issuing
+// one synchronously on a cold cache.
+func (p *Provider) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	domain := hello.ServerName
+	if domain == "" {
+		return nil, trace.BadParameter("missing server name")
+	}
+
+	for _, proto := range hello.SupportedProtos {
+		if proto != acme.ALPNProto {
+			continue
+		}
+		for _, solver := range p.cfg.Solvers {
+			alpnSolver, ok := solver.(*TLSALPN01Solver)
+			if !ok {
+				continue
+			}
+			if cert, ok := alpnSolver.ChallengeCert(domain); ok {
+				return cert, nil
+			}
+		}
+		return nil, trace.NotFound("no in-progress tls-alpn-01 challenge for %v", domain)
+	}
+
+	ctx := hello.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cert, ok, err := p.cfg.Cache.Get(ctx, domain)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if ok && !certNeedsRenewal(cert, p.cfg.Clock) {
+		return cert, nil
+	}
+
+	cert, err = p.issue(ctx, domain, ok)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return cert, nil
+}
+
+// TLSConfig returns base, or a fresh *tls.Config if base is nil, configured
+// to serve certificates from p: GetCertificate is wired to p.GetCertificate,
+// and acme.ALPNProto is added to NextProtos so tls-alpn-01 challenges can be
+// answered on the same listener application traffic is served on. The app
+// proxy's TLS listener uses this to terminate connections for the domains p
+// manages.
+func (p *Provider) TLSConfig(base *tls.Config) *tls.Config {
+	var cfg *tls.Config
+	if base != nil {
+		cfg = base.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	cfg.GetCertificate = p.GetCertificate
+
+	for _, proto := range cfg.NextProtos {
+		if proto == acme.ALPNProto {
+			return cfg
+		}
+	}
+	cfg.NextProtos = append(append([]string(nil), cfg.NextProtos...), acme.ALPNProto)
+	return cfg
+}
+
+// Run periodically renews every managed domain's certificate, stopping
+// when ctx is canceled. Renewal for each domain is attempted independently
+// so that one domain's CA or DNS provider trouble doesn't delay the
+// others.
+func (p *Provider) Run(ctx context.Context, checkInterval time.Duration) {
+	ticker := p.cfg.Clock.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+			p.renewDue(ctx)
+		}
+	}
+}
+
+func (p *Provider) renewDue(ctx context.Context) {
+	p.mu.Lock()
+	domains := make([]string, 0, len(p.domains))
+	for domain := range p.domains {
+		domains = append(domains, domain)
+	}
+	p.mu.Unlock()
+
+	for _, domain := range domains {
+		cert, ok, err := p.cfg.Cache.Get(ctx, domain)
+		if err != nil || !ok || certNeedsRenewal(cert, p.cfg.Clock) {
+			if _, err := p.issue(ctx, domain, ok); err != nil {
+				p.cfg.Log.Warnf("Failed to renew app certificate for %v: %v.", domain, err)
+			}
+		}
+	}
+}
+
+// issue obtains a fresh certificate for domain, retrying transient
+// failures with jittered backoff, and caches the result. renewal is used
+// only to label the audit event.
+func (p *Provider) issue(ctx context.Context, domain string, renewal bool) (*tls.Certificate, error) {
+	var lastErr error
+	for attempt := 0; attempt < maxIssueAttempts; attempt++ {
+		cert, challenge, err := p.issueOnce(ctx, domain)
+		if err == nil {
+			auditIssued(ctx, p.cfg.Emitter, p.cfg.Log, domain, challenge, renewal)
+			if putErr := p.cfg.Cache.Put(ctx, domain, cert); putErr != nil {
+				p.cfg.Log.Warnf("Failed to cache issued certificate for %v: %v.", domain, putErr)
+			}
+			return cert, nil
+		}
+
+		lastErr = err
+		select {
+		case <-ctx.Done():
+			return nil, trace.Wrap(ctx.Err())
+		case <-p.cfg.Clock.After(retryBackoff(attempt, err)):
+		}
+	}
+
+	auditFailed(ctx, p.cfg.Emitter, p.cfg.Log, domain, "", renewal, lastErr)
+	return nil, trace.Wrap(lastErr, "issuing certificate for %v", domain)
+}
+
+// maxIssueAttempts bounds how many times issue retries a single renewal
+// before giving up and reporting failure; Run will try again on its next
+// tick regardless.
+const maxIssueAttempts = 5
+
+// issueOnce drives a single attempt at the ACME authorize/solve/finalize
+// flow for domain, returning the challenge type that was used so it can be
+// recorded in the audit event.
+func (p *Provider) issueOnce(ctx context.Context, domain string) (*tls.Certificate, ChallengeType, error) {
+	authz, err := p.cfg.Client.Authorize(ctx, domain)
+	if err != nil {
+		return nil, "", trace.Wrap(err, "authorizing %v", domain)
+	}
+	if authz.Status == acme.StatusValid {
+		return p.finalize(ctx, domain)
+	}
+
+	solver, chal, err := p.selectSolver(authz)
+	if err != nil {
+		return nil, "", trace.Wrap(err)
+	}
+
+	cleanup, err := solver.Solve(ctx, p.cfg.Client, domain, chal)
+	if err != nil {
+		return nil, solver.ChallengeType(), trace.Wrap(err, "solving %v challenge for %v", solver.ChallengeType(), domain)
+	}
+	defer cleanup(context.Background())
+
+	if _, err := p.cfg.Client.Accept(ctx, chal); err != nil {
+		return nil, solver.ChallengeType(), trace.Wrap(err, "accepting %v challenge for %v", solver.ChallengeType(), domain)
+	}
+	if _, err := p.cfg.Client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return nil, solver.ChallengeType(), trace.Wrap(err, "waiting for %v authorization", domain)
+	}
+
+	cert, _, err := p.finalize(ctx, domain)
+	return cert, solver.ChallengeType(), trace.Wrap(err)
+}
+
+func (p *Provider) finalize(ctx context.Context, domain string) (*tls.Certificate, ChallengeType, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", trace.Wrap(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{domain}}, key)
+	if err != nil {
+		return nil, "", trace.Wrap(err)
+	}
+
+	der, _, err := p.cfg.Client.CreateCert(ctx, csr, 0, true)
+	if err != nil {
+		return nil, "", trace.Wrap(err, "finalizing certificate for %v", domain)
+	}
+
+	cert := &tls.Certificate{Certificate: der, PrivateKey: key}
+	for _, chain := range der {
+		leaf, err := x509.ParseCertificate(chain)
+		if err == nil {
+			cert.Leaf = leaf
+			break
+		}
+	}
+	return cert, "", nil
+}
+
+// selectSolver picks the first configured ChallengeSolver whose
+// ChallengeType matches one of authz's pending challenges.
+func (p *Provider) selectSolver(authz *acme.Authorization) (ChallengeSolver, *acme.Challenge, error) {
+	for _, solver := range p.cfg.Solvers {
+		for _, chal := range authz.Challenges {
+			if string(solver.ChallengeType()) == chal.Type {
+				return solver, chal, nil
+			}
+		}
+	}
+	return nil, nil, trace.BadParameter("no configured challenge solver matches the challenges offered for %v", authz.Identifier.Value)
+}
+
+// certNeedsRenewal reports whether cert should be renewed now, based on
+// its leaf's NotAfter and renewBefore.
+func certNeedsRenewal(cert *tls.Certificate, clock clockwork.Clock) bool {
+	if cert == nil || cert.Leaf == nil {
+		return true
+	}
+	return clock.Now().Add(renewBefore).After(cert.Leaf.NotAfter)
+}
+
+// noopLogger discards warnings; the default when Config.Log is unset.
+type noopLogger struct{}
+
+func (noopLogger) Warnf(string, ...any) {}
@@ -0,0 +1,145 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+
+	apievents "github.com/gravitational/teleport/api/types/events"
+	"github.com/gravitational/teleport/lib/srv/app/acme/acmetest"
+)
+
+type fakeEmitter struct {
+	events []apievents.AuditEvent
+}
+
+func (f *fakeEmitter) EmitAuditEvent(_ context.Context, event apievents.AuditEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func newTestClient(t *testing.T, ca *acmetest.CA) *acme.Client {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return &acme.Client{Key: key, DirectoryURL: ca.URL()}
+}
+
+func TestProviderIssuesCertificateViaTLSALPN01(t *testing.T) {
+	ca := acmetest.NewCA(func(domain, challengeType, token, keyAuth string) error {
+		require.Equal(t, "app.example.com", domain)
+		require.Equal(t, "tls-alpn-01", challengeType)
+		return nil
+	})
+	t.Cleanup(ca.Close)
+
+	emitter := &fakeEmitter{}
+	provider, err := NewProvider(Config{
+		Client:  newTestClient(t, ca),
+		Solvers: []ChallengeSolver{NewTLSALPN01Solver()},
+		Emitter: emitter,
+	})
+	require.NoError(t, err)
+	provider.Manage("app.example.com")
+
+	cert, err := provider.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.example.com"})
+	require.NoError(t, err)
+	require.NotNil(t, cert)
+	require.NotEmpty(t, emitter.events)
+
+	cached, ok, err := provider.cfg.Cache.Get(context.Background(), "app.example.com")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, cert, cached)
+}
+
+func TestSelectSolverRejectsUnofferedChallenge(t *testing.T) {
+	provider, err := NewProvider(Config{
+		Client:  &acme.Client{},
+		Solvers: []ChallengeSolver{NewDNS01Solver(&noopDNSProvider{})},
+		Emitter: &fakeEmitter{},
+	})
+	require.NoError(t, err)
+
+	authz := &acme.Authorization{
+		Identifier: acme.AuthzID{Value: "app.example.com"},
+		Challenges: []*acme.Challenge{{Type: "tls-alpn-01", Token: "tok"}},
+	}
+	_, _, err = provider.selectSolver(authz)
+	require.Error(t, err, "no configured solver answers tls-alpn-01, so selection should fail rather than silently picking a mismatched one")
+}
+
+type noopDNSProvider struct{}
+
+func (noopDNSProvider) Present(context.Context, string, string) error { return nil }
+func (noopDNSProvider) CleanUp(context.Context, string, string) error { return nil }
+
+func TestCertNeedsRenewal(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+
+	require.True(t, certNeedsRenewal(nil, clock))
+
+	cert := &tls.Certificate{Leaf: &x509.Certificate{NotAfter: clock.Now().Add(20 * 24 * time.Hour)}}
+	require.True(t, certNeedsRenewal(cert, clock), "a cert expiring within renewBefore should need renewal")
+
+	cert.Leaf.NotAfter = clock.Now().Add(89 * 24 * time.Hour)
+	require.False(t, certNeedsRenewal(cert, clock))
+}
+
+func TestProviderTLSConfigWiresGetCertificateAndALPNProto(t *testing.T) {
+	provider, err := NewProvider(Config{
+		Client:  &acme.Client{},
+		Solvers: []ChallengeSolver{NewDNS01Solver(&noopDNSProvider{})},
+		Emitter: &fakeEmitter{},
+	})
+	require.NoError(t, err)
+
+	cfg := provider.TLSConfig(&tls.Config{NextProtos: []string{"h2", "http/1.1"}})
+	require.Contains(t, cfg.NextProtos, acme.ALPNProto)
+	require.Contains(t, cfg.NextProtos, "h2")
+	require.NotNil(t, cfg.GetCertificate)
+
+	_, err = cfg.GetCertificate(&tls.ClientHelloInfo{})
+	require.Error(t, err, "GetCertificate should delegate to provider.GetCertificate, which rejects an empty server name")
+
+	// Calling TLSConfig again on the result must not duplicate the ALPN
+	// proto.
+	cfg = provider.TLSConfig(cfg)
+	count := 0
+	for _, proto := range cfg.NextProtos {
+		if proto == acme.ALPNProto {
+			count++
+		}
+	}
+	require.Equal(t, 1, count)
+}
+
+func TestRetryBackoffIsBounded(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		d := retryBackoff(attempt, nil)
+		require.GreaterOrEqual(t, d, time.Duration(0))
+		require.LessOrEqual(t, d, maxRetryBackoff)
+	}
+}
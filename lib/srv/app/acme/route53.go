@@ -0,0 +1,77 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/gravitational/trace"
+)
+
+// route53TTL is the TTL set on challenge TXT records. It only needs to
+// outlive validation, so it is kept short rather than matching the zone's
+// usual record TTLs.
+const route53TTL = 60
+
+// Route53Provider is a [DNSProvider] backed by an AWS Route53 hosted zone.
+type Route53Provider struct {
+	client       *route53.Client
+	hostedZoneID string
+}
+
+// NewRoute53Provider creates a Route53Provider that manages records in
+// hostedZoneID using client.
+func NewRoute53Provider(client *route53.Client, hostedZoneID string) *Route53Provider {
+	return &Route53Provider{client: client, hostedZoneID: hostedZoneID}
+}
+
+// Present implements DNSProvider.
+func (r *Route53Provider) Present(ctx context.Context, fqdn, value string) error {
+	return trace.Wrap(r.changeRecord(ctx, types.ChangeActionUpsert, fqdn, value))
+}
+
+// CleanUp implements DNSProvider.
+func (r *Route53Provider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return trace.Wrap(r.changeRecord(ctx, types.ChangeActionDelete, fqdn, value))
+}
+
+func (r *Route53Provider) changeRecord(ctx context.Context, action types.ChangeAction, fqdn, value string) error {
+	_, err := r.client.ChangeResourceRecordSets(ctx, &route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(r.hostedZoneID),
+		ChangeBatch: &types.ChangeBatch{
+			Changes: []types.Change{{
+				Action: action,
+				ResourceRecordSet: &types.ResourceRecordSet{
+					Name: aws.String(fqdn),
+					Type: types.RRTypeTxt,
+					TTL:  aws.Int64(route53TTL),
+					ResourceRecords: []types.ResourceRecord{
+						{Value: aws.String(fmt.Sprintf("%q", value))},
+					},
+				},
+			}},
+		},
+	})
+	if err != nil {
+		return trace.Wrap(err, "updating Route53 TXT record %s", fqdn)
+	}
+	return nil
+}
+
+var _ DNSProvider = (*Route53Provider)(nil)
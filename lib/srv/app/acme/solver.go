@@ -0,0 +1,143 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acme
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"github.com/gravitational/trace"
+)
+
+// dnsPropagationWait bounds how long a DNS01Solver gives a freshly
+// published TXT record to propagate before asking the CA to validate it.
+// It is deliberately generous; most providers converge in seconds, but a
+// CA retries validation on its own schedule, so a conservative wait here
+// just avoids burning one of those retries on a record that hasn't landed
+// yet.
+const dnsPropagationWait = 30 * time.Second
+
+// ChallengeSolver proves control of domain to the CA by satisfying one of
+// the challenges in an authorization, then returns a cleanup func to
+// reverse whatever it set up once validation has finished.
+type ChallengeSolver interface {
+	// ChallengeType identifies which challenge in an authorization's
+	// Challenges list this solver answers.
+	ChallengeType() ChallengeType
+
+	// Solve prepares the response to chal - publishing a TXT record or
+	// installing a certificate the proxy's TLS listener will present -
+	// and returns a func that undoes it.
+	Solve(ctx context.Context, client *acme.Client, domain string, chal *acme.Challenge) (cleanup func(context.Context), err error)
+}
+
+// TLSALPN01Solver solves the tls-alpn-01 challenge (RFC 8737) by holding
+// the self-signed challenge certificate until [Provider.GetCertificate]
+// fetches it through ChallengeCert, so it gets served by the same TLS
+// listener the app proxy already terminates connections on whenever a
+// ClientHello negotiates the "acme-tls/1" ALPN protocol.
+type TLSALPN01Solver struct {
+	mu    sync.Mutex
+	certs map[string]*tls.Certificate
+}
+
+// NewTLSALPN01Solver creates a TLSALPN01Solver.
+func NewTLSALPN01Solver() *TLSALPN01Solver {
+	return &TLSALPN01Solver{certs: make(map[string]*tls.Certificate)}
+}
+
+// ChallengeType implements ChallengeSolver.
+func (s *TLSALPN01Solver) ChallengeType() ChallengeType { return ChallengeTLSALPN01 }
+
+// Solve implements ChallengeSolver.
+func (s *TLSALPN01Solver) Solve(ctx context.Context, client *acme.Client, domain string, chal *acme.Challenge) (func(context.Context), error) {
+	cert, err := client.TLSALPN01ChallengeCert(chal.Token, domain)
+	if err != nil {
+		return nil, trace.Wrap(err, "building tls-alpn-01 challenge certificate for %s", domain)
+	}
+
+	s.mu.Lock()
+	s.certs[domain] = &cert
+	s.mu.Unlock()
+
+	cleanup := func(context.Context) {
+		s.mu.Lock()
+		delete(s.certs, domain)
+		s.mu.Unlock()
+	}
+	return cleanup, nil
+}
+
+// ChallengeCert returns the tls-alpn-01 challenge certificate currently
+// being served for domain, if any. Wired into Provider.GetCertificate so a
+// ClientHello negotiating "acme-tls/1" for domain gets answered even while
+// a normal certificate for it is also cached.
+func (s *TLSALPN01Solver) ChallengeCert(domain string) (*tls.Certificate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cert, ok := s.certs[domain]
+	return cert, ok
+}
+
+// DNS01Solver solves the dns-01 challenge by publishing and then removing a
+// TXT record through a [DNSProvider].
+type DNS01Solver struct {
+	provider DNSProvider
+	wait     time.Duration
+}
+
+// NewDNS01Solver creates a DNS01Solver that publishes records through
+// provider, waiting the default dnsPropagationWait before returning control
+// to the caller so the CA's validation request has a chance to see it.
+func NewDNS01Solver(provider DNSProvider) *DNS01Solver {
+	return &DNS01Solver{provider: provider, wait: dnsPropagationWait}
+}
+
+// ChallengeType implements ChallengeSolver.
+func (s *DNS01Solver) ChallengeType() ChallengeType { return ChallengeDNS01 }
+
+// Solve implements ChallengeSolver.
+func (s *DNS01Solver) Solve(ctx context.Context, client *acme.Client, domain string, chal *acme.Challenge) (func(context.Context), error) {
+	value, err := client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return nil, trace.Wrap(err, "computing dns-01 challenge record for %s", domain)
+	}
+	fqdn := "_acme-challenge." + domain + "."
+
+	if err := s.provider.Present(ctx, fqdn, value); err != nil {
+		return nil, trace.Wrap(err, "publishing dns-01 challenge record for %s", domain)
+	}
+
+	cleanup := func(cleanupCtx context.Context) {
+		_ = s.provider.CleanUp(cleanupCtx, fqdn, value)
+	}
+
+	select {
+	case <-time.After(s.wait):
+	case <-ctx.Done():
+		cleanup(context.Background())
+		return func(context.Context) {}, trace.Wrap(ctx.Err())
+	}
+	return cleanup, nil
+}
+
+var (
+	_ ChallengeSolver = (*TLSALPN01Solver)(nil)
+	_ ChallengeSolver = (*DNS01Solver)(nil)
+)
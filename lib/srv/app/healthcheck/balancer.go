@@ -0,0 +1,107 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import "math/rand"
+
+// candidate is what a Balancer chooses among: a selectable Target together
+// with the rolling stats the strategy scores it by.
+type candidate struct {
+	target Target
+	stats  Stats
+}
+
+// Balancer picks one of several healthy candidates to route a request to.
+type Balancer interface {
+	// Select returns the index into candidates to use. candidates is
+	// never empty.
+	Select(candidates []candidate) int
+}
+
+// EWMALeastRequestBalancer picks the candidate with the lowest
+// (EWMA latency) * (1 + in-flight requests), the weighting strategy used
+// by Envoy's "weighted least request" policy. It favors both fast servers
+// and servers that aren't already busy, which plain least-latency
+// selection can starve under uneven load.
+type EWMALeastRequestBalancer struct{}
+
+// Select implements Balancer.
+func (EWMALeastRequestBalancer) Select(candidates []candidate) int {
+	best := 0
+	bestScore := ewmaLeastRequestScore(candidates[0])
+	for i := 1; i < len(candidates); i++ {
+		if score := ewmaLeastRequestScore(candidates[i]); score < bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return best
+}
+
+func ewmaLeastRequestScore(c candidate) float64 {
+	latency := float64(c.stats.Latency)
+	if latency <= 0 {
+		// An un-probed candidate has no latency sample yet; treat it as
+		// free rather than infinitely fast or infinitely slow, so it
+		// gets a fair first try.
+		latency = 1
+	}
+	return latency * float64(1+c.stats.InFlight)
+}
+
+// PowerOfTwoChoicesBalancer samples two random candidates and picks the
+// one with the lower (EWMA latency) * (1 + in-flight requests) score, the
+// "power of two choices" strategy. It
+// approaches the quality of scanning every candidate at a fraction of the
+// cost, which matters once a cluster has hundreds of AppServers for one
+// PublicAddr.
+type PowerOfTwoChoicesBalancer struct {
+	// rand is overridden in tests for deterministic sampling; nil uses
+	// math/rand's package-level source.
+	rand *rand.Rand
+}
+
+// NewPowerOfTwoChoicesBalancer creates a PowerOfTwoChoicesBalancer.
+func NewPowerOfTwoChoicesBalancer() *PowerOfTwoChoicesBalancer {
+	return &PowerOfTwoChoicesBalancer{}
+}
+
+// Select implements Balancer.
+func (b *PowerOfTwoChoicesBalancer) Select(candidates []candidate) int {
+	if len(candidates) == 1 {
+		return 0
+	}
+
+	i, j := b.intn(len(candidates)), b.intn(len(candidates)-1)
+	if j >= i {
+		j++ // skip over i so i != j, as if sampling without replacement
+	}
+
+	if ewmaLeastRequestScore(candidates[j]) < ewmaLeastRequestScore(candidates[i]) {
+		return j
+	}
+	return i
+}
+
+func (b *PowerOfTwoChoicesBalancer) intn(n int) int {
+	if b.rand != nil {
+		return b.rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+var (
+	_ Balancer = EWMALeastRequestBalancer{}
+	_ Balancer = (*PowerOfTwoChoicesBalancer)(nil)
+)
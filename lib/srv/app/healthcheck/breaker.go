@@ -0,0 +1,164 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// BreakerState is the lifecycle state of a per-Target circuit breaker.
+type BreakerState string
+
+const (
+	// StateClosed is the normal state: the target is selectable and
+	// every probe result counts toward tripping the breaker.
+	StateClosed BreakerState = "closed"
+	// StateOpen means the target has failed enough consecutive probes to
+	// be excluded from selection entirely until CooldownPeriod elapses.
+	StateOpen BreakerState = "open"
+	// StateHalfOpen means CooldownPeriod has elapsed since the breaker
+	// tripped; a single trial probe is allowed through to decide whether
+	// to close the breaker again or reopen it.
+	StateHalfOpen BreakerState = "half-open"
+)
+
+// BreakerConfig sets the thresholds a [breaker] trips and resets on.
+type BreakerConfig struct {
+	// FailureThreshold is how many consecutive failed probes trip the
+	// breaker from closed to open.
+	FailureThreshold int
+	// SuccessThreshold is how many consecutive successful trial probes,
+	// while half-open, close the breaker again.
+	SuccessThreshold int
+	// CooldownPeriod is how long an open breaker waits before allowing a
+	// half-open trial probe.
+	CooldownPeriod time.Duration
+}
+
+// defaultBreakerConfig is used for any zero-valued BreakerConfig field.
+var defaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 3,
+	SuccessThreshold: 2,
+	CooldownPeriod:   30 * time.Second,
+}
+
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = defaultBreakerConfig.FailureThreshold
+	}
+	if c.SuccessThreshold <= 0 {
+		c.SuccessThreshold = defaultBreakerConfig.SuccessThreshold
+	}
+	if c.CooldownPeriod <= 0 {
+		c.CooldownPeriod = defaultBreakerConfig.CooldownPeriod
+	}
+	return c
+}
+
+// breaker is a closed/open/half-open circuit breaker for a single Target.
+// It is safe for concurrent use.
+type breaker struct {
+	cfg   BreakerConfig
+	clock clockwork.Clock
+
+	mu            sync.Mutex
+	state         BreakerState
+	consecutive   int // consecutive failures while closed, or successes while half-open
+	openedAt      time.Time
+	trialInFlight bool
+}
+
+func newBreaker(cfg BreakerConfig, clock clockwork.Clock) *breaker {
+	return &breaker{cfg: cfg.withDefaults(), clock: clock, state: StateClosed}
+}
+
+// State returns the breaker's current state, promoting it from open to
+// half-open if CooldownPeriod has elapsed.
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maybeExpireCooldown()
+	return b.state
+}
+
+// allowed reports whether a request may currently be routed to the target:
+// true if closed, true for exactly one caller at a time while half-open
+// (the trial probe), false otherwise.
+func (b *breaker) allowed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maybeExpireCooldown()
+
+	switch b.state {
+	case StateClosed:
+		return true
+	case StateHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *breaker) maybeExpireCooldown() {
+	if b.state == StateOpen && b.clock.Now().Sub(b.openedAt) >= b.cfg.CooldownPeriod {
+		b.state = StateHalfOpen
+		b.consecutive = 0
+	}
+}
+
+// recordResult folds a probe or trial outcome into the breaker, tripping
+// or resetting it as the thresholds dictate.
+func (b *breaker) recordResult(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateClosed:
+		if success {
+			b.consecutive = 0
+			return
+		}
+		b.consecutive++
+		if b.consecutive >= b.cfg.FailureThreshold {
+			b.state = StateOpen
+			b.openedAt = b.clock.Now()
+			b.consecutive = 0
+		}
+	case StateHalfOpen:
+		b.trialInFlight = false
+		if !success {
+			b.state = StateOpen
+			b.openedAt = b.clock.Now()
+			b.consecutive = 0
+			return
+		}
+		b.consecutive++
+		if b.consecutive >= b.cfg.SuccessThreshold {
+			b.state = StateClosed
+			b.consecutive = 0
+		}
+	case StateOpen:
+		// A result arriving for an open breaker (e.g. a stale in-flight
+		// probe that started before the breaker tripped) doesn't change
+		// its state; only the cooldown timer does.
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreakerTripsAndRecovers(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	b := newBreaker(BreakerConfig{FailureThreshold: 2, SuccessThreshold: 2, CooldownPeriod: 10 * time.Second}, clock)
+
+	require.Equal(t, StateClosed, b.State())
+
+	b.recordResult(false)
+	require.Equal(t, StateClosed, b.State(), "one failure should not trip a threshold of two")
+
+	b.recordResult(false)
+	require.Equal(t, StateOpen, b.State())
+
+	clock.Advance(5 * time.Second)
+	require.Equal(t, StateOpen, b.State(), "cooldown has not elapsed yet")
+
+	clock.Advance(6 * time.Second)
+	require.Equal(t, StateHalfOpen, b.State())
+
+	require.True(t, b.allowed())
+	require.False(t, b.allowed(), "only one trial should be admitted at a time")
+
+	b.recordResult(true)
+	require.Equal(t, StateHalfOpen, b.State(), "one success should not close a threshold of two")
+	require.True(t, b.allowed(), "trial slot should free up after its result is recorded")
+
+	b.recordResult(true)
+	require.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerReopensOnFailedTrial(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	b := newBreaker(BreakerConfig{FailureThreshold: 1, SuccessThreshold: 1, CooldownPeriod: time.Second}, clock)
+
+	b.recordResult(false)
+	require.Equal(t, StateOpen, b.State())
+
+	clock.Advance(2 * time.Second)
+	require.Equal(t, StateHalfOpen, b.State())
+
+	b.recordResult(false)
+	require.Equal(t, StateOpen, b.State(), "a failed trial should reopen the breaker")
+}
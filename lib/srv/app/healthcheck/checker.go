@@ -0,0 +1,249 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// logger is the subset of logrus.FieldLogger a Checker needs, kept small
+// so tests can substitute a no-op implementation.
+type logger interface {
+	Warnf(format string, args ...any)
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Warnf(string, ...any) {}
+
+// Config configures a Checker.
+type Config struct {
+	// Prober issues active probes. Defaults to an HTTPProber using
+	// http.DefaultClient.
+	Prober Prober
+	// Balancer scores the targets Select is choosing among. Defaults to
+	// EWMALeastRequestBalancer.
+	Balancer Balancer
+	// Breaker sets the circuit breaker thresholds used for every target.
+	Breaker BreakerConfig
+	// Clock is used for probe scheduling and breaker cooldowns. Defaults
+	// to the real clock; overridden in tests.
+	Clock clockwork.Clock
+	// Log receives warnings about probe failures. Defaults to discarding
+	// them.
+	Log logger
+}
+
+func (c *Config) checkAndSetDefaults() {
+	if c.Prober == nil {
+		c.Prober = NewHTTPProber(nil)
+	}
+	if c.Balancer == nil {
+		c.Balancer = EWMALeastRequestBalancer{}
+	}
+	if c.Clock == nil {
+		c.Clock = clockwork.NewRealClock()
+	}
+	if c.Log == nil {
+		c.Log = noopLogger{}
+	}
+}
+
+// targetKey identifies one monitored Target.
+type targetKey struct {
+	hostID     string
+	publicAddr string
+}
+
+// targetEntry is everything the Checker tracks for one Target.
+type targetEntry struct {
+	target      Target
+	probeConfig ProbeConfig
+	stats       *stats
+	breaker     *breaker
+	lastProbe   time.Time
+}
+
+// Checker is a background health-check subsystem for application access.
+// It is an alternative to the proxy's per-request "can dial" check: Update
+// keeps it informed of the current types.AppServer set for each PublicAddr,
+// Run probes them on a schedule, and Select picks a healthy one to route a
+// request to, where matchApplicationServers shuffles the whole list.
+type Checker struct {
+	cfg     Config
+	metrics *checkerMetrics
+
+	mu      sync.RWMutex
+	targets map[targetKey]*targetEntry
+}
+
+// NewChecker creates a Checker from cfg.
+func NewChecker(cfg Config) *Checker {
+	cfg.checkAndSetDefaults()
+	return &Checker{
+		cfg:     cfg,
+		metrics: newCheckerMetrics(),
+		targets: make(map[targetKey]*targetEntry),
+	}
+}
+
+// Metrics returns the Prometheus collectors this Checker updates, for
+// registration with a prometheus.Registerer.
+func (c *Checker) Metrics() []prometheus.Collector {
+	return c.metrics.collectors()
+}
+
+// Update replaces the set of targets monitored for publicAddr with
+// targets, adding new ones (starting them closed, with no history) and
+// dropping ones no longer present. It is called whenever the proxy's view
+// of a PublicAddr's AppServers changes, e.g. on a watcher event.
+func (c *Checker) Update(publicAddr string, targets []Target, probeConfig ProbeConfig) {
+	probeConfig = probeConfig.withDefaults()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[targetKey]struct{}, len(targets))
+	for _, t := range targets {
+		t.PublicAddr = publicAddr
+		key := targetKey{hostID: t.HostID, publicAddr: publicAddr}
+		seen[key] = struct{}{}
+
+		if _, ok := c.targets[key]; ok {
+			continue
+		}
+		c.targets[key] = &targetEntry{
+			target:      t,
+			probeConfig: probeConfig,
+			stats:       newStats(),
+			breaker:     newBreaker(c.cfg.Breaker, c.cfg.Clock),
+		}
+	}
+
+	for key := range c.targets {
+		if key.publicAddr != publicAddr {
+			continue
+		}
+		if _, ok := seen[key]; !ok {
+			delete(c.targets, key)
+		}
+	}
+}
+
+// Select picks a Target to route a request for publicAddr to, preferring
+// targets whose circuit breaker is closed, falling back to a half-open
+// trial probe if none are closed, and returning a NotFound error (the
+// breaker-open equivalent of "no online services") only if every target is
+// open.
+func (c *Checker) Select(publicAddr string) (Target, error) {
+	c.mu.RLock()
+	entries := make([]*targetEntry, 0, len(c.targets))
+	for key, e := range c.targets {
+		if key.publicAddr == publicAddr {
+			entries = append(entries, e)
+		}
+	}
+	c.mu.RUnlock()
+
+	if len(entries) == 0 {
+		return Target{}, trace.NotFound("no app servers registered for %v", publicAddr)
+	}
+
+	var candidates []candidate
+	var trial *targetEntry
+	for _, e := range entries {
+		switch e.breaker.State() {
+		case StateClosed:
+			candidates = append(candidates, candidate{target: e.target, stats: e.stats.snapshot()})
+		case StateHalfOpen:
+			if trial == nil {
+				trial = e
+			}
+		}
+	}
+
+	if len(candidates) > 0 {
+		idx := c.cfg.Balancer.Select(candidates)
+		return candidates[idx].target, nil
+	}
+	// No target is closed; fall back to whichever is half-open rather
+	// than failing outright, the same trial request a standard breaker
+	// would let through on the caller's behalf. allowed() ensures only
+	// one caller at a time gets routed to it while it's on trial; its
+	// outcome is folded back in through the next scheduled probe in Run,
+	// since Select has no way to learn how this particular proxied
+	// request turns out.
+	if trial != nil && trial.breaker.allowed() {
+		return trial.target, nil
+	}
+	return Target{}, trace.NotFound("no healthy app servers for %v, every circuit breaker is open", publicAddr)
+}
+
+// Run probes every registered target whose interval has elapsed, once per
+// tick, until ctx is canceled. Each due target is probed independently so
+// one slow or hanging backend doesn't delay the others.
+func (c *Checker) Run(ctx context.Context, tick time.Duration) {
+	ticker := c.cfg.Clock.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+			c.probeDue(ctx)
+		}
+	}
+}
+
+func (c *Checker) probeDue(ctx context.Context) {
+	now := c.cfg.Clock.Now()
+
+	c.mu.RLock()
+	due := make([]*targetEntry, 0)
+	for _, e := range c.targets {
+		if now.Sub(e.lastProbe) >= e.probeConfig.Interval {
+			due = append(due, e)
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, e := range due {
+		c.probeOne(ctx, e)
+	}
+}
+
+// probeOne issues a single probe for e, regardless of whether its
+// interval has elapsed; probeDue calls it for each target that is due.
+func (c *Checker) probeOne(ctx context.Context, e *targetEntry) {
+	e.lastProbe = c.cfg.Clock.Now()
+
+	latency, err := c.cfg.Prober.Probe(ctx, e.target, e.probeConfig)
+	e.stats.record(latency, err)
+	e.breaker.recordResult(err == nil)
+
+	c.metrics.observeProbe(e.target, latency.Seconds(), err)
+	c.metrics.setBreakerState(e.target, e.breaker.State())
+
+	if err != nil {
+		c.cfg.Log.Warnf("Health check probe failed for %v (%v): %v.", e.target.PublicAddr, e.target.HostID, err)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProber lets a test control which HostIDs fail, without any real
+// network I/O.
+type fakeProber struct {
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+func newFakeProber() *fakeProber {
+	return &fakeProber{failing: make(map[string]bool)}
+}
+
+func (f *fakeProber) setFailing(hostID string, failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing[hostID] = failing
+}
+
+func (f *fakeProber) Probe(_ context.Context, target Target, _ ProbeConfig) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failing[target.HostID] {
+		return 0, trace.ConnectionProblem(nil, "probe failed for %v", target.HostID)
+	}
+	return 10 * time.Millisecond, nil
+}
+
+func TestCheckerSelectConvergesOnHealthyHosts(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	prober := newFakeProber()
+	checker := NewChecker(Config{
+		Prober:  prober,
+		Breaker: BreakerConfig{FailureThreshold: 2, SuccessThreshold: 1, CooldownPeriod: time.Minute},
+		Clock:   clock,
+	})
+
+	const publicAddr = "app.example.com"
+	targets := []Target{
+		{HostID: "host-a", Addr: "10.0.0.1:8080"},
+		{HostID: "host-b", Addr: "10.0.0.2:8080"},
+		{HostID: "host-c", Addr: "10.0.0.3:8080"},
+	}
+	checker.Update(publicAddr, targets, ProbeConfig{Interval: time.Second})
+
+	// All three are unprobed but closed, so Select should always succeed.
+	_, err := checker.Select(publicAddr)
+	require.NoError(t, err)
+
+	// host-a and host-b start failing every probe.
+	prober.setFailing("host-a", true)
+	prober.setFailing("host-b", true)
+
+	// Run enough probe cycles to trip both failing breakers
+	// (FailureThreshold=2) without tripping host-c's.
+	for i := 0; i < 2; i++ {
+		clock.Advance(time.Second)
+		checker.probeDue(context.Background())
+	}
+
+	for i := 0; i < 20; i++ {
+		target, err := checker.Select(publicAddr)
+		require.NoError(t, err)
+		require.Equal(t, "host-c", target.HostID, "selection should have converged on the only host whose breaker is still closed")
+	}
+
+	status := checker.Status()
+	require.Len(t, status, 3)
+	for _, s := range status {
+		if s.HostID == "host-c" {
+			require.Equal(t, StateClosed, s.State)
+		} else {
+			require.Equal(t, StateOpen, s.State)
+		}
+	}
+}
+
+func TestCheckerUpdateDropsStaleTargets(t *testing.T) {
+	checker := NewChecker(Config{Prober: newFakeProber()})
+
+	const publicAddr = "app.example.com"
+	checker.Update(publicAddr, []Target{{HostID: "host-a", Addr: "10.0.0.1:8080"}}, ProbeConfig{})
+	require.Len(t, checker.Status(), 1)
+
+	checker.Update(publicAddr, []Target{{HostID: "host-b", Addr: "10.0.0.2:8080"}}, ProbeConfig{})
+
+	status := checker.Status()
+	require.Len(t, status, 1)
+	require.Equal(t, "host-b", status[0].HostID)
+}
+
+func TestSelectReturnsNotFoundWithNoTargets(t *testing.T) {
+	checker := NewChecker(Config{Prober: newFakeProber()})
+	_, err := checker.Select("app.example.com")
+	require.True(t, trace.IsNotFound(err))
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package healthcheck provides a background [Checker] as an alternative to
+// the app proxy's "healthy == can dial" notion: it periodically probes every
+// types.AppServer registered for a given PublicAddr, keeps rolling
+// latency/error statistics and a per-server circuit breaker over the
+// results, and selects among the servers that are currently closed (or
+// half-open and due for a trial request) with a weighted strategy instead
+// of a uniform shuffle.
+//
+// A [Checker] owns no network listener of its own. Its caller reports the
+// AppServers for a PublicAddr through Update whenever they change and calls
+// Select to pick one; the app proxy handler does not call it.
+package healthcheck
+
+import "time"
+
+// defaultProbeInterval is how often a healthy server is re-probed absent an
+// explicit interval from types.AppSpecV3.
+const defaultProbeInterval = 30 * time.Second
+
+// defaultProbeTimeout bounds how long a single probe waits for a response.
+const defaultProbeTimeout = 5 * time.Second
+
+// defaultProbePath is requested when an App doesn't configure one.
+const defaultProbePath = "/"
+
+// Target identifies the app server a probe result or circuit breaker
+// belongs to: one HostID can serve multiple PublicAddrs, and the same
+// PublicAddr is usually served by several HostIDs, so neither alone is a
+// unique key.
+type Target struct {
+	// HostID is the types.AppServer's HostID.
+	HostID string
+	// PublicAddr is the app's types.AppSpecV3.PublicAddr.
+	PublicAddr string
+	// Addr is the address the prober dials - the AppServer's internal
+	// address for the app, not its public one.
+	Addr string
+}
+
+// ProbeConfig controls how a Target is probed. It is sourced from
+// types.AppSpecV3's health check settings, falling back to the defaults
+// above for any zero value.
+type ProbeConfig struct {
+	// Path is the HTTP path requested on each probe.
+	Path string
+	// Interval is the time between probes of a healthy Target.
+	Interval time.Duration
+	// Timeout bounds a single probe.
+	Timeout time.Duration
+}
+
+// withDefaults returns a copy of c with zero fields replaced by defaults.
+func (c ProbeConfig) withDefaults() ProbeConfig {
+	if c.Path == "" {
+		c.Path = defaultProbePath
+	}
+	if c.Interval <= 0 {
+		c.Interval = defaultProbeInterval
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultProbeTimeout
+	}
+	return c
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// checkerMetrics are the per-app+host Prometheus collectors a Checker
+// updates on every probe and breaker state change.
+type checkerMetrics struct {
+	probeLatency *prometheus.HistogramVec
+	probeErrors  *prometheus.CounterVec
+	breakerState *prometheus.GaugeVec
+}
+
+func newCheckerMetrics() *checkerMetrics {
+	labels := []string{"public_addr", "host_id"}
+	return &checkerMetrics{
+		probeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "app_health_check_probe_duration_seconds",
+			Help:    "Latency of active app health check probes.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		probeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "app_health_check_probe_errors_total",
+			Help: "Number of failed app health check probes.",
+		}, labels),
+		breakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "app_health_check_breaker_state",
+			Help: "Circuit breaker state per app host: 0=closed, 1=half-open, 2=open.",
+		}, labels),
+	}
+}
+
+func (m *checkerMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.probeLatency, m.probeErrors, m.breakerState}
+}
+
+func (m *checkerMetrics) observeProbe(target Target, latency float64, err error) {
+	m.probeLatency.WithLabelValues(target.PublicAddr, target.HostID).Observe(latency)
+	if err != nil {
+		m.probeErrors.WithLabelValues(target.PublicAddr, target.HostID).Inc()
+	}
+}
+
+func (m *checkerMetrics) setBreakerState(target Target, state BreakerState) {
+	m.breakerState.WithLabelValues(target.PublicAddr, target.HostID).Set(breakerStateValue(state))
+}
+
+func breakerStateValue(state BreakerState) float64 {
+	switch state {
+	case StateClosed:
+		return 0
+	case StateHalfOpen:
+		return 1
+	default:
+		return 2
+	}
+}
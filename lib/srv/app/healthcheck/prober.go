@@ -0,0 +1,76 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gravitational/trace"
+)
+
+// Prober issues a single active health check against a Target and reports
+// how long it took. Probe returning a non-nil error counts as a failed
+// probe regardless of latency.
+type Prober interface {
+	Probe(ctx context.Context, target Target, cfg ProbeConfig) (time.Duration, error)
+}
+
+// HTTPProber probes a Target by issuing a GET request for cfg.Path and
+// treating any 2xx or 3xx response as healthy. It is the default Prober;
+// app access currently only proxies HTTP(S) applications.
+type HTTPProber struct {
+	// Client is used to issue probe requests. It should have
+	// InsecureSkipVerify set appropriately for self-signed app backends,
+	// the same way the proxy's own app dialer does.
+	Client *http.Client
+}
+
+// NewHTTPProber creates an HTTPProber using client, or http.DefaultClient
+// if client is nil.
+func NewHTTPProber(client *http.Client) *HTTPProber {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPProber{Client: client}
+}
+
+// Probe implements Prober.
+func (p *HTTPProber) Probe(ctx context.Context, target Target, cfg ProbeConfig) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	url := "https://" + target.Addr + cfg.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, trace.Wrap(err)
+	}
+
+	start := time.Now()
+	resp, err := p.Client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return latency, trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return latency, trace.Errorf("probe for %v returned status %v", target.Addr, resp.StatusCode)
+	}
+	return latency, nil
+}
+
+var _ Prober = (*HTTPProber)(nil)
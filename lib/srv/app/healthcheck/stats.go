@@ -0,0 +1,102 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"sync"
+	"time"
+)
+
+// statsAlpha weights each new probe's contribution to the rolling EWMA
+// latency and error rate. A value of 0.2 gives the last ~5 probes most of
+// the weight, which at the default 30s probe interval tracks changes
+// within a couple of minutes without reacting to a single flaky probe.
+const statsAlpha = 0.2
+
+// stats holds the rolling, EWMA-smoothed latency and error rate for one
+// Target, plus the raw counters the JSON status endpoint and
+// power-of-two-choices balancer read directly.
+type stats struct {
+	mu sync.RWMutex
+
+	latency   time.Duration
+	errorRate float64
+
+	probes   uint64
+	errors   uint64
+	inFlight int64
+}
+
+func newStats() *stats {
+	return &stats{}
+}
+
+// record folds a single probe's outcome into the rolling stats.
+func (s *stats) record(latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.probes++
+	errObserved := 0.0
+	if err != nil {
+		s.errors++
+		errObserved = 1.0
+	}
+
+	if s.probes == 1 {
+		s.latency = latency
+		s.errorRate = errObserved
+		return
+	}
+	s.latency = ewmaDuration(s.latency, latency, statsAlpha)
+	s.errorRate = ewmaFloat(s.errorRate, errObserved, statsAlpha)
+}
+
+// snapshot returns a consistent copy of the current stats.
+func (s *stats) snapshot() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Stats{
+		Latency:   s.latency,
+		ErrorRate: s.errorRate,
+		Probes:    s.probes,
+		Errors:    s.errors,
+		InFlight:  s.inFlight,
+	}
+}
+
+func (s *stats) addInFlight(delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inFlight += delta
+}
+
+// Stats is a point-in-time, read-only view of a Target's rolling health
+// statistics, exposed through Checker.Status for the JSON status endpoint.
+type Stats struct {
+	Latency   time.Duration `json:"latency"`
+	ErrorRate float64       `json:"error_rate"`
+	Probes    uint64        `json:"probes"`
+	Errors    uint64        `json:"errors"`
+	InFlight  int64         `json:"in_flight"`
+}
+
+func ewmaDuration(prev, sample time.Duration, alpha float64) time.Duration {
+	return time.Duration(alpha*float64(sample) + (1-alpha)*float64(prev))
+}
+
+func ewmaFloat(prev, sample, alpha float64) float64 {
+	return alpha*sample + (1-alpha)*prev
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package healthcheck
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// TargetStatus is one Target's entry in the JSON status endpoint.
+type TargetStatus struct {
+	HostID     string       `json:"host_id"`
+	PublicAddr string       `json:"public_addr"`
+	State      BreakerState `json:"state"`
+	Stats      Stats        `json:"stats"`
+}
+
+// Status returns the current state of every Target the Checker knows
+// about, for diagnostics (`tctl` commands, the status endpoint below, or
+// an operator curling it directly).
+func (c *Checker) Status() []TargetStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	out := make([]TargetStatus, 0, len(c.targets))
+	for _, e := range c.targets {
+		out = append(out, TargetStatus{
+			HostID:     e.target.HostID,
+			PublicAddr: e.target.PublicAddr,
+			State:      e.breaker.State(),
+			Stats:      e.stats.snapshot(),
+		})
+	}
+	return out
+}
+
+// ServeHTTP implements http.Handler, serving Status as JSON. It is meant to
+// be mounted on an internal diagnostics mux, not the public app listener.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(c.Status())
+}
+
+var _ http.Handler = (*Checker)(nil)
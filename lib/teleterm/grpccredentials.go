@@ -19,8 +19,12 @@
 package teleterm
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
 	"os"
 	"path/filepath"
 
@@ -40,11 +44,21 @@ const (
 	// rendererCertFileName is the file name of the cert created by the renderer process of the
 	// Electron app.
 	rendererCertFileName = "renderer.crt"
+	// fingerprintFileSuffix is appended to a cert's file name to get the name of its pinned
+	// SHA-256 fingerprint sidecar, e.g. "tshd.crt.sha256" alongside "tshd.crt".
+	fingerprintFileSuffix = ".sha256"
 )
 
 // createServerCredentials creates mTLS credentials for a gRPC server. The client cert file is read
 // only on an incoming connection, not upfront. The way Connect startup is set up guarantees that by
 // the time the client reaches out to us, its public key is saved to the file under clientCertPath.
+//
+// On top of the usual chain verification against the client cert loaded from clientCertPath, the
+// peer's leaf certificate is pinned by SHA-256 fingerprint (read from clientCertPath's
+// ".sha256" sidecar) and rejected even if the loaded cert would otherwise verify. This closes the
+// window between generateAndSaveCert writing the cert file and the first handshake reading it,
+// during which a local attacker could overwrite the file with a cert of their own and have it
+// trusted simply because it's self-signed and loaded from the expected path.
 func createServerCredentials(serverKeyPair tls.Certificate, clientCertPath string) (grpc.ServerOption, error) {
 	config := &tls.Config{
 		ClientAuth:   tls.RequireAndVerifyClientCert,
@@ -66,8 +80,16 @@ func createServerCredentials(serverKeyPair tls.Certificate, clientCertPath strin
 			return nil, nil
 		}
 
+		fingerprint, err := readPinnedFingerprint(fingerprintPath(clientCertPath))
+		if err != nil {
+			log.WithError(err).Error("Failed to read the pinned client cert fingerprint")
+			// Fall back to the default config.
+			return nil, nil
+		}
+
 		configClone := config.Clone()
 		configClone.ClientCAs = certPool
+		configClone.VerifyPeerCertificate = verifyPeerCertificatePinned(fingerprint)
 
 		return configClone, nil
 	}
@@ -97,12 +119,83 @@ func createClientTLSConfig(clientKeyPair tls.Certificate, serverCertPath string)
 		return nil, trace.BadParameter("failed to add server cert to pool")
 	}
 
+	fingerprint, err := readPinnedFingerprint(fingerprintPath(serverCertPath))
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to read the pinned server cert fingerprint")
+	}
+
 	return &tls.Config{
-		Certificates: []tls.Certificate{clientKeyPair},
-		RootCAs:      certPool,
+		Certificates:          []tls.Certificate{clientKeyPair},
+		RootCAs:               certPool,
+		VerifyPeerCertificate: verifyPeerCertificatePinned(fingerprint),
 	}, nil
 }
 
+// verifyPeerCertificatePinned returns a tls.Config.VerifyPeerCertificate callback that rejects the
+// handshake unless the peer's leaf certificate's SHA-256 fingerprint matches want, compared in
+// constant time. It runs in addition to (not instead of) the normal certificate chain
+// verification already configured via RootCAs/ClientCAs.
+func verifyPeerCertificatePinned(want []byte) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return trace.AccessDenied("no peer certificate presented")
+		}
+
+		got := sha256.Sum256(rawCerts[0])
+		if subtle.ConstantTimeCompare(got[:], want) != 1 {
+			return trace.AccessDenied("peer certificate fingerprint does not match the pinned fingerprint")
+		}
+		return nil
+	}
+}
+
+// fingerprintPath returns the path of certPath's pinned fingerprint sidecar.
+func fingerprintPath(certPath string) string {
+	return certPath + fingerprintFileSuffix
+}
+
+// writePinnedFingerprint computes the SHA-256 fingerprint of certPEM's leaf certificate and writes
+// it, hex-encoded, to fingerprintPath, through the same temp-file-then-rename dance
+// generateAndSaveCert uses for the cert itself so readers never observe a half-written fingerprint.
+func writePinnedFingerprint(targetPath string, certPEM []byte) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return trace.BadParameter("failed to decode certificate PEM")
+	}
+	fingerprint := sha256.Sum256(block.Bytes)
+
+	tempFile, err := os.CreateTemp(filepath.Dir(targetPath), filepath.Base(targetPath))
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	if err := tempFile.Chmod(0600); err != nil {
+		return trace.Wrap(err)
+	}
+	if _, err := tempFile.WriteString(hex.EncodeToString(fingerprint[:])); err != nil {
+		return trace.Wrap(err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	return trace.Wrap(os.Rename(tempFile.Name(), targetPath))
+}
+
+// readPinnedFingerprint reads and hex-decodes the fingerprint sidecar at path.
+func readPinnedFingerprint(path string) ([]byte, error) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	fingerprint, err := hex.DecodeString(string(encoded))
+	if err != nil {
+		return nil, trace.Wrap(err, "malformed fingerprint sidecar %v", path)
+	}
+	return fingerprint, nil
+}
+
 func generateAndSaveCert(targetPath string, eku ...x509.ExtKeyUsage) (tls.Certificate, error) {
 	// The cert is first saved under a temp path and then renamed to targetPath. This prevents other
 	// processes from reading a half-written file.
@@ -133,6 +226,10 @@ func generateAndSaveCert(targetPath string, eku ...x509.ExtKeyUsage) (tls.Certif
 		return tls.Certificate{}, trace.Wrap(err)
 	}
 
+	if err = writePinnedFingerprint(fingerprintPath(targetPath), cert.Cert); err != nil {
+		return tls.Certificate{}, trace.Wrap(err, "failed to write the pinned cert fingerprint")
+	}
+
 	certificate, err := keys.X509KeyPair(cert.Cert, cert.PrivateKey)
 	if err != nil {
 		return tls.Certificate{}, trace.Wrap(err)
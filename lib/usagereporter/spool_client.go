@@ -0,0 +1,207 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package usagereporter implements a durable client for submitting usage
+// events to the prehog TeleportReportingService, surviving restarts and
+// transient network failures.
+package usagereporter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/gravitational/teleport/api/utils/retryutils"
+	prehogv1alpha "github.com/gravitational/teleport/gen/proto/go/prehog/v1alpha"
+	"github.com/gravitational/teleport/gen/proto/go/prehog/v1alpha/prehogv1alphaconnect"
+)
+
+var log = logrus.WithField(trace.Component, "usagereporter")
+
+// SpoolClientConfig configures a [SpoolClient].
+type SpoolClientConfig struct {
+	// Submitter is the underlying connect client used to deliver events.
+	Submitter prehogv1alphaconnect.TeleportReportingServiceClient
+	// SpoolDir is the directory pending, not-yet-acknowledged batches are
+	// persisted to so they survive a process restart.
+	SpoolDir string
+	// Clock is used to schedule retries. Defaults to the real clock.
+	Clock clockwork.Clock
+}
+
+// CheckAndSetDefaults validates the config and applies defaults.
+func (c *SpoolClientConfig) CheckAndSetDefaults() error {
+	if c.Submitter == nil {
+		return trace.BadParameter("submitter not provided to SpoolClientConfig")
+	}
+	if c.SpoolDir == "" {
+		return trace.BadParameter("spool dir not provided to SpoolClientConfig")
+	}
+	if c.Clock == nil {
+		c.Clock = clockwork.NewRealClock()
+	}
+	return nil
+}
+
+// SpoolClient persists submitted usage event batches to disk before
+// attempting delivery, and retries until they are acknowledged by the
+// server, with a linear backoff from retryutils.Linear (first one second,
+// step five seconds, at most one minute) and no jitter; the backoff does
+// not grow exponentially. Pending batches left behind by a prior
+// process are re-sent on the next call to [SpoolClient.Run].
+type SpoolClient struct {
+	cfg SpoolClientConfig
+	mu  sync.Mutex
+}
+
+// NewSpoolClient creates a [SpoolClient] from the provided configuration.
+// cfg.SpoolDir is created if it does not already exist.
+func NewSpoolClient(cfg SpoolClientConfig) (*SpoolClient, error) {
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	if err := os.MkdirAll(cfg.SpoolDir, 0o700); err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	return &SpoolClient{cfg: cfg}, nil
+}
+
+// SubmitEvents writes req to the spool directory and returns immediately;
+// delivery is attempted asynchronously by [SpoolClient.Run].
+func (s *SpoolClient) SubmitEvents(req *prehogv1alpha.SubmitEventsRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, err := proto.Marshal(req)
+	if err != nil {
+		return trace.Wrap(err, "marshaling usage event batch")
+	}
+
+	name := fmt.Sprintf("%d-%d.pb", s.cfg.Clock.Now().UnixNano(), len(raw))
+	if err := os.WriteFile(filepath.Join(s.cfg.SpoolDir, name), raw, 0o600); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	return nil
+}
+
+// Run delivers spooled batches in the order they were written, retrying
+// failed deliveries with the linear backoff described on [SpoolClient],
+// until ctx is canceled. It should be run in its own goroutine.
+func (s *SpoolClient) Run(ctx context.Context) {
+	retry, err := retryutils.NewLinear(retryutils.LinearConfig{
+		First: time.Second,
+		Step:  5 * time.Second,
+		Max:   time.Minute,
+		Clock: s.cfg.Clock,
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to create retry, usage reporting disabled")
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		drained, err := s.drainOne(ctx)
+		if err != nil {
+			log.WithError(err).Warn("failed to deliver spooled usage event batch")
+			retry.Inc()
+
+			select {
+			case <-s.cfg.Clock.After(retry.Duration()):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		retry.Reset()
+
+		if !drained {
+			select {
+			case <-s.cfg.Clock.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// drainOne attempts to deliver the oldest pending batch in the spool
+// directory, removing it once it has been acknowledged. It returns false if
+// there were no pending batches to send.
+func (s *SpoolClient) drainOne(ctx context.Context) (bool, error) {
+	entries, err := os.ReadDir(s.cfg.SpoolDir)
+	if err != nil {
+		return false, trace.ConvertSystemError(err)
+	}
+
+	if len(entries) == 0 {
+		return false, nil
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return false, nil
+	}
+
+	path := filepath.Join(s.cfg.SpoolDir, names[0])
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return false, trace.ConvertSystemError(err)
+	}
+
+	var req prehogv1alpha.SubmitEventsRequest
+	if err := proto.Unmarshal(raw, &req); err != nil {
+		// A corrupt batch can never be delivered; drop it rather than
+		// blocking every batch behind it forever.
+		log.WithError(err).Warn("dropping corrupt spooled usage event batch")
+		_ = os.Remove(path)
+		return true, nil
+	}
+
+	if _, err := s.cfg.Submitter.SubmitEvents(ctx, connect.NewRequest(&req)); err != nil {
+		return false, trace.Wrap(err, "submitting usage event batch")
+	}
+
+	if err := os.Remove(path); err != nil {
+		return false, trace.ConvertSystemError(err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package latency
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/gravitational/trace"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// ICMPPinger is a [Pinger] implementation that measures round trip time to a
+// remote host by sending an ICMP echo request and waiting for the matching
+// echo reply. It opens an unprivileged ICMP datagram socket ("udp4" or
+// "udp6"), which on Linux requires the process's group to be within
+// net.ipv4.ping_group_range.
+type ICMPPinger struct {
+	addr   netip.Addr
+	conn   *icmp.PacketConn
+	id     int
+	seq    int32
+	readTO time.Duration
+}
+
+// NewICMPPinger creates a new [ICMPPinger] that targets addr. The returned
+// pinger owns the underlying ICMP socket and must be closed when no longer
+// needed.
+func NewICMPPinger(addr netip.Addr) (*ICMPPinger, error) {
+	network := "udp4"
+	proto := "ip4:icmp"
+	if addr.Is6() {
+		network = "udp6"
+		proto = "ip6:ipv6-icmp"
+	}
+
+	conn, err := icmp.ListenPacket(network, "")
+	if err != nil {
+		return nil, trace.Wrap(err, "opening ICMP socket for %s", proto)
+	}
+
+	return &ICMPPinger{
+		addr:   addr,
+		conn:   conn,
+		id:     os.Getpid() & 0xffff,
+		readTO: 2 * time.Second,
+	}, nil
+}
+
+// Close releases the underlying ICMP socket.
+func (p *ICMPPinger) Close() error {
+	return trace.Wrap(p.conn.Close())
+}
+
+// Ping sends an ICMP echo request to the configured address and blocks
+// until the matching echo reply is received, ctx is canceled, or the read
+// deadline passes: ctx's deadline if it has one, otherwise two seconds.
+func (p *ICMPPinger) Ping(ctx context.Context) error {
+	seq := int(p.seq)
+	p.seq++
+
+	echoType := icmp.Type(ipv4.ICMPTypeEcho)
+	protoNum := 1
+	if p.addr.Is6() {
+		echoType = ipv6.ICMPTypeEchoRequest
+		protoNum = 58
+	}
+
+	msg := icmp.Message{
+		Type: echoType,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   p.id,
+			Seq:  seq,
+			Data: []byte{byte(rand.Intn(256)), byte(rand.Intn(256)), byte(rand.Intn(256)), byte(rand.Intn(256))},
+		},
+	}
+
+	raw, err := msg.Marshal(nil)
+	if err != nil {
+		return trace.Wrap(err, "marshaling ICMP echo request")
+	}
+
+	dst := &net.UDPAddr{IP: p.addr.AsSlice()}
+	if deadline, ok := ctx.Deadline(); ok {
+		p.conn.SetReadDeadline(deadline)
+	} else {
+		p.conn.SetReadDeadline(time.Now().Add(p.readTO))
+	}
+
+	// Cut a blocked ReadFrom short when ctx is canceled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if _, err := p.conn.WriteTo(raw, dst); err != nil {
+		return trace.Wrap(err, "sending ICMP echo request to %s", p.addr)
+	}
+
+	reply := make([]byte, 512)
+	for {
+		n, _, err := p.conn.ReadFrom(reply)
+		if err != nil {
+			if ctx.Err() != nil {
+				return trace.Wrap(ctx.Err())
+			}
+			return trace.Wrap(err, "reading ICMP echo reply from %s", p.addr)
+		}
+
+		parsed, err := icmp.ParseMessage(protoNum, reply[:n])
+		if err != nil {
+			continue
+		}
+
+		switch body := parsed.Body.(type) {
+		case *icmp.Echo:
+			if body.ID == p.id && body.Seq == seq {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return trace.Wrap(ctx.Err())
+		default:
+		}
+	}
+}
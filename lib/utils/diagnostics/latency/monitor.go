@@ -16,7 +16,7 @@ package latency
 
 import (
 	"context"
-	"sync/atomic"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -35,9 +35,9 @@ var log = logrus.WithField(trace.Component, "latency")
 // legs of a proxied connection.
 type Statistics struct {
 	// Client measures the round trip time between the client and the Proxy.
-	Client int64
+	Client LegStatistics
 	// Server measures the round trip time the Proxy and the target host.
-	Server int64
+	Server LegStatistics
 }
 
 // Reporter is an abstraction over how to provide the latency statistics to
@@ -67,13 +67,24 @@ type Pinger interface {
 // Monitor periodically pings both legs of a proxied connection and records
 // the round trip times so that they may be emitted to consumers.
 type Monitor struct {
-	clientPinger  Pinger
-	serverPinger  Pinger
-	reporter      Reporter
-	clock         clockwork.Clock
-	ticker        *interval.MultiInterval[string]
-	clientLatency atomic.Int64
-	serverLatency atomic.Int64
+	mu           sync.Mutex
+	clientPinger Pinger
+	serverPinger Pinger
+	reporter     Reporter
+	clock        clockwork.Clock
+	ticker       *interval.MultiInterval[string]
+	clientWindow *window
+	serverWindow *window
+
+	pingInterval   time.Duration
+	reportInterval time.Duration
+	sampleObserver SampleObserver
+	adaptivePing   *AdaptivePingConfig
+	disabled       bool
+
+	// configChanged receives configuration updates requested via
+	// [Monitor.UpdateConfig] for the running [Monitor.Run] loop to apply.
+	configChanged chan MonitorConfig
 }
 
 // MonitorConfig provides required dependencies for the [Monitor].
@@ -91,6 +102,74 @@ type MonitorConfig struct {
 	PingInterval time.Duration
 	// ReportInterval is the frequency at which the latency information is reported.
 	ReportInterval time.Duration
+	// SampleWindow is the number of most recent ping samples, per leg, used to
+	// compute the summary statistics and percentiles returned by [Monitor.GetStats].
+	// Defaults to 256 samples.
+	SampleWindow int
+	// EWMAShortAlpha is the smoothing factor used for the fast-reacting EWMA.
+	// Defaults to 0.3.
+	EWMAShortAlpha float64
+	// EWMALongAlpha is the smoothing factor used for the slow-reacting EWMA.
+	// Defaults to 0.05.
+	EWMALongAlpha float64
+	// SampleObserver, if set, is notified of every raw round trip time sample
+	// as it is recorded, in addition to the periodic summary [Statistics]
+	// delivered to Reporter. This allows sinks that want to compute their own
+	// percentiles, such as a Prometheus histogram, to see every sample
+	// instead of only the periodic summary.
+	SampleObserver SampleObserver
+	// AdaptivePing, if set, makes the Monitor adjust its ping cadence between
+	// AdaptivePingConfig.MinInterval and AdaptivePingConfig.MaxInterval based
+	// on recent ping outcomes and RTT volatility, instead of always pinging
+	// at the fixed PingInterval.
+	AdaptivePing *AdaptivePingConfig
+	// Disabled stops a running [Monitor] from starting new pings or
+	// emitting reports, without tearing it down: [Monitor.Run] keeps its
+	// ticker alive so that a later [Monitor.UpdateConfig] call can flip
+	// this back to false and resume monitoring without recreating the
+	// Monitor. The zero value (false) means enabled, so existing callers
+	// that don't set this field are unaffected.
+	Disabled bool
+}
+
+// AdaptivePingConfig controls how [Monitor] adjusts its ping cadence in
+// response to ping failures and RTT volatility.
+type AdaptivePingConfig struct {
+	// MinInterval is the fastest cadence the Monitor will ping at. Defaults
+	// to 1 second.
+	MinInterval time.Duration
+	// MaxInterval is the slowest cadence the Monitor will ping at, reached
+	// after repeated ping failures. A stable RTT does not lengthen the
+	// cadence; healthy pings move it back toward MinInterval.
+	// Defaults to 30 seconds.
+	MaxInterval time.Duration
+}
+
+// CheckAndSetDefaults validates the config and applies defaults.
+func (c *AdaptivePingConfig) CheckAndSetDefaults() error {
+	if c.MinInterval <= 0 {
+		c.MinInterval = time.Second
+	}
+
+	if c.MaxInterval <= 0 {
+		c.MaxInterval = 30 * time.Second
+	}
+
+	if c.MinInterval > c.MaxInterval {
+		return trace.BadParameter("AdaptivePingConfig.MinInterval must not exceed MaxInterval")
+	}
+
+	return nil
+}
+
+// SampleObserver receives every raw round trip time sample as it is
+// recorded by the [Monitor], labeled by connection leg ("client" or
+// "server").
+type SampleObserver interface {
+	ObserveSample(leg string, sample time.Duration)
+	// ObserveFailure is called in place of ObserveSample when a ping on leg
+	// fails to receive a response.
+	ObserveFailure(leg string)
 }
 
 // CheckAndSetDefaults ensures required fields are provided and sets
@@ -120,6 +199,12 @@ func (c *MonitorConfig) CheckAndSetDefaults() error {
 		c.Clock = clockwork.NewRealClock()
 	}
 
+	if c.AdaptivePing != nil {
+		if err := c.AdaptivePing.CheckAndSetDefaults(); err != nil {
+			return trace.Wrap(err)
+		}
+	}
+
 	return nil
 }
 
@@ -141,36 +226,68 @@ func NewMonitor(cfg MonitorConfig) (*Monitor, error) {
 		return nil, trace.Wrap(err)
 	}
 
-	ticker := interval.NewMulti(
-		cfg.Clock,
+	return &Monitor{
+		clientPinger:   cfg.ClientPinger,
+		serverPinger:   cfg.ServerPinger,
+		reporter:       cfg.Reporter,
+		ticker:         newTicker(cfg.Clock, cfg.PingInterval, cfg.ReportInterval),
+		clock:          cfg.Clock,
+		clientWindow:   newWindow(cfg.SampleWindow, cfg.EWMAShortAlpha, cfg.EWMALongAlpha),
+		serverWindow:   newWindow(cfg.SampleWindow, cfg.EWMAShortAlpha, cfg.EWMALongAlpha),
+		pingInterval:   cfg.PingInterval,
+		reportInterval: cfg.ReportInterval,
+		sampleObserver: cfg.SampleObserver,
+		adaptivePing:   cfg.AdaptivePing,
+		disabled:       cfg.Disabled,
+		configChanged:  make(chan MonitorConfig, 1),
+	}, nil
+}
+
+// newTicker creates the [interval.MultiInterval] driving the ping and
+// reporting cadences.
+func newTicker(clock clockwork.Clock, pingInterval, reportInterval time.Duration) *interval.MultiInterval[string] {
+	return interval.NewMulti(
+		clock,
 		interval.SubInterval[string]{
 			Key:           pingKey,
 			FirstDuration: fullJitter(500 * time.Millisecond),
 			Jitter:        seventhJitter,
-			Duration:      cfg.PingInterval,
+			Duration:      pingInterval,
 		},
 		interval.SubInterval[string]{
 			Key:           reportingKey,
 			FirstDuration: halfJitter(1500 * time.Millisecond),
 			Jitter:        seventhJitter,
-			Duration:      cfg.ReportInterval,
+			Duration:      reportInterval,
 		},
 	)
+}
 
-	return &Monitor{
-		clientPinger: cfg.ClientPinger,
-		serverPinger: cfg.ServerPinger,
-		reporter:     cfg.Reporter,
-		ticker:       ticker,
-		clock:        cfg.Clock,
-	}, nil
+// UpdateConfig reconfigures a running [Monitor] without tearing down the
+// surrounding connection. The ping cadence, reporting cadence, pingers, and
+// reporter may all be changed, and each leg's sample window is resized to
+// cfg.SampleWindow, keeping the most recent samples; the EWMA smoothing
+// factors are fixed for the lifetime of the [Monitor] and are ignored here. It is an
+// error to call UpdateConfig before [Monitor.Run] has been started.
+func (m *Monitor) UpdateConfig(cfg MonitorConfig) error {
+	if err := cfg.CheckAndSetDefaults(); err != nil {
+		return trace.Wrap(err)
+	}
+
+	select {
+	case m.configChanged <- cfg:
+		return nil
+	default:
+		return trace.CompareFailed("a configuration update is already pending")
+	}
 }
 
-// GetStats returns a copy of the last known latency measurements.
+// GetStats returns the summary latency statistics, over the configured
+// sample window, for both legs of the connection.
 func (m *Monitor) GetStats() Statistics {
 	return Statistics{
-		Client: m.clientLatency.Load(),
-		Server: m.serverLatency.Load(),
+		Client: m.clientWindow.stats(),
+		Server: m.serverWindow.stats(),
 	}
 }
 
@@ -180,12 +297,16 @@ func (m *Monitor) Run(ctx context.Context) {
 	defer m.ticker.Stop()
 
 	clientC, serverC := make(chan time.Time, 1), make(chan time.Time, 1)
-	go m.pingLoop(ctx, clientC, m.clientPinger, &m.clientLatency)
-	go m.pingLoop(ctx, serverC, m.serverPinger, &m.serverLatency)
+	go m.pingLoop(ctx, clientC, m.currentClientPinger, m.clientWindow, "client")
+	go m.pingLoop(ctx, serverC, m.currentServerPinger, m.serverWindow, "server")
 
 	for {
 		select {
 		case tick := <-m.ticker.Next():
+			if m.isDisabled() {
+				continue
+			}
+
 			switch tick.Key {
 			case pingKey:
 				// Ping the client
@@ -203,26 +324,147 @@ func (m *Monitor) Run(ctx context.Context) {
 					return
 				default:
 				}
+
+				m.adjustPingInterval()
 			case reportingKey:
-				if err := m.reporter.Report(ctx, m.GetStats()); err != nil {
+				if err := m.currentReporter().Report(ctx, m.GetStats()); err != nil {
 					log.WithError(err).Warn("failed to report latency stats")
 				}
 			}
+		case cfg := <-m.configChanged:
+			m.applyConfig(cfg)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func (m *Monitor) pingLoop(ctx context.Context, pingC <-chan time.Time, pinger Pinger, latency *atomic.Int64) {
+// applyConfig swaps in the pingers and reporter from cfg and, if the ping or
+// reporting cadence changed, recreates the underlying ticker so the new
+// period takes effect immediately.
+func (m *Monitor) applyConfig(cfg MonitorConfig) {
+	m.mu.Lock()
+	oldPingInterval, oldReportInterval := m.pingInterval, m.reportInterval
+	m.clientPinger = cfg.ClientPinger
+	m.serverPinger = cfg.ServerPinger
+	m.reporter = cfg.Reporter
+	m.pingInterval = cfg.PingInterval
+	m.reportInterval = cfg.ReportInterval
+	m.sampleObserver = cfg.SampleObserver
+	m.adaptivePing = cfg.AdaptivePing
+	m.disabled = cfg.Disabled
+	m.mu.Unlock()
+
+	m.clientWindow.resize(cfg.SampleWindow)
+	m.serverWindow.resize(cfg.SampleWindow)
+
+	if cfg.PingInterval == oldPingInterval && cfg.ReportInterval == oldReportInterval {
+		return
+	}
+
+	m.ticker.Stop()
+	m.ticker = newTicker(m.clock, cfg.PingInterval, cfg.ReportInterval)
+}
+
+// adjustPingInterval adapts the ping cadence based on recent ping outcomes
+// and RTT volatility, per [MonitorConfig.AdaptivePing]: it backs off
+// exponentially (up to MaxInterval) after a loss on either leg, decays back
+// toward MinInterval when both legs are healthy, and shortens further when
+// jitter is high enough to suggest closer sampling is worthwhile. It
+// recreates the ticker in place if the cadence changed.
+func (m *Monitor) adjustPingInterval() {
+	m.mu.Lock()
+	adaptive := m.adaptivePing
+	current := m.pingInterval
+	reportInterval := m.reportInterval
+	m.mu.Unlock()
+
+	if adaptive == nil {
+		return
+	}
+
+	stats := m.GetStats()
+
+	next := current
+	switch {
+	case stats.Client.PacketLoss > 0 || stats.Server.PacketLoss > 0:
+		next = current * 2
+	case time.Duration(stats.Client.Jitter)*time.Millisecond > current/10 ||
+		time.Duration(stats.Server.Jitter)*time.Millisecond > current/10:
+		next = current / 2
+	default:
+		next = current - (current-adaptive.MinInterval)/4
+	}
+
+	if next < adaptive.MinInterval {
+		next = adaptive.MinInterval
+	}
+	if next > adaptive.MaxInterval {
+		next = adaptive.MaxInterval
+	}
+
+	if next == current {
+		return
+	}
+
+	m.mu.Lock()
+	m.pingInterval = next
+	m.mu.Unlock()
+
+	m.ticker.Stop()
+	m.ticker = newTicker(m.clock, next, reportInterval)
+}
+
+func (m *Monitor) currentClientPinger() Pinger {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.clientPinger
+}
+
+func (m *Monitor) currentServerPinger() Pinger {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.serverPinger
+}
+
+func (m *Monitor) currentReporter() Reporter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reporter
+}
+
+func (m *Monitor) currentSampleObserver() SampleObserver {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sampleObserver
+}
+
+// isDisabled reports whether the [Monitor] is currently configured with
+// [MonitorConfig.Disabled], in which case [Monitor.Run] skips sending pings
+// and emitting reports on each tick without stopping the ticker itself.
+func (m *Monitor) isDisabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.disabled
+}
+
+func (m *Monitor) pingLoop(ctx context.Context, pingC <-chan time.Time, pinger func() Pinger, w *window, leg string) {
 	for {
 		select {
 		case <-ctx.Done():
 		case then := <-pingC:
-			if err := pinger.Ping(ctx); err != nil {
+			if err := pinger().Ping(ctx); err != nil {
 				log.WithError(err).Warn("unexpected failure sending ping")
+				w.recordLoss()
+				if observer := m.currentSampleObserver(); observer != nil {
+					observer.ObserveFailure(leg)
+				}
 			} else {
-				latency.Store(m.clock.Now().Sub(then).Milliseconds())
+				sample := m.clock.Now().Sub(then)
+				w.add(sample)
+				if observer := m.currentSampleObserver(); observer != nil {
+					observer.ObserveSample(leg, sample)
+				}
 			}
 		}
 	}
@@ -270,12 +512,22 @@ type WebSocket interface {
 	SetPongHandler(h func(appData string) error)
 }
 
+// maxInFlightPings caps the number of concurrent [WebSocketPinger.Ping]
+// calls awaiting a pong, so a connection that stops responding cannot
+// accumulate an unbounded number of blocked goroutines and waiter entries.
+const maxInFlightPings = 32
+
 // WebSocketPinger is a [Pinger] implementation that measures the latency of a
-// websocket connection.
+// websocket connection. It supports multiple concurrent calls to
+// [WebSocketPinger.Ping]: each call is assigned its own identifier and
+// waiter, so pongs are never dropped or misattributed regardless of the
+// order in which they arrive.
 type WebSocketPinger struct {
 	ws    WebSocket
-	pongC chan string
 	clock clockwork.Clock
+
+	mu      sync.Mutex
+	waiters map[string]chan time.Time
 }
 
 // NewWebsocketPinger creates a [WebSocketPinger] with the provided configuration.
@@ -289,17 +541,14 @@ func NewWebsocketPinger(clock clockwork.Clock, ws WebSocket) (*WebSocketPinger,
 	}
 
 	pinger := &WebSocketPinger{
-		ws:    ws,
-		clock: clock,
-		pongC: make(chan string, 1),
+		ws:      ws,
+		clock:   clock,
+		waiters: make(map[string]chan time.Time),
 	}
 
 	handler := ws.PongHandler()
 	ws.SetPongHandler(func(payload string) error {
-		select {
-		case pinger.pongC <- payload:
-		default:
-		}
+		pinger.deliver(payload)
 
 		if handler == nil {
 			return nil
@@ -311,6 +560,23 @@ func NewWebsocketPinger(clock clockwork.Clock, ws WebSocket) (*WebSocketPinger,
 	return pinger, nil
 }
 
+// deliver signals the waiter registered for payload, if any. Pongs for
+// unrecognized or already-completed pings are silently discarded.
+func (s *WebSocketPinger) deliver(payload string) {
+	s.mu.Lock()
+	waiter, ok := s.waiters[payload]
+	s.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	select {
+	case waiter <- s.clock.Now():
+	default:
+	}
+}
+
 // Ping writes a ping control message and waits for the corresponding pong control message
 // to be received before returning. The random identifier in the ping message is expected
 // to be returned in the pong payload so that we can determine the true round trip time for
@@ -320,19 +586,31 @@ func (s *WebSocketPinger) Ping(ctx context.Context) error {
 	const websocketPingMessage = 9
 
 	payload := uuid.NewString()
+	waiter := make(chan time.Time, 1)
+
+	s.mu.Lock()
+	if len(s.waiters) >= maxInFlightPings {
+		s.mu.Unlock()
+		return trace.LimitExceeded("too many in-flight pings")
+	}
+	s.waiters[payload] = waiter
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.waiters, payload)
+		s.mu.Unlock()
+	}()
+
 	deadline := s.clock.Now().Add(2 * time.Second)
 	if err := s.ws.WriteControl(websocketPingMessage, []byte(payload), deadline); err != nil {
 		return trace.Wrap(err, "sending ping message")
 	}
 
-	for {
-		select {
-		case pong := <-s.pongC:
-			if pong == payload {
-				return nil
-			}
-		case <-ctx.Done():
-			return trace.Wrap(ctx.Err())
-		}
+	select {
+	case <-waiter:
+		return nil
+	case <-ctx.Done():
+		return trace.Wrap(ctx.Err())
 	}
 }
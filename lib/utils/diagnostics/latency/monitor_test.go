@@ -121,3 +121,131 @@ func TestMonitor(t *testing.T) {
 		}
 	}
 }
+
+func TestMonitorUpdateConfigChangesCadence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	clock := clockwork.NewFakeClock()
+
+	reporter := fakeReporter{
+		statsC: make(chan Statistics, 20),
+	}
+
+	clientPinger := fakePinger{clock: clock, latency: time.Second, pingC: make(chan struct{}, 1)}
+	serverPinger := fakePinger{clock: clock, latency: time.Second, pingC: make(chan struct{}, 1)}
+
+	monitor, err := NewMonitor(MonitorConfig{
+		ClientPinger:   clientPinger,
+		ServerPinger:   serverPinger,
+		Reporter:       reporter,
+		Clock:          clock,
+		PingInterval:   3 * time.Second,
+		ReportInterval: 5 * time.Second,
+	})
+	require.NoError(t, err, "creating monitor")
+
+	go func() {
+		monitor.Run(ctx)
+	}()
+
+	// Drive a few pings at the initial 3s cadence so the test establishes
+	// the ticker is actually running before reconfiguring it.
+	for i := 0; i < 3; i++ {
+		monitor.ticker.FireNow(pingKey)
+		for j := 0; j < 2; j++ {
+			select {
+			case <-clientPinger.pingC:
+			case <-serverPinger.pingC:
+			case <-time.After(15 * time.Second):
+				t.Fatal("ping never processed")
+			}
+		}
+	}
+
+	require.NoError(t, monitor.UpdateConfig(MonitorConfig{
+		ClientPinger:   clientPinger,
+		ServerPinger:   serverPinger,
+		Reporter:       reporter,
+		Clock:          clock,
+		PingInterval:   time.Second,
+		ReportInterval: 5 * time.Second,
+	}))
+
+	require.Eventually(t, func() bool {
+		return monitor.pingInterval == time.Second
+	}, time.Second, time.Millisecond, "monitor should adopt the new ping cadence")
+
+	monitor.ticker.FireNow(pingKey)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-clientPinger.pingC:
+		case <-serverPinger.pingC:
+		case <-time.After(15 * time.Second):
+			t.Fatal("ping never processed at the new cadence")
+		}
+	}
+}
+
+func TestMonitorDisabledSkipsPingsAndReports(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	clock := clockwork.NewFakeClock()
+
+	reporter := fakeReporter{
+		statsC: make(chan Statistics, 20),
+	}
+
+	clientPinger := fakePinger{clock: clock, latency: time.Second, pingC: make(chan struct{}, 1)}
+	serverPinger := fakePinger{clock: clock, latency: time.Second, pingC: make(chan struct{}, 1)}
+
+	monitor, err := NewMonitor(MonitorConfig{
+		ClientPinger:   clientPinger,
+		ServerPinger:   serverPinger,
+		Reporter:       reporter,
+		Clock:          clock,
+		PingInterval:   3 * time.Second,
+		ReportInterval: 5 * time.Second,
+		Disabled:       true,
+	})
+	require.NoError(t, err, "creating monitor")
+
+	go func() {
+		monitor.Run(ctx)
+	}()
+
+	monitor.ticker.FireNow(pingKey)
+	monitor.ticker.FireNow(reportingKey)
+	select {
+	case <-clientPinger.pingC:
+		t.Fatal("disabled monitor should not ping the client")
+	case <-serverPinger.pingC:
+		t.Fatal("disabled monitor should not ping the server")
+	case <-reporter.statsC:
+		t.Fatal("disabled monitor should not emit reports")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, monitor.UpdateConfig(MonitorConfig{
+		ClientPinger:   clientPinger,
+		ServerPinger:   serverPinger,
+		Reporter:       reporter,
+		Clock:          clock,
+		PingInterval:   3 * time.Second,
+		ReportInterval: 5 * time.Second,
+		Disabled:       false,
+	}))
+
+	require.Eventually(t, func() bool {
+		return !monitor.isDisabled()
+	}, time.Second, time.Millisecond, "monitor should re-enable")
+
+	monitor.ticker.FireNow(pingKey)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-clientPinger.pingC:
+		case <-serverPinger.pingC:
+		case <-time.After(15 * time.Second):
+			t.Fatal("ping never processed after re-enabling")
+		}
+	}
+}
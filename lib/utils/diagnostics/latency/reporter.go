@@ -0,0 +1,303 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package latency
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// multiReporterBufferSize bounds how many pending [Statistics] a
+// [MultiReporter] queues per sink before it starts dropping reports for
+// that sink, so one slow or stuck Reporter can't block Report or delay
+// delivery to the other sinks.
+const multiReporterBufferSize = 8
+
+// MultiReporter fans out latency statistics to a set of [Reporter]s. Each
+// sink is fed from its own bounded buffered channel by its own goroutine,
+// so a slow sink only drops its own reports (counted in droppedTotal) and
+// never blocks Report or the other sinks.
+type MultiReporter struct {
+	sinks []*multiReporterSink
+}
+
+// multiReporterSink pairs a Reporter with the buffered channel and worker
+// goroutine that feed it asynchronously.
+type multiReporterSink struct {
+	reporter     Reporter
+	queue        chan Statistics
+	droppedTotal atomic.Uint64
+}
+
+// NewMultiReporter creates a [Reporter] that asynchronously reports to each
+// of the provided reporters. Callers should call Close once the
+// MultiReporter is no longer needed, to stop its worker goroutines.
+func NewMultiReporter(reporters ...Reporter) *MultiReporter {
+	m := &MultiReporter{sinks: make([]*multiReporterSink, 0, len(reporters))}
+	for _, r := range reporters {
+		sink := &multiReporterSink{reporter: r, queue: make(chan Statistics, multiReporterBufferSize)}
+		m.sinks = append(m.sinks, sink)
+		go sink.run()
+	}
+	return m
+}
+
+// run delivers every Statistics sent on s.queue to s.reporter, exiting once
+// s.queue is closed. Report errors are logged rather than returned, since
+// by the time a worker observes one the call that produced the report has
+// already returned.
+func (s *multiReporterSink) run() {
+	for stats := range s.queue {
+		if err := s.reporter.Report(context.Background(), stats); err != nil {
+			log.WithError(err).Warn("Failed to report latency statistics to a MultiReporter sink.")
+		}
+	}
+}
+
+// Report enqueues stats for each configured sink without blocking. A sink
+// whose buffer is full has this report dropped, and droppedTotal
+// incremented, rather than blocking Report or the other sinks.
+func (m *MultiReporter) Report(_ context.Context, stats Statistics) error {
+	for _, sink := range m.sinks {
+		select {
+		case sink.queue <- stats:
+		default:
+			dropped := sink.droppedTotal.Add(1)
+			log.Warnf("Dropped latency report for a slow MultiReporter sink (%d dropped so far).", dropped)
+		}
+	}
+	return nil
+}
+
+// Close stops every sink's worker goroutine once its queued reports have
+// been delivered. Report must not be called after Close.
+func (m *MultiReporter) Close() {
+	for _, sink := range m.sinks {
+		close(sink.queue)
+	}
+}
+
+// legLabel is the label value used to distinguish the client and server
+// legs of a connection in exported metrics.
+const legLabel = "leg"
+
+// ReporterLabels identifies the cluster, host, and session that a
+// [PrometheusReporter] or [OTelReporter] is recording statistics for, so
+// that a single Teleport auth service exporting metrics from many
+// concurrent [Monitor]s can distinguish between them.
+type ReporterLabels struct {
+	// Cluster is the name of the Teleport cluster the monitored connection
+	// belongs to.
+	Cluster string
+	// HostID is the ID of the Teleport instance running the Monitor.
+	HostID string
+	// SessionID is the ID of the session whose connection is being
+	// monitored.
+	SessionID string
+}
+
+// names returns the Prometheus/OTel label names this package's reporters
+// use, in the order values returns their values.
+func (ReporterLabels) names() []string {
+	return []string{legLabel, "cluster", "host_id", "session_id"}
+}
+
+// values returns l's label values for connection leg leg, in the order
+// names returns their names.
+func (l ReporterLabels) values(leg string) []string {
+	return []string{leg, l.Cluster, l.HostID, l.SessionID}
+}
+
+// PrometheusReporter is a [Reporter] that records latency statistics as
+// Prometheus gauges, labeled by connection leg and [ReporterLabels].
+type PrometheusReporter struct {
+	labels     ReporterLabels
+	current    *prometheus.GaugeVec
+	p50        *prometheus.GaugeVec
+	p90        *prometheus.GaugeVec
+	p99        *prometheus.GaugeVec
+	jitter     *prometheus.GaugeVec
+	packetLoss *prometheus.GaugeVec
+}
+
+// NewPrometheusReporter creates a [PrometheusReporter] and registers its
+// collectors with reg. labels are attached to every metric this reporter
+// records, identifying which cluster, host, and session it was created
+// for.
+func NewPrometheusReporter(reg prometheus.Registerer, labels ReporterLabels) (*PrometheusReporter, error) {
+	r := &PrometheusReporter{
+		labels:     labels,
+		current:    gaugeVec("latency_current_ms", "Most recently observed round trip time in milliseconds.", ReporterLabels{}.names()),
+		p50:        gaugeVec("latency_p50_ms", "50th percentile round trip time in milliseconds.", ReporterLabels{}.names()),
+		p90:        gaugeVec("latency_p90_ms", "90th percentile round trip time in milliseconds.", ReporterLabels{}.names()),
+		p99:        gaugeVec("latency_p99_ms", "99th percentile round trip time in milliseconds.", ReporterLabels{}.names()),
+		jitter:     gaugeVec("latency_jitter_ms", "Round trip time jitter in milliseconds.", ReporterLabels{}.names()),
+		packetLoss: gaugeVec("latency_packet_loss_percent", "Percentage of pings that did not receive a response.", ReporterLabels{}.names()),
+	}
+
+	for _, c := range []*prometheus.GaugeVec{r.current, r.p50, r.p90, r.p99, r.jitter, r.packetLoss} {
+		if err := reg.Register(c); err != nil {
+			return nil, trace.Wrap(err, "registering latency collector")
+		}
+	}
+
+	return r, nil
+}
+
+func gaugeVec(name, help string, labelNames []string) *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: name,
+		Help: help,
+	}, labelNames)
+}
+
+// Report records stats for both connection legs.
+func (p *PrometheusReporter) Report(_ context.Context, stats Statistics) error {
+	p.observe("client", stats.Client)
+	p.observe("server", stats.Server)
+	return nil
+}
+
+func (p *PrometheusReporter) observe(leg string, stats LegStatistics) {
+	values := p.labels.values(leg)
+	p.current.WithLabelValues(values...).Set(float64(stats.Current))
+	p.p50.WithLabelValues(values...).Set(float64(stats.P50))
+	p.p90.WithLabelValues(values...).Set(float64(stats.P90))
+	p.p99.WithLabelValues(values...).Set(float64(stats.P99))
+	p.jitter.WithLabelValues(values...).Set(float64(stats.Jitter))
+	p.packetLoss.WithLabelValues(values...).Set(stats.PacketLoss)
+}
+
+// OTelReporter is a [Reporter] that records latency statistics as
+// OpenTelemetry instruments, labeled by connection leg and
+// [ReporterLabels].
+type OTelReporter struct {
+	labels     ReporterLabels
+	current    metric.Int64Gauge
+	p50        metric.Int64Gauge
+	p90        metric.Int64Gauge
+	p99        metric.Int64Gauge
+	jitter     metric.Int64Gauge
+	packetLoss metric.Float64Gauge
+}
+
+// NewOTelReporter creates an [OTelReporter] that records instruments
+// against the provided [metric.Meter]. labels are attached to every
+// instrument this reporter records, identifying which cluster, host, and
+// session it was created for.
+func NewOTelReporter(meter metric.Meter, labels ReporterLabels) (*OTelReporter, error) {
+	var err error
+	r := &OTelReporter{labels: labels}
+
+	if r.current, err = meter.Int64Gauge("latency.current", metric.WithUnit("ms")); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if r.p50, err = meter.Int64Gauge("latency.p50", metric.WithUnit("ms")); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if r.p90, err = meter.Int64Gauge("latency.p90", metric.WithUnit("ms")); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if r.p99, err = meter.Int64Gauge("latency.p99", metric.WithUnit("ms")); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if r.jitter, err = meter.Int64Gauge("latency.jitter", metric.WithUnit("ms")); err != nil {
+		return nil, trace.Wrap(err)
+	}
+	if r.packetLoss, err = meter.Float64Gauge("latency.packet_loss", metric.WithUnit("%")); err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	return r, nil
+}
+
+// Report records stats for both connection legs.
+func (o *OTelReporter) Report(ctx context.Context, stats Statistics) error {
+	o.observe(ctx, "client", stats.Client)
+	o.observe(ctx, "server", stats.Server)
+	return nil
+}
+
+func (o *OTelReporter) observe(ctx context.Context, leg string, stats LegStatistics) {
+	opt := metric.WithAttributes(
+		attribute.String(legLabel, leg),
+		attribute.String("cluster", o.labels.Cluster),
+		attribute.String("host_id", o.labels.HostID),
+		attribute.String("session_id", o.labels.SessionID),
+	)
+	o.current.Record(ctx, stats.Current, opt)
+	o.p50.Record(ctx, stats.P50, opt)
+	o.p90.Record(ctx, stats.P90, opt)
+	o.p99.Record(ctx, stats.P99, opt)
+	o.jitter.Record(ctx, stats.Jitter, opt)
+	o.packetLoss.Record(ctx, stats.PacketLoss, opt)
+}
+
+// PrometheusHistogramReporter is a [SampleObserver] that records every raw
+// round trip time sample into a Prometheus histogram, labeled by connection
+// leg. Unlike [PrometheusReporter], which only exports the periodic
+// percentiles computed by the [Monitor]'s own rolling window, a histogram
+// lets Prometheus compute percentiles (and arbitrary quantiles) across any
+// time range at query time via histogram_quantile(). It also tracks ping
+// failures and the last observed round trip time, so operators don't need
+// to stand up both a [PrometheusReporter] and a histogram side by side.
+type PrometheusHistogramReporter struct {
+	rtt      *prometheus.HistogramVec
+	lastRTT  *prometheus.GaugeVec
+	failures *prometheus.CounterVec
+}
+
+// NewPrometheusHistogramReporter creates a [PrometheusHistogramReporter] and
+// registers its collectors with reg. Buckets are 14 doubling steps from 1ms
+// to about 8.2s, matching common Grafana latency dashboards.
+func NewPrometheusHistogramReporter(reg prometheus.Registerer) (*PrometheusHistogramReporter, error) {
+	r := &PrometheusHistogramReporter{
+		rtt: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "latency_rtt_seconds",
+			Help:    "Round trip time of individual latency probes in seconds.",
+			Buckets: prometheus.ExponentialBuckets(1e-3, 2, 14),
+		}, []string{legLabel}),
+		lastRTT: gaugeVec("latency_last_rtt_ms", "Round trip time of the most recently observed latency probe in milliseconds.", []string{legLabel}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "latency_ping_failures_total",
+			Help: "Number of latency probes that did not receive a response.",
+		}, []string{legLabel}),
+	}
+
+	for _, c := range []prometheus.Collector{r.rtt, r.lastRTT, r.failures} {
+		if err := reg.Register(c); err != nil {
+			return nil, trace.Wrap(err, "registering latency histogram collector")
+		}
+	}
+
+	return r, nil
+}
+
+// ObserveSample implements [SampleObserver].
+func (r *PrometheusHistogramReporter) ObserveSample(leg string, sample time.Duration) {
+	r.rtt.WithLabelValues(leg).Observe(sample.Seconds())
+	r.lastRTT.WithLabelValues(leg).Set(float64(sample.Milliseconds()))
+}
+
+// ObserveFailure implements [SampleObserver].
+func (r *PrometheusHistogramReporter) ObserveFailure(leg string) {
+	r.failures.WithLabelValues(leg).Inc()
+}
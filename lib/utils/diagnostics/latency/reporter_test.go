@@ -0,0 +1,175 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package latency
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// blockingReporter blocks inside Report until unblock is closed, so tests
+// can simulate a slow sink. started fires once, the first time Report is
+// entered, so callers can wait for the sink to be blocked before relying
+// on the MultiReporter's buffer being empty.
+type blockingReporter struct {
+	unblock   chan struct{}
+	started   chan struct{}
+	startOnce sync.Once
+	reports   int
+	mu        sync.Mutex
+}
+
+func (b *blockingReporter) Report(ctx context.Context, stats Statistics) error {
+	b.startOnce.Do(func() { close(b.started) })
+	<-b.unblock
+	b.mu.Lock()
+	b.reports++
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *blockingReporter) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reports
+}
+
+func TestMultiReporterDropsOnFullBuffer(t *testing.T) {
+	slow := &blockingReporter{unblock: make(chan struct{}), started: make(chan struct{})}
+	m := NewMultiReporter(slow)
+	t.Cleanup(m.Close)
+
+	// The first report is picked up by the worker and blocks it inside
+	// Report; wait for that to happen so the buffer below fills
+	// deterministically.
+	require.NoError(t, m.Report(context.Background(), Statistics{}))
+	select {
+	case <-slow.started:
+	case <-time.After(time.Second):
+		t.Fatal("worker never entered Report")
+	}
+
+	// The buffer now has room for exactly multiReporterBufferSize more
+	// reports before Report starts dropping them instead of blocking.
+	for i := 0; i < multiReporterBufferSize+5; i++ {
+		require.NoError(t, m.Report(context.Background(), Statistics{}))
+	}
+
+	require.Equal(t, uint64(5), m.sinks[0].droppedTotal.Load())
+
+	close(slow.unblock)
+	require.Eventually(t, func() bool {
+		return slow.count() == multiReporterBufferSize+1
+	}, time.Second, time.Millisecond, "the first report plus every buffered one should eventually be delivered")
+}
+
+func TestMultiReporterFansOutToAllSinks(t *testing.T) {
+	var mu sync.Mutex
+	var got []Statistics
+
+	reporter := ReporterFunc(func(ctx context.Context, stats Statistics) error {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, stats)
+		return nil
+	})
+
+	m := NewMultiReporter(reporter, reporter)
+	t.Cleanup(m.Close)
+
+	stats := Statistics{Client: LegStatistics{Current: 42}}
+	require.NoError(t, m.Report(context.Background(), stats))
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 2
+	}, time.Second, time.Millisecond)
+}
+
+func TestPrometheusReporterLabels(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	r, err := NewPrometheusReporter(reg, ReporterLabels{Cluster: "leaf.example.com", HostID: "host-1", SessionID: "sess-1"})
+	require.NoError(t, err)
+
+	require.NoError(t, r.Report(context.Background(), Statistics{
+		Client: LegStatistics{Current: 10},
+		Server: LegStatistics{Current: 20},
+	}))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	var current *dto.MetricFamily
+	for _, f := range families {
+		if f.GetName() == "latency_current_ms" {
+			current = f
+		}
+	}
+	require.NotNil(t, current, "latency_current_ms family should be registered")
+	require.Len(t, current.Metric, 2, "one series per connection leg")
+
+	for _, m := range current.Metric {
+		labels := map[string]string{}
+		for _, l := range m.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		require.Equal(t, "leaf.example.com", labels["cluster"])
+		require.Equal(t, "host-1", labels["host_id"])
+		require.Equal(t, "sess-1", labels["session_id"])
+		require.Contains(t, []string{"client", "server"}, labels["leg"])
+	}
+}
+
+func TestOTelReporterLabels(t *testing.T) {
+	reader := metric.NewManualReader()
+	provider := metric.NewMeterProvider(metric.WithReader(reader))
+
+	r, err := NewOTelReporter(provider.Meter("latency"), ReporterLabels{Cluster: "leaf.example.com", HostID: "host-1", SessionID: "sess-1"})
+	require.NoError(t, err)
+	require.NoError(t, r.Report(context.Background(), Statistics{
+		Client: LegStatistics{Current: 10},
+		Server: LegStatistics{Current: 20},
+	}))
+
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &data))
+
+	found := false
+	for _, sm := range data.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "latency.current" {
+				continue
+			}
+			gauge, ok := m.Data.(metricdata.Gauge[int64])
+			require.True(t, ok)
+			for _, dp := range gauge.DataPoints {
+				cluster, ok := dp.Attributes.Value("cluster")
+				require.True(t, ok)
+				require.Equal(t, "leaf.example.com", cluster.AsString())
+				found = true
+			}
+		}
+	}
+	require.True(t, found, "latency.current should have been recorded with the cluster attribute")
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package latency
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWebSocket is a [WebSocket] that immediately echoes every control
+// message it's asked to write back through its pong handler, simulating a
+// peer that always responds to pings.
+type fakeWebSocket struct {
+	mu      sync.Mutex
+	handler func(string) error
+}
+
+func (f *fakeWebSocket) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	f.mu.Lock()
+	handler := f.handler
+	f.mu.Unlock()
+
+	if handler != nil {
+		go handler(string(data))
+	}
+	return nil
+}
+
+func (f *fakeWebSocket) PongHandler() func(string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.handler
+}
+
+func (f *fakeWebSocket) SetPongHandler(h func(string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handler = h
+}
+
+func TestWebSocketPingerConcurrent(t *testing.T) {
+	t.Parallel()
+
+	ws := &fakeWebSocket{}
+	pinger, err := NewWebsocketPinger(clockwork.NewFakeClock(), ws)
+	require.NoError(t, err, "creating websocket pinger")
+
+	const concurrent = 10
+
+	var wg sync.WaitGroup
+	errsC := make(chan error, concurrent)
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errsC <- pinger.Ping(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errsC)
+
+	for err := range errsC {
+		assert.NoError(t, err, "expected every concurrent ping to be acknowledged by its own pong")
+	}
+}
+
+func TestWebSocketPingerMaxInFlight(t *testing.T) {
+	t.Parallel()
+
+	// A pong handler that never replies, so every ping stays in flight until
+	// its context is canceled.
+	ws := &fakeWebSocket{}
+	pinger, err := NewWebsocketPinger(clockwork.NewFakeClock(), ws)
+	require.NoError(t, err, "creating websocket pinger")
+	ws.SetPongHandler(func(string) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < maxInFlightPings; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pinger.Ping(ctx)
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		pinger.mu.Lock()
+		defer pinger.mu.Unlock()
+		return len(pinger.waiters) == maxInFlightPings
+	}, time.Second, time.Millisecond, "expected every ping to register a waiter")
+
+	err = pinger.Ping(ctx)
+	assert.True(t, trace.IsLimitExceeded(err), "expected exceeding the in-flight cap to return a LimitExceeded error")
+
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,268 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package latency
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultSampleWindow is the number of recent samples retained per leg
+// when MonitorConfig.SampleWindow is not provided.
+const defaultSampleWindow = 256
+
+// defaultEWMAShortAlpha and defaultEWMALongAlpha are used for the short and
+// long EWMA values when MonitorConfig.EWMAShortAlpha/EWMALongAlpha are not
+// provided.
+const (
+	defaultEWMAShortAlpha = 0.3
+	defaultEWMALongAlpha  = 0.05
+)
+
+// LegStatistics contains summary round trip time measurements for a single
+// leg (client or server) of a proxied connection, computed over the trailing
+// window of samples retained by [window].
+type LegStatistics struct {
+	// Current is the most recently recorded round trip time, in milliseconds.
+	Current int64
+	// Min is the smallest round trip time in the current window, in milliseconds.
+	Min int64
+	// Max is the largest round trip time in the current window, in milliseconds.
+	Max int64
+	// Mean is the average round trip time in the current window, in milliseconds.
+	Mean int64
+	// P50 is the 50th percentile round trip time in the current window, in milliseconds.
+	P50 int64
+	// P90 is the 90th percentile round trip time in the current window, in milliseconds.
+	P90 int64
+	// P95 is the 95th percentile round trip time in the current window, in milliseconds.
+	P95 int64
+	// P99 is the 99th percentile round trip time in the current window, in milliseconds.
+	P99 int64
+	// EWMAShort is an exponentially weighted moving average of the round trip
+	// time that reacts quickly to recent samples.
+	EWMAShort int64
+	// EWMALong is an exponentially weighted moving average of the round trip
+	// time that reacts slowly to recent samples, smoothing out short spikes.
+	EWMALong int64
+	// PacketLoss is the percentage, between 0 and 100, of pings that did not
+	// receive a response over the lifetime of the [window].
+	PacketLoss float64
+	// Jitter is the mean deviation of the round trip time between consecutive
+	// samples, in milliseconds, as defined by RFC 3550 section 6.4.1.
+	Jitter int64
+}
+
+// window is a fixed-size ring buffer of round trip time samples along with
+// the running EWMA values for a single leg of a connection. It is safe for
+// concurrent use.
+type window struct {
+	mu sync.Mutex
+
+	samples    []time.Duration
+	next       int
+	count      int
+	shortAlpha float64
+	longAlpha  float64
+	ewmaShort  float64
+	ewmaLong   float64
+	haveEWMA   bool
+
+	sent     uint64
+	received uint64
+	lastSent time.Duration
+	haveLast bool
+	jitter   float64
+}
+
+// newWindow creates a [window] that retains up to size samples and
+// computes EWMA values using the provided smoothing factors.
+func newWindow(size int, shortAlpha, longAlpha float64) *window {
+	if size <= 0 {
+		size = defaultSampleWindow
+	}
+
+	if shortAlpha <= 0 {
+		shortAlpha = defaultEWMAShortAlpha
+	}
+
+	if longAlpha <= 0 {
+		longAlpha = defaultEWMALongAlpha
+	}
+
+	return &window{
+		samples:    make([]time.Duration, size),
+		shortAlpha: shortAlpha,
+		longAlpha:  longAlpha,
+	}
+}
+
+// add records a new round trip time sample, evicting the oldest sample
+// once the window is full.
+func (w *window) add(sample time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sent++
+	w.received++
+
+	w.samples[w.next] = sample
+	w.next = (w.next + 1) % len(w.samples)
+	if w.count < len(w.samples) {
+		w.count++
+	}
+
+	f := float64(sample)
+	if !w.haveEWMA {
+		w.ewmaShort, w.ewmaLong = f, f
+		w.haveEWMA = true
+	} else {
+		w.ewmaShort = w.shortAlpha*f + (1-w.shortAlpha)*w.ewmaShort
+		w.ewmaLong = w.longAlpha*f + (1-w.longAlpha)*w.ewmaLong
+	}
+
+	if w.haveLast {
+		d := float64(sample - w.lastSent)
+		if d < 0 {
+			d = -d
+		}
+		w.jitter += (d - w.jitter) / 16
+	}
+	w.lastSent = sample
+	w.haveLast = true
+}
+
+// recordLoss accounts for a ping that was sent but never received a
+// response, so that it is reflected in [LegStatistics.PacketLoss].
+func (w *window) recordLoss() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.sent++
+}
+
+// orderedLocked returns the retained samples oldest-to-newest. w.mu must
+// already be held by the caller.
+func (w *window) orderedLocked() []time.Duration {
+	ordered := make([]time.Duration, w.count)
+	for i := 0; i < w.count; i++ {
+		// Samples are stored oldest-to-newest starting at w.next when the
+		// window has wrapped; when it hasn't, they simply start at index 0.
+		idx := i
+		if w.count == len(w.samples) {
+			idx = (w.next + i) % len(w.samples)
+		}
+		ordered[i] = w.samples[idx]
+	}
+	return ordered
+}
+
+// resize changes the number of samples the window retains, keeping the most
+// recent min(size, count) samples and discarding the rest. It is called when
+// [MonitorConfig.SampleWindow] changes via [Monitor.UpdateConfig].
+func (w *window) resize(size int) {
+	if size <= 0 {
+		size = defaultSampleWindow
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if size == len(w.samples) {
+		return
+	}
+
+	ordered := w.orderedLocked()
+	if len(ordered) > size {
+		ordered = ordered[len(ordered)-size:]
+	}
+
+	samples := make([]time.Duration, size)
+	copy(samples, ordered)
+
+	w.samples = samples
+	w.count = len(ordered)
+	w.next = w.count % size
+}
+
+// stats computes the current summary statistics over the retained samples.
+// Percentiles are calculated by sorting a copy of the window, which is cheap
+// enough for the sample window sizes the [Monitor] is expected to use.
+func (w *window) stats() LegStatistics {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.count == 0 {
+		var loss float64
+		if w.sent > 0 {
+			loss = 100 * float64(w.sent-w.received) / float64(w.sent)
+		}
+		return LegStatistics{PacketLoss: loss}
+	}
+
+	sorted := w.orderedLocked()
+	current := sorted[w.count-1]
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum time.Duration
+	for _, s := range sorted {
+		sum += s
+	}
+
+	var loss float64
+	if w.sent > 0 {
+		loss = 100 * float64(w.sent-w.received) / float64(w.sent)
+	}
+
+	return LegStatistics{
+		Current:    current.Milliseconds(),
+		Min:        sorted[0].Milliseconds(),
+		Max:        sorted[len(sorted)-1].Milliseconds(),
+		Mean:       (sum / time.Duration(len(sorted))).Milliseconds(),
+		P50:        percentile(sorted, 0.50).Milliseconds(),
+		P90:        percentile(sorted, 0.90).Milliseconds(),
+		P95:        percentile(sorted, 0.95).Milliseconds(),
+		P99:        percentile(sorted, 0.99).Milliseconds(),
+		EWMAShort:  time.Duration(w.ewmaShort).Milliseconds(),
+		EWMALong:   time.Duration(w.ewmaLong).Milliseconds(),
+		PacketLoss: loss,
+		Jitter:     time.Duration(w.jitter).Milliseconds(),
+	}
+}
+
+// percentile returns the value at the given percentile (0-1) from a
+// pre-sorted slice of samples using linear interpolation between the
+// two nearest ranks.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := p * float64(len(sorted)-1)
+	lo := int(rank)
+	hi := lo + 1
+	if hi >= len(sorted) {
+		return sorted[lo]
+	}
+
+	frac := rank - float64(lo)
+	return sorted[lo] + time.Duration(frac*float64(sorted[hi]-sorted[lo]))
+}
@@ -17,7 +17,9 @@ limitations under the License.
 package app
 
 import (
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -31,7 +33,9 @@ import (
 	"github.com/gravitational/teleport/lib/auth"
 	"github.com/gravitational/teleport/lib/events"
 	"github.com/gravitational/teleport/lib/httplib"
+	"github.com/gravitational/teleport/lib/tlsca"
 	"github.com/gravitational/teleport/lib/utils"
+	"github.com/gravitational/teleport/lib/web/app/authz"
 )
 
 type fragmentRequest struct {
@@ -43,11 +47,14 @@ type fragmentRequest struct {
 // startAppAuthExchange will do two actions depending on the following:
 //
 //	1): On initiating auth exchange (indicated by an empty "state" query param)
-//	    we create a crypto safe random token and send it back as part of a "state"
-//	    query param in the redirection URL, as well as in a cookie with attributes
-//	    that makes the cookie unaccesible and hard to tamper with. We use this
-//	    "double submit cookie" method to protect the entire auth exchange flow
-//	    from CSRF.
+//	    we generate a high-entropy code_verifier and store it in a cookie with
+//	    attributes that make it inaccessible and hard to tamper with, then send
+//	    only its code_challenge (base64url(SHA256(verifier))) back as part of
+//	    a "state" query param in the redirection URL. This is a PKCE-style
+//	    scheme: unlike a plain double-submit token, the value that travels
+//	    through the redirect URL (and so can leak through referer headers,
+//	    browser history, or proxy logs) is useless on its own, since it's the
+//	    hash of a secret only the cookie holds, not the secret itself.
 //
 //	2): If the "state" query param is present, we will serve a blank HTML page
 //	    that has inline JS that contains logic to complete the auth exchange.
@@ -56,9 +63,9 @@ func (h *Handler) startAppAuthExchange(w http.ResponseWriter, r *http.Request, p
 
 	// Initiate auth exchange.
 	if q.Get("state") == "" {
-		// secretToken is the token we will look for in both the cookie
-		// and in the request "state" query param.
-		secretToken, err := utils.CryptoRandomHex(auth.TokenLenBytes)
+		// verifier is the PKCE code_verifier: a high-entropy secret that
+		// only ever travels in the HttpOnly cookie, never in the URL.
+		verifier, err := utils.CryptoRandomHex(auth.TokenLenBytes)
 		if err != nil {
 			h.log.WithError(err).Debugf("Failed to generate and encode random numbers.")
 			return trace.AccessDenied("access denied")
@@ -76,18 +83,18 @@ func (h *Handler) startAppAuthExchange(w http.ResponseWriter, r *http.Request, p
 			return trace.AccessDenied("access denied")
 		}
 
-		h.setAuthStateCookie(w, secretToken, cookieIdentifier)
+		h.setAuthStateCookie(w, verifier, cookieIdentifier)
 
 		webLauncherURLParams := launcherURLParams{
 			clusterName: q.Get("cluster"),
 			publicAddr:  q.Get("addr"),
 			arn:         q.Get("arn"),
 			path:        q.Get("path"),
-			// The state token concats both the secret token and the cookie ID.
+			// The state token concats the code_challenge and the cookie ID.
 			// The server will break this token to its individual parts:
-			//   - secretToken to compare against the one stored in cookie
-			//   - cookieIdentifier to look up cookie sent by browser.
-			stateToken: fmt.Sprintf("%s_%s", secretToken, cookieIdentifier),
+			//   - codeChallenge to verify against the verifier stored in the cookie
+			//   - cookieIdentifier to look up the cookie sent by the browser.
+			stateToken: fmt.Sprintf("%s_%s", codeChallenge(verifier), cookieIdentifier),
 		}
 		return h.redirectToLauncher(w, r, webLauncherURLParams)
 	}
@@ -121,16 +128,21 @@ func (h *Handler) completeAppAuthExchange(w http.ResponseWriter, r *http.Request
 		h.log.Warn("Request failed: request state token is not in the expected format")
 		return trace.AccessDenied("access denied")
 	}
-	secretToken := tokens[0]
+	challenge := tokens[0]
 	cookieID := tokens[1]
 
-	// Validate that the caller-provided state token matches the stored state token (CSRF check)
+	// Validate the PKCE code_challenge against the code_verifier stored in
+	// the cookie (CSRF check): the browser round-trips the verifier
+	// automatically via the cookie, so recomputing the challenge from it
+	// and comparing against what the redirect URL handed back to the
+	// client proves the caller is the same browser that started this
+	// exchange, without the verifier itself ever having appeared in a URL.
 	stateCookie, err := r.Cookie(getAuthStateCookieName(cookieID))
 	if err != nil || stateCookie.Value == "" {
 		h.log.Warn("Request failed: state cookie is not set.")
 		return trace.AccessDenied("access denied")
 	}
-	if subtle.ConstantTimeCompare([]byte(secretToken), []byte(stateCookie.Value)) != 1 {
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(codeChallenge(stateCookie.Value))) != 1 {
 		h.log.Warn("Request failed: state token does not match.")
 		return trace.AccessDenied("access denied")
 	}
@@ -139,16 +151,20 @@ func (h *Handler) completeAppAuthExchange(w http.ResponseWriter, r *http.Request
 	clearAuthStateCookie(w, cookieID)
 
 	// Validate that the caller is asking for a session that exists and that they have the secret
-	// session token for.
-	ws, err := h.c.AccessPoint.GetAppSession(r.Context(), types.GetAppSessionRequest{
-		SessionID: req.CookieValue,
-	})
+	// session token for. This goes through the session cache rather than straight to
+	// h.c.AccessPoint, so that a popular application doesn't send every request all the way to
+	// the auth server just to re-validate a cookie it already validated a moment ago.
+	ws, err := h.c.SessionCache.Get(r.Context(), req.CookieValue)
 	if err != nil {
 		h.log.Warn("Request failed: session does not exist.")
 		return trace.AccessDenied("access denied")
 	}
 	if err := checkSubjectToken(req.SubjectCookieValue, ws); err != nil {
 		h.log.Warnf("Request failed: %v.", err)
+		// The cached session is still "valid" as far as the cache is concerned, but the caller
+		// just failed to prove they hold it; drop it so a stolen or guessed cookie value can't
+		// keep being served from cache while its subject token is brute-forced.
+		h.c.SessionCache.Invalidate(req.CookieValue)
 		h.c.AuthClient.EmitAuditEvent(h.closeContext, &apievents.AuthAttempt{
 			Metadata: apievents.Metadata{
 				Type: events.AuthAttemptEvent,
@@ -170,6 +186,32 @@ func (h *Handler) completeAppAuthExchange(w http.ResponseWriter, r *http.Request
 		return trace.AccessDenied("access denied")
 	}
 
+	// Give the authz Gate, if one is configured, a chance to deny the
+	// request on top of the RBAC check that already gated issuing ws in
+	// the first place. This runs after the session and subject token are
+	// both confirmed valid, so a policy only ever evaluates requests from
+	// a caller who has already proven they hold the session.
+	if h.c.Authz != nil {
+		identity, err := identityFromSession(ws)
+		if err != nil {
+			h.log.Warnf("Request failed: could not build identity for authorization: %v.", err)
+			return trace.AccessDenied("access denied")
+		}
+		route := authz.RouteToApp{
+			Name:        identity.RouteToApp.Name,
+			PublicAddr:  identity.RouteToApp.PublicAddr,
+			ClusterName: identity.RouteToApp.ClusterName,
+		}
+		decision := h.c.Authz.Authorize(r.Context(), identity, route, r, nil)
+		if !decision.Allow {
+			h.log.Warn("Request failed: denied by application authorization policy.")
+			return trace.AccessDenied("access denied")
+		}
+		for k, v := range decision.InjectHeaders {
+			w.Header().Set(k, v)
+		}
+	}
+
 	// Set the "Set-Cookie" header on the response.
 	// Set Same-Site policy for the session cookies to None in order to
 	// support redirects that identity providers do during SSO auth.
@@ -196,6 +238,30 @@ func (h *Handler) completeAppAuthExchange(w http.ResponseWriter, r *http.Request
 	return nil
 }
 
+// identityFromSession recovers the tlsca.Identity embedded in ws's TLS
+// certificate, so the authz Gate can evaluate a policy against the same
+// identity RBAC already used to grant the session, without threading a
+// second copy of it through the auth exchange.
+func identityFromSession(ws types.WebSession) (tlsca.Identity, error) {
+	cert, err := tlsca.ParseCertificatePEM(ws.GetTLSCert())
+	if err != nil {
+		return tlsca.Identity{}, trace.Wrap(err)
+	}
+	identity, err := tlsca.FromSubject(cert.Subject, cert.NotAfter)
+	if err != nil {
+		return tlsca.Identity{}, trace.Wrap(err)
+	}
+	return *identity, nil
+}
+
+// codeChallenge computes the PKCE code_challenge for verifier:
+// base64url(SHA256(verifier)), with no padding, matching RFC 7636's S256
+// transform.
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
 func checkSubjectToken(subjectCookieValue string, ws types.WebSession) error {
 	if subjectCookieValue == "" {
 		return trace.AccessDenied("subject session token is not set")
@@ -0,0 +1,89 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"context"
+
+	apievents "github.com/gravitational/teleport/api/types/events"
+	"github.com/gravitational/teleport/lib/events"
+)
+
+// Emitter is the subset of auth.ClientI this package needs in order to
+// record policy decisions as audit events.
+type Emitter interface {
+	EmitAuditEvent(ctx context.Context, event apievents.AuditEvent) error
+}
+
+// logger is the subset of logrus.FieldLogger this package needs, kept
+// small so tests can substitute a no-op implementation.
+type logger interface {
+	Warnf(format string, args ...any)
+}
+
+// noopLogger discards everything; the default when Config.Log is unset.
+type noopLogger struct{}
+
+func (noopLogger) Warnf(string, ...any) {}
+
+// auditDecision records a policy Decision against the request it was
+// evaluated for. Denies are audited unconditionally; a plain allow that
+// doesn't otherwise annotate the request is not, so that a permissive
+// policy doesn't add an audit event to every single app request. An allow
+// is still audited if the policy set InjectHeaders, RedactHeaders, or
+// RedactQueryParams, since those are the policy doing something worth a
+// record even though the request was let through.
+func auditDecision(ctx context.Context, emitter Emitter, log logger, user string, doc Document, decision Decision, evalErr error) {
+	annotated := len(decision.InjectHeaders) > 0 || len(decision.RedactHeaders) > 0 || len(decision.RedactQueryParams) > 0
+	if decision.Allow && evalErr == nil && !annotated {
+		return
+	}
+
+	event := &apievents.AppAuthzDecision{
+		Metadata: apievents.Metadata{
+			Type: events.AppAuthzDecisionEvent,
+			Code: appAuthzDecisionCode(decision.Allow, evalErr),
+		},
+		UserMetadata: apievents.UserMetadata{
+			User: user,
+		},
+		AppMetadata: apievents.AppMetadata{
+			AppName:       doc.RouteToApp.Name,
+			AppPublicAddr: doc.RouteToApp.PublicAddr,
+			AppURI:        doc.RouteToApp.URI,
+		},
+		Method: doc.Request.Method,
+		Path:   doc.Request.Path,
+		Status: apievents.Status{Success: decision.Allow && evalErr == nil},
+	}
+	if evalErr != nil {
+		event.Status.Error = evalErr.Error()
+	}
+
+	if err := emitter.EmitAuditEvent(ctx, event); err != nil {
+		log.Warnf("Failed to emit app authorization decision audit event for %v: %v.", doc.RouteToApp.PublicAddr, err)
+	}
+}
+
+func appAuthzDecisionCode(allow bool, evalErr error) string {
+	switch {
+	case evalErr != nil:
+		return events.AppAuthzDecisionErrorCode
+	case !allow:
+		return events.AppAuthzDecisionDenyCode
+	default:
+		return events.AppAuthzDecisionAllowCode
+	}
+}
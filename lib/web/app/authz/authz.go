@@ -0,0 +1,97 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package authz evaluates a Rego policy bundle against each app access
+// request, as an additional authorization layer on top of the RBAC checks
+// that already gated issuing the session in the first place. Where RBAC
+// answers "can this user have a session for this app at all", a policy
+// here can answer finer-grained, request-shaped questions an Open Policy
+// Agent bundle is well suited for - "can this user POST to /admin/*
+// outside business hours" - without Teleport needing to grow a
+// purpose-built rule language for every such case.
+package authz
+
+import (
+	"net/http"
+
+	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/lib/tlsca"
+)
+
+// RouteToApp is the subset of tlsca.RouteToApp a policy is evaluated
+// against; mirrors the identity field of the same name.
+type RouteToApp struct {
+	Name        string `json:"name"`
+	PublicAddr  string `json:"public_addr"`
+	ClusterName string `json:"cluster_name"`
+	URI         string `json:"uri"`
+}
+
+// RequestDocument is the HTTP request fields exposed to policy, built from
+// the proxied *http.Request. Body is deliberately excluded: a policy
+// authorizes the request's shape, not its payload.
+type RequestDocument struct {
+	Method  string              `json:"method"`
+	Path    string              `json:"path"`
+	Headers map[string][]string `json:"headers"`
+	Query   map[string][]string `json:"query"`
+}
+
+// requestDocumentFrom builds a RequestDocument from an inbound request.
+func requestDocumentFrom(r *http.Request) RequestDocument {
+	return RequestDocument{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Headers: map[string][]string(r.Header.Clone()),
+		Query:   map[string][]string(r.URL.Query()),
+	}
+}
+
+// Document is the full input a policy is evaluated against.
+type Document struct {
+	Identity   tlsca.Identity  `json:"identity"`
+	RouteToApp RouteToApp      `json:"route_to_app"`
+	Request    RequestDocument `json:"request"`
+	AppServer  types.AppServer `json:"app_server"`
+}
+
+// NewDocument builds the Document for one proxied request.
+func NewDocument(identity tlsca.Identity, route RouteToApp, r *http.Request, appServer types.AppServer) Document {
+	return Document{
+		Identity:   identity,
+		RouteToApp: route,
+		Request:    requestDocumentFrom(r),
+		AppServer:  appServer,
+	}
+}
+
+// Decision is a policy's verdict on a Document.
+type Decision struct {
+	// Allow is the policy's allow/deny verdict. A request is denied if
+	// Allow is false, or if evaluation itself fails.
+	Allow bool `json:"allow"`
+	// InjectHeaders are added to the response sent back through the
+	// proxy, for policies that want to annotate the response (e.g. a
+	// header naming which policy rule matched) rather than only gate it.
+	InjectHeaders map[string]string `json:"inject_headers"`
+	// RedactHeaders names request header keys a policy flags as carrying
+	// secrets (e.g. Authorization, an upstream API key). The audit event
+	// records only the request's method and path, never its headers, so no
+	// header value reaches the audit log; setting this field only makes an
+	// allow decision audited.
+	RedactHeaders []string `json:"redact_headers"`
+	// RedactQueryParams is the same as RedactHeaders, for query string
+	// parameters; the audited path excludes the query string.
+	RedactQueryParams []string `json:"redact_query_params"`
+}
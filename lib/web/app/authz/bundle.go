@@ -0,0 +1,216 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gravitational/trace"
+)
+
+// defaultPollInterval is how often an HTTPSBundleSource re-fetches its
+// bundle when PollInterval is unset. Every poll is a full GET; no
+// conditional request is made.
+const defaultPollInterval = 5 * time.Minute
+
+// Reloader is the subset of RegoAuthorizer a BundleSource needs in order to
+// push a newly loaded bundle, kept narrow so tests can substitute a fake.
+type Reloader interface {
+	Reload(ctx context.Context, moduleName, moduleSrc string) error
+}
+
+// BundleSource supplies a RegoAuthorizer with policy source, reloading it
+// as the underlying bundle changes.
+type BundleSource interface {
+	// Watch loads the bundle once, reloads it into dst, and keeps watching
+	// for changes until ctx is canceled, reloading again on every change
+	// it observes. It returns the error from the first load, if any.
+	Watch(ctx context.Context, dst Reloader) error
+}
+
+// FileBundleSource loads a single .rego file from disk and reloads it
+// whenever fsnotify reports the file changed.
+type FileBundleSource struct {
+	Path string
+}
+
+// NewFileBundleSource creates a FileBundleSource reading the policy at
+// path.
+func NewFileBundleSource(path string) *FileBundleSource {
+	return &FileBundleSource{Path: path}
+}
+
+// Watch implements BundleSource.
+func (f *FileBundleSource) Watch(ctx context.Context, dst Reloader) error {
+	if err := f.load(ctx, dst); err != nil {
+		return trace.Wrap(err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return trace.Wrap(err, "creating filesystem watcher")
+	}
+	defer watcher.Close()
+
+	dir := filepath.Dir(f.Path)
+	if err := watcher.Add(dir); err != nil {
+		return trace.Wrap(err, "watching %v", dir)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(f.Path) {
+				continue
+			}
+			if err := f.load(ctx, dst); err != nil {
+				// A transient read (e.g. mid-write) shouldn't take the
+				// watch loop down; the previous bundle stays in effect
+				// until a subsequent event succeeds.
+				continue
+			}
+		case <-watcher.Errors:
+			continue
+		}
+	}
+}
+
+func (f *FileBundleSource) load(ctx context.Context, dst Reloader) error {
+	src, err := os.ReadFile(f.Path)
+	if err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return trace.Wrap(dst.Reload(ctx, f.Path, string(src)))
+}
+
+// HTTPSBundleSource fetches a policy bundle over HTTPS on a fixed
+// interval, verifying its Ed25519 signature before handing it to the
+// Reloader, since unlike FileBundleSource its source isn't already
+// protected by host filesystem permissions.
+type HTTPSBundleSource struct {
+	// URL is fetched for the bundle source; SignatureURL, for its
+	// detached Ed25519 signature.
+	URL, SignatureURL string
+	// PublicKey verifies the signature fetched from SignatureURL.
+	PublicKey ed25519.PublicKey
+	// Client performs the HTTP requests. Defaults to http.DefaultClient.
+	Client *http.Client
+	// PollInterval sets how often the bundle is re-fetched. Defaults to
+	// defaultPollInterval.
+	PollInterval time.Duration
+}
+
+func (h *HTTPSBundleSource) withDefaults() *HTTPSBundleSource {
+	out := *h
+	if out.Client == nil {
+		out.Client = http.DefaultClient
+	}
+	if out.PollInterval <= 0 {
+		out.PollInterval = defaultPollInterval
+	}
+	return &out
+}
+
+// Watch implements BundleSource.
+func (h *HTTPSBundleSource) Watch(ctx context.Context, dst Reloader) error {
+	h = h.withDefaults()
+
+	if err := h.fetchAndLoad(ctx, dst); err != nil {
+		return trace.Wrap(err)
+	}
+
+	ticker := time.NewTicker(h.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			// A failed poll keeps the previous bundle in effect rather
+			// than tearing down the watch loop; the next tick tries again.
+			_ = h.fetchAndLoad(ctx, dst)
+		}
+	}
+}
+
+func (h *HTTPSBundleSource) fetchAndLoad(ctx context.Context, dst Reloader) error {
+	src, err := h.fetchVerified(ctx)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	return trace.Wrap(dst.Reload(ctx, h.URL, string(src)))
+}
+
+func (h *HTTPSBundleSource) fetchVerified(ctx context.Context) ([]byte, error) {
+	src, err := h.fetch(ctx, h.URL)
+	if err != nil {
+		return nil, trace.Wrap(err, "fetching bundle")
+	}
+	sig, err := h.fetch(ctx, h.SignatureURL)
+	if err != nil {
+		return nil, trace.Wrap(err, "fetching bundle signature")
+	}
+	sum := sha256.Sum256(src)
+	if !ed25519.Verify(h.PublicKey, sum[:], sig) {
+		return nil, trace.AccessDenied("policy bundle at %v failed signature verification", h.URL)
+	}
+	return src, nil
+}
+
+func (h *HTTPSBundleSource) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, trace.Errorf("unexpected status %v fetching %v", resp.StatusCode, url)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return bytesTrimSpace(body), nil
+}
+
+// bytesTrimSpace trims leading/trailing whitespace, most commonly a
+// trailing newline a signature was computed without.
+func bytesTrimSpace(b []byte) []byte {
+	return []byte(strings.TrimSpace(string(b)))
+}
+
+var (
+	_ BundleSource = (*FileBundleSource)(nil)
+	_ BundleSource = (*HTTPSBundleSource)(nil)
+)
@@ -0,0 +1,178 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// defaultCacheTTL bounds how long a decision is reused for an identical
+// (identity, request) pair before the policy is re-evaluated, the same way
+// a changed RBAC role only takes effect on session re-issue rather than
+// mid-request.
+const defaultCacheTTL = 10 * time.Second
+
+// defaultCacheCapacity bounds the number of distinct decisions a
+// CachingAuthorizer keeps in memory at once.
+const defaultCacheCapacity = 8192
+
+// cacheKey identifies one decision: the requesting identity plus a hash of
+// the request shape the policy saw.
+type cacheKey struct {
+	identity string
+	request  string
+}
+
+// requestHash hashes the parts of a Document that can vary between
+// otherwise-identical requests from the same identity, so repeated
+// requests to the same method/path/app hit the cache.
+func requestHash(doc Document) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	_ = enc.Encode(doc.RouteToApp)
+	_ = enc.Encode(doc.Request)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type cacheEntry struct {
+	key      cacheKey
+	decision Decision
+	expires  time.Time
+	elem     *list.Element
+}
+
+// CachingAuthorizer wraps an Authorizer with an in-memory, LRU-bounded
+// cache of recent decisions, keyed by (identity, request-hash), so a hot
+// path that repeats the same request doesn't pay a Rego evaluation every
+// time.
+type CachingAuthorizer struct {
+	next     Authorizer
+	ttl      time.Duration
+	capacity int
+	clock    clockwork.Clock
+
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+	order   *list.List // front = most recently used
+}
+
+// CachingAuthorizerOption configures a CachingAuthorizer.
+type CachingAuthorizerOption func(*CachingAuthorizer)
+
+// WithCacheTTL overrides defaultCacheTTL.
+func WithCacheTTL(ttl time.Duration) CachingAuthorizerOption {
+	return func(c *CachingAuthorizer) { c.ttl = ttl }
+}
+
+// WithCacheCapacity overrides defaultCacheCapacity.
+func WithCacheCapacity(capacity int) CachingAuthorizerOption {
+	return func(c *CachingAuthorizer) { c.capacity = capacity }
+}
+
+// WithCacheClock overrides the clock used for TTL expiry, for tests.
+func WithCacheClock(clock clockwork.Clock) CachingAuthorizerOption {
+	return func(c *CachingAuthorizer) { c.clock = clock }
+}
+
+// NewCachingAuthorizer wraps next with a decision cache.
+func NewCachingAuthorizer(next Authorizer, opts ...CachingAuthorizerOption) *CachingAuthorizer {
+	c := &CachingAuthorizer{
+		next:     next,
+		ttl:      defaultCacheTTL,
+		capacity: defaultCacheCapacity,
+		clock:    clockwork.NewRealClock(),
+		entries:  make(map[cacheKey]*cacheEntry),
+		order:    list.New(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Evaluate implements Authorizer, serving a fresh cached Decision if one
+// exists for doc's (identity, request) pair, and otherwise delegating to
+// the wrapped Authorizer and caching its result.
+func (c *CachingAuthorizer) Evaluate(ctx context.Context, doc Document) (Decision, error) {
+	key := cacheKey{identity: doc.Identity.Username, request: requestHash(doc)}
+
+	if d, ok := c.get(key); ok {
+		return d, nil
+	}
+
+	decision, err := c.next.Evaluate(ctx, doc)
+	if err != nil {
+		return Decision{}, err
+	}
+	c.put(key, decision)
+	return decision, nil
+}
+
+func (c *CachingAuthorizer) get(key cacheKey) (Decision, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return Decision{}, false
+	}
+	if c.clock.Now().After(e.expires) {
+		c.evict(e)
+		return Decision{}, false
+	}
+	c.order.MoveToFront(e.elem)
+	return e.decision, true
+}
+
+func (c *CachingAuthorizer) put(key cacheKey, decision Decision) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.decision = decision
+		e.expires = c.clock.Now().Add(c.ttl)
+		c.order.MoveToFront(e.elem)
+		return
+	}
+
+	e := &cacheEntry{key: key, decision: decision, expires: c.clock.Now().Add(c.ttl)}
+	e.elem = c.order.PushFront(e)
+	c.entries[key] = e
+
+	for len(c.entries) > c.capacity {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.evict(oldest.Value.(*cacheEntry))
+	}
+}
+
+// evict removes e from both the index and the LRU list. Callers must hold
+// c.mu.
+func (c *CachingAuthorizer) evict(e *cacheEntry) {
+	c.order.Remove(e.elem)
+	delete(c.entries, e.key)
+}
+
+var _ Authorizer = (*CachingAuthorizer)(nil)
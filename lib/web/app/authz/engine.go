@@ -0,0 +1,120 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/gravitational/trace"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// defaultQuery is the Rego query a bundle's entrypoint package must answer.
+// A bundle is expected to define at least "allow" under this package; the
+// other Decision fields are optional and default to their zero value if
+// the policy doesn't set them.
+const defaultQuery = "data.teleport.authz"
+
+// Authorizer evaluates a Document and returns a Decision.
+type Authorizer interface {
+	Evaluate(ctx context.Context, doc Document) (Decision, error)
+}
+
+// RegoAuthorizer is an Authorizer backed by an Open Policy Agent Rego
+// bundle. It recompiles its query whenever Reload is called with new
+// module source, so a BundleSource can hot-swap the policy without
+// restarting the proxy.
+type RegoAuthorizer struct {
+	mu       sync.RWMutex
+	prepared *rego.PreparedEvalQuery
+}
+
+// NewRegoAuthorizer creates a RegoAuthorizer with no policy loaded yet;
+// every Evaluate call denies until Reload succeeds at least once. Callers
+// normally pair this with a BundleSource that calls Reload immediately.
+func NewRegoAuthorizer() *RegoAuthorizer {
+	return &RegoAuthorizer{}
+}
+
+// Reload compiles moduleSrc (one or more concatenated .rego files,
+// typically the contents of a bundle) and, on success, atomically
+// replaces the query future Evaluate calls use. A compile error leaves the
+// previously loaded policy, if any, in effect.
+func (a *RegoAuthorizer) Reload(ctx context.Context, moduleName, moduleSrc string) error {
+	pr, err := rego.New(
+		rego.Query(defaultQuery),
+		rego.Module(moduleName, moduleSrc),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return trace.Wrap(err, "compiling Rego policy bundle %v", moduleName)
+	}
+
+	a.mu.Lock()
+	a.prepared = &pr
+	a.mu.Unlock()
+	return nil
+}
+
+// Evaluate implements Authorizer.
+func (a *RegoAuthorizer) Evaluate(ctx context.Context, doc Document) (Decision, error) {
+	a.mu.RLock()
+	prepared := a.prepared
+	a.mu.RUnlock()
+	if prepared == nil {
+		return Decision{}, trace.NotFound("no policy bundle has been loaded")
+	}
+
+	// rego.EvalInput wants a plain map/struct tree, not a Go struct with
+	// json tags, so round-trip doc through encoding/json the way the
+	// rego package's own examples do.
+	var input any
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return Decision{}, trace.Wrap(err)
+	}
+	if err := json.Unmarshal(raw, &input); err != nil {
+		return Decision{}, trace.Wrap(err)
+	}
+
+	results, err := prepared.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return Decision{}, trace.Wrap(err, "evaluating Rego policy")
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return Decision{}, trace.BadParameter("policy produced no result")
+	}
+
+	return decisionFromResult(results[0].Expressions[0].Value)
+}
+
+// decisionFromResult converts the dynamically-typed value Rego returns for
+// "data.teleport.authz" into a Decision, by round-tripping it through JSON
+// rather than hand-walking the map[string]any the rego package hands
+// back.
+func decisionFromResult(value any) (Decision, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return Decision{}, trace.Wrap(err)
+	}
+	var d Decision
+	if err := json.Unmarshal(raw, &d); err != nil {
+		return Decision{}, trace.Wrap(err, "policy result did not match the expected authz document shape")
+	}
+	return d, nil
+}
+
+var _ Authorizer = (*RegoAuthorizer)(nil)
@@ -51,6 +51,8 @@ import (
 	"github.com/gravitational/teleport/lib/sshutils"
 	"github.com/gravitational/teleport/lib/tlsca"
 	"github.com/gravitational/teleport/lib/utils"
+	"github.com/gravitational/teleport/lib/web/app/authz"
+	"github.com/gravitational/teleport/lib/web/app/sessioncache"
 )
 
 type eventCheckFn func(t *testing.T, events []apievents.AuditEvent)
@@ -73,9 +75,9 @@ func hasAuditEventCount(want int) eventCheckFn {
 
 // TestAuthPOST tests the handler of POST /x-teleport-auth.
 func TestAuthPOST(t *testing.T) {
-	secretToken := "012ac605867e5a7d693cd6f49c7ff0fb"
+	verifier := "012ac605867e5a7d693cd6f49c7ff0fb"
 	cookieID := "cookie-name"
-	stateValue := fmt.Sprintf("%s_%s", secretToken, cookieID)
+	stateValue := fmt.Sprintf("%s_%s", codeChallenge(verifier), cookieID)
 	appCookieValue := "5588e2be54a2834b4f152c56bafcd789f53b15477129d2ab4044e9a3c1bf0f3b"
 
 	fakeClock := clockwork.NewFakeClockAt(time.Date(2017, 05, 10, 18, 53, 0, 0, time.UTC))
@@ -102,7 +104,7 @@ func TestAuthPOST(t *testing.T) {
 		{
 			desc:             "success",
 			stateInRequest:   stateValue,
-			stateInCookie:    secretToken,
+			stateInCookie:    verifier,
 			subjectInRequest: appSession.GetBearerToken(),
 			outStatusCode:    http.StatusOK,
 			eventChecks:      []eventCheckFn{hasAuditEventCount(0)},
@@ -110,7 +112,7 @@ func TestAuthPOST(t *testing.T) {
 		{
 			desc:             "missing state token in request",
 			stateInRequest:   "",
-			stateInCookie:    secretToken,
+			stateInCookie:    verifier,
 			subjectInRequest: appSession.GetBearerToken(),
 			outStatusCode:    http.StatusForbidden,
 			eventChecks:      []eventCheckFn{hasAuditEventCount(0)},
@@ -118,7 +120,7 @@ func TestAuthPOST(t *testing.T) {
 		{
 			desc:             "missing subject session token in request",
 			stateInRequest:   stateValue,
-			stateInCookie:    secretToken,
+			stateInCookie:    verifier,
 			subjectInRequest: "",
 			outStatusCode:    http.StatusForbidden,
 			eventChecks: []eventCheckFn{
@@ -142,7 +144,7 @@ func TestAuthPOST(t *testing.T) {
 		{
 			desc:             "subject session token in request does not match",
 			stateInRequest:   stateValue,
-			stateInCookie:    secretToken,
+			stateInCookie:    verifier,
 			subjectInRequest: "foobar",
 			outStatusCode:    http.StatusForbidden,
 			eventChecks: []eventCheckFn{
@@ -166,12 +168,20 @@ func TestAuthPOST(t *testing.T) {
 		{
 			desc:             "invalid session",
 			stateInRequest:   stateValue,
-			stateInCookie:    secretToken,
+			stateInCookie:    verifier,
 			subjectInRequest: appSession.GetBearerToken(),
 			sessionError:     trace.NotFound("invalid session"),
 			outStatusCode:    http.StatusForbidden,
 			eventChecks:      []eventCheckFn{hasAuditEventCount(0)},
 		},
+		{
+			desc:             "code verifier does not match challenge",
+			stateInRequest:   stateValue,
+			stateInCookie:    "a-different-verifier-entirely",
+			subjectInRequest: appSession.GetBearerToken(),
+			outStatusCode:    http.StatusForbidden,
+			eventChecks:      []eventCheckFn{hasAuditEventCount(0)},
+		},
 	}
 	for _, test := range tests {
 		test := test
@@ -202,6 +212,178 @@ func TestAuthPOST(t *testing.T) {
 	}
 }
 
+// fakeAuthorizer returns a fixed Decision (or error) regardless of the
+// Document it's given, so tests can drive completeAppAuthExchange's authz
+// Gate without standing up a real Rego bundle.
+type fakeAuthorizer struct {
+	decision authz.Decision
+	err      error
+}
+
+func (f *fakeAuthorizer) Evaluate(context.Context, authz.Document) (authz.Decision, error) {
+	return f.decision, f.err
+}
+
+// TestAuthPOSTAuthorization extends TestAuthPOST's "success" path with an
+// authz Gate wired in, covering allow, deny, and inject-header outcomes
+// plus the audit event each produces.
+func TestAuthPOSTAuthorization(t *testing.T) {
+	verifier := "012ac605867e5a7d693cd6f49c7ff0fb"
+	cookieID := "cookie-name"
+	stateValue := fmt.Sprintf("%s_%s", codeChallenge(verifier), cookieID)
+	appCookieValue := "5588e2be54a2834b4f152c56bafcd789f53b15477129d2ab4044e9a3c1bf0f3b"
+
+	fakeClock := clockwork.NewFakeClockAt(time.Date(2017, 05, 10, 18, 53, 0, 0, time.UTC))
+	clusterName := "test-cluster"
+	publicAddr := "app.example.com"
+	key, cert, err := tlsca.GenerateSelfSignedCA(
+		pkix.Name{CommonName: clusterName},
+		[]string{publicAddr, apiutils.EncodeClusterName(clusterName)},
+		defaults.CATTL,
+	)
+	require.NoError(t, err)
+	appSession := createAppSession(t, fakeClock, key, cert, clusterName, publicAddr)
+	evalErr := trace.BadParameter("policy produced no result")
+
+	tests := []struct {
+		desc          string
+		authorizer    authz.Authorizer
+		outStatusCode int
+		eventChecks   []eventCheckFn
+	}{
+		{
+			desc:          "allowed by policy",
+			authorizer:    &fakeAuthorizer{decision: authz.Decision{Allow: true}},
+			outStatusCode: http.StatusOK,
+			eventChecks:   []eventCheckFn{hasAuditEventCount(0)},
+		},
+		{
+			desc: "allowed with inject headers still audited",
+			authorizer: &fakeAuthorizer{decision: authz.Decision{
+				Allow:         true,
+				InjectHeaders: map[string]string{"X-Policy-Rule": "business-hours"},
+			}},
+			outStatusCode: http.StatusOK,
+			eventChecks: []eventCheckFn{
+				hasAuditEventCount(1),
+				hasAuditEvent(0, &apievents.AppAuthzDecision{
+					Metadata: apievents.Metadata{
+						Type: events.AppAuthzDecisionEvent,
+						Code: events.AppAuthzDecisionAllowCode,
+					},
+					UserMetadata: apievents.UserMetadata{
+						User: "testuser",
+					},
+					AppMetadata: apievents.AppMetadata{
+						AppName:       "testapp",
+						AppPublicAddr: publicAddr,
+					},
+					Status: apievents.Status{Success: true},
+				}),
+			},
+		},
+		{
+			desc:          "denied by policy",
+			authorizer:    &fakeAuthorizer{decision: authz.Decision{Allow: false}},
+			outStatusCode: http.StatusForbidden,
+			eventChecks: []eventCheckFn{
+				hasAuditEventCount(1),
+				hasAuditEvent(0, &apievents.AppAuthzDecision{
+					Metadata: apievents.Metadata{
+						Type: events.AppAuthzDecisionEvent,
+						Code: events.AppAuthzDecisionDenyCode,
+					},
+					UserMetadata: apievents.UserMetadata{
+						User: "testuser",
+					},
+					AppMetadata: apievents.AppMetadata{
+						AppName:       "testapp",
+						AppPublicAddr: publicAddr,
+					},
+					Status: apievents.Status{Success: false},
+				}),
+			},
+		},
+		{
+			// A transient eval error (OPA timeout, malformed document,
+			// policy bug) must deny, the same as an explicit Allow: false -
+			// it is not a signal to fall back to an open gate.
+			desc: "eval error denies",
+			authorizer: &fakeAuthorizer{
+				decision: authz.Decision{Allow: true},
+				err:      evalErr,
+			},
+			outStatusCode: http.StatusForbidden,
+			eventChecks: []eventCheckFn{
+				hasAuditEventCount(1),
+				hasAuditEvent(0, &apievents.AppAuthzDecision{
+					Metadata: apievents.Metadata{
+						Type: events.AppAuthzDecisionEvent,
+						Code: events.AppAuthzDecisionErrorCode,
+					},
+					UserMetadata: apievents.UserMetadata{
+						User: "testuser",
+					},
+					AppMetadata: apievents.AppMetadata{
+						AppName:       "testapp",
+						AppPublicAddr: publicAddr,
+					},
+					Status: apievents.Status{Success: false, Error: evalErr.Error()},
+				}),
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.desc, func(t *testing.T) {
+			t.Parallel()
+			authClient := &mockAuthClient{appSession: appSession}
+			p := setupWithAuthz(t, fakeClock, authClient, test.authorizer)
+
+			req, err := json.Marshal(fragmentRequest{
+				StateValue:         stateValue,
+				CookieValue:        appCookieValue,
+				SubjectCookieValue: appSession.GetBearerToken(),
+			})
+			require.NoError(t, err)
+
+			status, _ := p.makeRequest(t, "POST", "/x-teleport-auth", req, []http.Cookie{{
+				Name:  fmt.Sprintf("%s_%s", AuthStateCookieName, cookieID),
+				Value: verifier,
+			}})
+			require.Equal(t, test.outStatusCode, status)
+			for _, check := range test.eventChecks {
+				check(t, authClient.emittedEvents)
+			}
+		})
+	}
+}
+
+// setupWithAuthz is setup plus an authz Gate wired from authorizer, for
+// tests exercising completeAppAuthExchange's policy hook.
+func setupWithAuthz(t *testing.T, clock clockwork.FakeClock, authClient *mockAuthClient, authorizer authz.Authorizer) *testServer {
+	appHandler, err := NewHandler(context.Background(), &HandlerConfig{
+		Clock:        clock,
+		AuthClient:   authClient,
+		AccessPoint:  authClient,
+		CipherSuites: utils.DefaultCipherSuites(),
+		SessionCache: sessioncache.NewFakeStore(authClient.appSession, authClient.sessionError),
+		Authz: authz.NewGate(authz.GateConfig{
+			Authorizer: authorizer,
+			Emitter:    authClient,
+		}),
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(appHandler)
+	server.StartTLS()
+
+	url, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	return &testServer{serverURL: url}
+}
+
 func TestHasName(t *testing.T) {
 	for _, test := range []struct {
 		desc        string
@@ -420,6 +602,7 @@ func TestHealthCheckAppServer(t *testing.T) {
 				AccessPoint:  authClient,
 				ProxyClient:  tunnel,
 				CipherSuites: utils.DefaultCipherSuites(),
+				SessionCache: sessioncache.NewFakeStore(authClient.appSession, authClient.sessionError),
 			})
 			require.NoError(t, err)
 
@@ -434,13 +617,18 @@ type testServer struct {
 	serverURL *url.URL
 }
 
-func setup(t *testing.T, clock clockwork.FakeClock, authClient auth.ClientI, proxyClient reversetunnelclient.Tunnel) *testServer {
+func setup(t *testing.T, clock clockwork.FakeClock, authClient *mockAuthClient, proxyClient reversetunnelclient.Tunnel) *testServer {
 	appHandler, err := NewHandler(context.Background(), &HandlerConfig{
 		Clock:        clock,
 		AuthClient:   authClient,
 		AccessPoint:  authClient,
 		ProxyClient:  proxyClient,
 		CipherSuites: utils.DefaultCipherSuites(),
+		// Tests exercise the handler's session-resolution path through a
+		// fake store directly, rather than mockAuthClient.GetAppSession,
+		// the way a real HandlerConfig goes through a Cache in front of
+		// AccessPoint.
+		SessionCache: sessioncache.NewFakeStore(authClient.appSession, authClient.sessionError),
 	})
 	require.NoError(t, err)
 
@@ -0,0 +1,48 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import (
+	"context"
+	"time"
+)
+
+// entry is what a Backend stores for a single cookie value.
+type entry struct {
+	// session is the marshaled WebSession, or nil if this entry records a
+	// negative (not-found) result.
+	session []byte
+	// expires is when the entry stops being valid - the session's own
+	// Expires for a positive entry, or now+negativeTTL for a negative one.
+	expires time.Time
+}
+
+// Backend is the pluggable storage a Cache delegates to. A Backend knows
+// nothing about WebSessions, expiry policy, or request coalescing; it only
+// stores and retrieves opaque entries keyed by cookie value.
+//
+// MemoryBackend is the default, in-process backend. RedisBackend and
+// DynamoBackend share cached entries across every proxy in a cluster,
+// trading a small amount of latency for a much higher hit rate on clusters
+// with many proxies behind a load balancer.
+type Backend interface {
+	// Get returns the entry stored for key, or ok == false if there is
+	// none or it has expired.
+	Get(ctx context.Context, key string) (e entry, ok bool, err error)
+	// Put stores e for key, replacing any entry already there.
+	Put(ctx context.Context, key string, e entry) error
+	// Delete removes any entry stored for key.
+	Delete(ctx context.Context, key string) error
+}
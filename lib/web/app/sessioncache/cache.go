@@ -0,0 +1,145 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import (
+	"context"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/teleport/lib/services"
+)
+
+// negativeTTL bounds how long a trace.NotFound result is cached. It keeps a
+// cookie brute-forcer from turning every guess into a round trip to the
+// auth server, while still picking up a session created a moment after a
+// miss reasonably quickly.
+const negativeTTL = 5 * time.Second
+
+// Cache is a [Store] that coalesces concurrent lookups for the same cookie
+// value into a single call to the underlying [SessionGetter], and caches
+// both hits (until the session's own Expires) and not-found misses (for
+// negativeTTL) in a pluggable [Backend].
+type Cache struct {
+	backend Backend
+	source  SessionGetter
+	group   singleflight.Group
+	metrics *cacheMetrics
+	clock   func() time.Time
+}
+
+// Option customizes a Cache constructed by NewCache.
+type Option func(*Cache)
+
+// WithClock overrides the clock Cache uses to evaluate entry expiry. Used in
+// tests; production callers should leave this unset.
+func WithClock(clock func() time.Time) Option {
+	return func(c *Cache) { c.clock = clock }
+}
+
+// NewCache creates a Cache that resolves misses against source, storing
+// results in backend.
+func NewCache(backend Backend, source SessionGetter, opts ...Option) *Cache {
+	c := &Cache{
+		backend: backend,
+		source:  source,
+		metrics: newCacheMetrics(),
+		clock:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Metrics returns the Prometheus collectors this Cache updates, for
+// registration with a prometheus.Registerer.
+func (c *Cache) Metrics() []prometheus.Collector {
+	return c.metrics.collectors()
+}
+
+// Get implements Store.
+func (c *Cache) Get(ctx context.Context, cookieValue string) (types.WebSession, error) {
+	if session, ok := c.lookup(ctx, cookieValue); ok {
+		c.metrics.hits.Inc()
+		if session == nil {
+			return nil, trace.NotFound("app session not found")
+		}
+		return session, nil
+	}
+	c.metrics.misses.Inc()
+
+	result, err, _ := c.group.Do(cookieValue, func() (any, error) {
+		return c.refresh(ctx, cookieValue)
+	})
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+	return result.(types.WebSession), nil
+}
+
+// lookup consults the backend, returning ok == false on a miss, expired
+// entry, or unreadable (e.g. corrupt or from an incompatible version)
+// cached value - all of which should fall back to refresh rather than fail
+// outright. A true ok with a nil session represents a cached not-found.
+func (c *Cache) lookup(ctx context.Context, cookieValue string) (types.WebSession, bool) {
+	e, ok, err := c.backend.Get(ctx, cookieValue)
+	if err != nil || !ok {
+		return nil, false
+	}
+	if !c.clock().Before(e.expires) {
+		return nil, false
+	}
+	if e.session == nil {
+		return nil, true
+	}
+
+	session, err := services.UnmarshalWebSession(e.session)
+	if err != nil {
+		return nil, false
+	}
+	return session, true
+}
+
+// refresh calls through to source and updates the backend with the result,
+// including negative-caching a not-found response. Calls are deduplicated
+// per cookie value by Get's use of singleflight.
+func (c *Cache) refresh(ctx context.Context, cookieValue string) (types.WebSession, error) {
+	c.metrics.refreshes.Inc()
+
+	session, err := c.source.GetAppSession(ctx, types.GetAppSessionRequest{SessionID: cookieValue})
+	if err != nil {
+		if trace.IsNotFound(err) {
+			_ = c.backend.Put(ctx, cookieValue, entry{expires: c.clock().Add(negativeTTL)})
+		}
+		return nil, trace.Wrap(err)
+	}
+
+	if data, merr := services.MarshalWebSession(session); merr == nil {
+		_ = c.backend.Put(ctx, cookieValue, entry{session: data, expires: session.GetExpiry()})
+	}
+	return session, nil
+}
+
+// Invalidate implements Store.
+func (c *Cache) Invalidate(cookieValue string) {
+	_ = c.backend.Delete(context.Background(), cookieValue)
+}
+
+var _ Store = (*Cache)(nil)
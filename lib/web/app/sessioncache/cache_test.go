@@ -0,0 +1,143 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gravitational/teleport/api/types"
+)
+
+// countingGetter wraps a SessionGetter, counting calls and optionally
+// blocking until release is closed, so tests can assert single-flight
+// coalescing of concurrent Get calls for the same cookie.
+type countingGetter struct {
+	session types.WebSession
+	err     error
+
+	calls   atomic.Int64
+	block   bool
+	release chan struct{}
+}
+
+func (g *countingGetter) GetAppSession(ctx context.Context, _ types.GetAppSessionRequest) (types.WebSession, error) {
+	g.calls.Add(1)
+	if g.block {
+		select {
+		case <-g.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.session, nil
+}
+
+func TestCacheHitMissRefresh(t *testing.T) {
+	session, err := types.NewWebSession("test-session", types.KindAppSession, types.WebSessionSpecV2{
+		User:    "alice",
+		Expires: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	getter := &countingGetter{session: session}
+	cache := NewCache(NewMemoryBackend(0), getter)
+
+	got, err := cache.Get(context.Background(), "cookie-1")
+	require.NoError(t, err)
+	require.Equal(t, session.GetName(), got.GetName())
+	require.EqualValues(t, 1, getter.calls.Load())
+
+	got, err = cache.Get(context.Background(), "cookie-1")
+	require.NoError(t, err)
+	require.Equal(t, session.GetName(), got.GetName())
+	require.EqualValues(t, 1, getter.calls.Load(), "second Get should be served from cache, not hit the getter again")
+}
+
+func TestCacheNegativeCaching(t *testing.T) {
+	getter := &countingGetter{err: trace.NotFound("no such session")}
+	now := time.Now()
+	cache := NewCache(NewMemoryBackend(0), getter, WithClock(func() time.Time { return now }))
+
+	_, err := cache.Get(context.Background(), "missing")
+	require.True(t, trace.IsNotFound(err))
+	require.EqualValues(t, 1, getter.calls.Load())
+
+	_, err = cache.Get(context.Background(), "missing")
+	require.True(t, trace.IsNotFound(err))
+	require.EqualValues(t, 1, getter.calls.Load(), "a cached not-found should not re-query the getter")
+
+	now = now.Add(negativeTTL + time.Second)
+	_, err = cache.Get(context.Background(), "missing")
+	require.True(t, trace.IsNotFound(err))
+	require.EqualValues(t, 2, getter.calls.Load(), "an expired negative entry should be refreshed")
+}
+
+func TestCacheCoalescesConcurrentLookups(t *testing.T) {
+	session, err := types.NewWebSession("test-session", types.KindAppSession, types.WebSessionSpecV2{
+		User:    "alice",
+		Expires: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	getter := &countingGetter{session: session, block: true, release: make(chan struct{})}
+	cache := NewCache(NewMemoryBackend(0), getter)
+
+	const concurrency = 10
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			_, err := cache.Get(context.Background(), "cookie-1")
+			require.NoError(t, err)
+		}()
+	}
+
+	close(getter.release)
+	wg.Wait()
+
+	require.EqualValues(t, 1, getter.calls.Load(), "concurrent lookups for the same cookie should coalesce into one call")
+}
+
+func TestCacheInvalidate(t *testing.T) {
+	session, err := types.NewWebSession("test-session", types.KindAppSession, types.WebSessionSpecV2{
+		User:    "alice",
+		Expires: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	getter := &countingGetter{session: session}
+	cache := NewCache(NewMemoryBackend(0), getter)
+
+	_, err = cache.Get(context.Background(), "cookie-1")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, getter.calls.Load())
+
+	cache.Invalidate("cookie-1")
+
+	_, err = cache.Get(context.Background(), "cookie-1")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, getter.calls.Load(), "Get after Invalidate should re-query the getter")
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/gravitational/trace"
+)
+
+// dynamoItem is the shape of a session cache entry as stored in DynamoDB.
+// Expires is both a regular attribute (read back by Get) and, once the
+// table's TTL is configured to use it, the attribute DynamoDB itself uses
+// to expire and reclaim stale items, so a proxy that's been offline for a
+// while doesn't need to clean up after itself.
+type dynamoItem struct {
+	Key     string `dynamodbav:"cookie_value"`
+	Session []byte `dynamodbav:"session,omitempty"`
+	Expires int64  `dynamodbav:"expires"`
+}
+
+// DynamoBackend is a [Backend] that stores entries in a DynamoDB table,
+// sharing a cluster-wide cache of resolved sessions across every proxy
+// instance. The table is expected to have "cookie_value" (string) as its
+// partition key, and a TTL configured on the "expires" attribute.
+type DynamoBackend struct {
+	client *dynamodb.Client
+	table  string
+}
+
+// NewDynamoBackend creates a DynamoBackend storing entries in table.
+func NewDynamoBackend(client *dynamodb.Client, table string) *DynamoBackend {
+	return &DynamoBackend{client: client, table: table}
+}
+
+// Get implements Backend.
+func (d *DynamoBackend) Get(ctx context.Context, key string) (entry, bool, error) {
+	out, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]types.AttributeValue{
+			"cookie_value": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(false),
+	})
+	if err != nil {
+		return entry{}, false, trace.Wrap(err)
+	}
+	if len(out.Item) == 0 {
+		return entry{}, false, nil
+	}
+
+	var item dynamoItem
+	if err := attributevalue.UnmarshalMap(out.Item, &item); err != nil {
+		// a corrupt item is treated as a miss, not a hard error
+		return entry{}, false, nil
+	}
+
+	expires := time.Unix(item.Expires, 0)
+	if time.Now().After(expires) {
+		return entry{}, false, nil
+	}
+	return entry{session: item.Session, expires: expires}, true, nil
+}
+
+// Put implements Backend.
+func (d *DynamoBackend) Put(ctx context.Context, key string, e entry) error {
+	if !e.expires.After(time.Now()) {
+		return nil
+	}
+
+	item, err := attributevalue.MarshalMap(dynamoItem{
+		Key:     key,
+		Session: e.session,
+		Expires: e.expires.Unix(),
+	})
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if _, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.table),
+		Item:      item,
+	}); err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// Delete implements Backend.
+func (d *DynamoBackend) Delete(ctx context.Context, key string) error {
+	if _, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.table),
+		Key: map[string]types.AttributeValue{
+			"cookie_value": &types.AttributeValueMemberS{Value: key},
+		},
+	}); err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+var _ Backend = (*DynamoBackend)(nil)
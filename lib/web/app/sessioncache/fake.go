@@ -0,0 +1,68 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gravitational/trace"
+
+	"github.com/gravitational/teleport/api/types"
+)
+
+// FakeStore is a [Store] that returns a fixed session and/or error,
+// recording which cookie values were looked up or invalidated. It lets
+// tests exercise the app handler's session-resolution path without a real
+// auth client or any of the caching policy in [Cache].
+type FakeStore struct {
+	mu      sync.Mutex
+	session types.WebSession
+	err     error
+
+	invalidated []string
+}
+
+// NewFakeStore creates a FakeStore whose Get always returns session, err.
+func NewFakeStore(session types.WebSession, err error) *FakeStore {
+	return &FakeStore{session: session, err: err}
+}
+
+// Get implements Store.
+func (f *FakeStore) Get(_ context.Context, _ string) (types.WebSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return nil, trace.Wrap(f.err)
+	}
+	return f.session, nil
+}
+
+// Invalidate implements Store.
+func (f *FakeStore) Invalidate(cookieValue string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.invalidated = append(f.invalidated, cookieValue)
+}
+
+// Invalidated returns the cookie values passed to Invalidate, in order.
+func (f *FakeStore) Invalidated() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.invalidated...)
+}
+
+var _ Store = (*FakeStore)(nil)
@@ -0,0 +1,119 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultMemoryCapacity is the number of entries a MemoryBackend keeps
+// before evicting the least recently used one.
+const DefaultMemoryCapacity = 4096
+
+// MemoryBackend is an in-process, LRU-bounded [Backend] with per-entry TTL.
+// It requires no external service and is the default backend for a single
+// proxy; it does not share entries with other proxies in the cluster.
+type MemoryBackend struct {
+	capacity int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// memoryItem is the value stored in a MemoryBackend's list.Element.
+type memoryItem struct {
+	key   string
+	entry entry
+}
+
+// NewMemoryBackend creates a MemoryBackend holding up to capacity entries.
+// If capacity <= 0, DefaultMemoryCapacity is used.
+func NewMemoryBackend(capacity int) *MemoryBackend {
+	if capacity <= 0 {
+		capacity = DefaultMemoryCapacity
+	}
+	return &MemoryBackend{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements Backend.
+func (m *MemoryBackend) Get(_ context.Context, key string) (entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return entry{}, false, nil
+	}
+	item := el.Value.(*memoryItem)
+	if time.Now().After(item.entry.expires) {
+		m.removeElement(el)
+		return entry{}, false, nil
+	}
+
+	m.ll.MoveToFront(el)
+	return item.entry, true, nil
+}
+
+// Put implements Backend.
+func (m *MemoryBackend) Put(_ context.Context, key string, e entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		el.Value.(*memoryItem).entry = e
+		m.ll.MoveToFront(el)
+		return nil
+	}
+
+	el := m.ll.PushFront(&memoryItem{key: key, entry: e})
+	m.items[key] = el
+
+	if m.ll.Len() > m.capacity {
+		m.removeOldest()
+	}
+	return nil
+}
+
+// Delete implements Backend.
+func (m *MemoryBackend) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		m.removeElement(el)
+	}
+	return nil
+}
+
+func (m *MemoryBackend) removeOldest() {
+	if el := m.ll.Back(); el != nil {
+		m.removeElement(el)
+	}
+}
+
+func (m *MemoryBackend) removeElement(el *list.Element) {
+	m.ll.Remove(el)
+	delete(m.items, el.Value.(*memoryItem).key)
+}
+
+var _ Backend = (*MemoryBackend)(nil)
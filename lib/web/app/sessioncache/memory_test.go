@@ -0,0 +1,83 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBackendGetPutDelete(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend(0)
+
+	_, ok, err := b.Get(ctx, "missing")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, b.Put(ctx, "key", entry{session: []byte("data"), expires: time.Now().Add(time.Minute)}))
+
+	got, ok, err := b.Get(ctx, "key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, []byte("data"), got.session)
+
+	require.NoError(t, b.Delete(ctx, "key"))
+	_, ok, err = b.Get(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestMemoryBackendExpiry(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend(0)
+
+	require.NoError(t, b.Put(ctx, "key", entry{session: []byte("data"), expires: time.Now().Add(-time.Second)}))
+
+	_, ok, err := b.Get(ctx, "key")
+	require.NoError(t, err)
+	require.False(t, ok, "an expired entry should behave as a miss")
+}
+
+func TestMemoryBackendEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	b := NewMemoryBackend(2)
+
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, b.Put(ctx, "a", entry{expires: future}))
+	require.NoError(t, b.Put(ctx, "b", entry{expires: future}))
+
+	// touch "a" so it's more recently used than "b"
+	_, ok, err := b.Get(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	require.NoError(t, b.Put(ctx, "c", entry{expires: future}))
+
+	_, ok, err = b.Get(ctx, "b")
+	require.NoError(t, err)
+	require.False(t, ok, "the least recently used entry should have been evicted")
+
+	_, ok, err = b.Get(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, ok, err = b.Get(ctx, "c")
+	require.NoError(t, err)
+	require.True(t, ok)
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// cacheMetrics are the Prometheus collectors a Cache updates on every Get.
+type cacheMetrics struct {
+	hits      prometheus.Counter
+	misses    prometheus.Counter
+	refreshes prometheus.Counter
+}
+
+func newCacheMetrics() *cacheMetrics {
+	return &cacheMetrics{
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "app_session_cache_hits_total",
+			Help: "Number of app session cookie lookups served from cache.",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "app_session_cache_misses_total",
+			Help: "Number of app session cookie lookups not found in cache.",
+		}),
+		refreshes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "app_session_cache_refreshes_total",
+			Help: "Number of app session cookie lookups that resulted in a call to the auth server, deduplicated by single-flight.",
+		}),
+	}
+}
+
+// collectors returns the metrics in a form suitable for
+// prometheus.Registerer.Register.
+func (m *cacheMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.hits, m.misses, m.refreshes}
+}
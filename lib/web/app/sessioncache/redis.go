@@ -0,0 +1,109 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sessioncache
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+
+	"github.com/gravitational/trace"
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces session cache keys within a Redis instance that
+// may also be used for other purposes.
+const redisKeyPrefix = "sessioncache/"
+
+// RedisBackend is a [Backend] that stores entries in Redis, sharing a
+// cluster-wide cache of resolved sessions across every proxy instance
+// instead of keeping a separate cache per proxy the way MemoryBackend does.
+type RedisBackend struct {
+	client redis.Cmdable
+}
+
+// NewRedisBackend creates a RedisBackend using client for storage. client is
+// typically a *redis.Client or *redis.ClusterClient.
+func NewRedisBackend(client redis.Cmdable) *RedisBackend {
+	return &RedisBackend{client: client}
+}
+
+// Get implements Backend.
+func (r *RedisBackend) Get(ctx context.Context, key string) (entry, bool, error) {
+	data, err := r.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return entry{}, false, nil
+	}
+	if err != nil {
+		return entry{}, false, trace.Wrap(err)
+	}
+
+	e, err := decodeEntry(data)
+	if err != nil {
+		// a corrupt entry is treated as a miss rather than a hard error,
+		// so a format change doesn't take the cache (and app access) down
+		return entry{}, false, nil
+	}
+	if time.Now().After(e.expires) {
+		return entry{}, false, nil
+	}
+	return e, true, nil
+}
+
+// Put implements Backend.
+func (r *RedisBackend) Put(ctx context.Context, key string, e entry) error {
+	ttl := time.Until(e.expires)
+	if ttl <= 0 {
+		return nil
+	}
+	if err := r.client.Set(ctx, redisKeyPrefix+key, encodeEntry(e), ttl).Err(); err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// Delete implements Backend.
+func (r *RedisBackend) Delete(ctx context.Context, key string) error {
+	if err := r.client.Del(ctx, redisKeyPrefix+key).Err(); err != nil {
+		return trace.Wrap(err)
+	}
+	return nil
+}
+
+// encodeEntry serializes e as an 8-byte big-endian Unix nanosecond
+// timestamp followed by the raw session bytes, so Redis (which has no
+// notion of our entry struct) can store it as a plain value while still
+// round-tripping expiry, which Put's TTL is derived from but Get must also
+// see on read in case the backend's own clock and Redis's disagree.
+func encodeEntry(e entry) []byte {
+	buf := make([]byte, 8+len(e.session))
+	binary.BigEndian.PutUint64(buf, uint64(e.expires.UnixNano()))
+	copy(buf[8:], e.session)
+	return buf
+}
+
+func decodeEntry(data []byte) (entry, error) {
+	if len(data) < 8 {
+		return entry{}, trace.BadParameter("malformed session cache entry")
+	}
+	expires := time.Unix(0, int64(binary.BigEndian.Uint64(data[:8])))
+	var session []byte
+	if len(data) > 8 {
+		session = data[8:]
+	}
+	return entry{session: session, expires: expires}, nil
+}
+
+var _ Backend = (*RedisBackend)(nil)
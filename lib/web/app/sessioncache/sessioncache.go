@@ -0,0 +1,54 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sessioncache caches the WebSessions the app proxy resolves app
+// access cookies to, so that a popular application doesn't send every
+// request all the way to the auth server just to re-validate a cookie it
+// already validated a moment ago.
+//
+// The split mirrors golang.org/x/crypto/acme/autocert: a [Backend]
+// implementation only knows how to store and retrieve an opaque, already
+// marshaled entry by key, while [Cache] owns the policy built on top of any
+// Backend - respecting the session's own expiry, coalescing concurrent
+// lookups for the same cookie with a single in-flight request, and
+// negative-caching not-found results so a cookie brute-forcer can't turn
+// every guess into a round trip to the auth server.
+package sessioncache
+
+import (
+	"context"
+
+	"github.com/gravitational/teleport/api/types"
+)
+
+// SessionGetter is the subset of auth.ClientI/auth.AccessPoint a Cache needs
+// in order to resolve a cookie value into a WebSession on a miss.
+type SessionGetter interface {
+	GetAppSession(ctx context.Context, req types.GetAppSessionRequest) (types.WebSession, error)
+}
+
+// Store resolves an app access cookie value to the WebSession it names. It
+// is safe for concurrent use. HandlerConfig.SessionCache holds a Store that
+// sits in front of HandlerConfig.AccessPoint.
+type Store interface {
+	// Get returns the WebSession named by cookieValue, or a trace.NotFound
+	// error if no such session exists.
+	Get(ctx context.Context, cookieValue string) (types.WebSession, error)
+
+	// Invalidate discards any cached entry for cookieValue, so the next
+	// Get consults the underlying source again. Called after an
+	// AuthAttemptFailure, so a cookie that just failed validation isn't
+	// served from a stale positive cache entry.
+	Invalidate(cookieValue string)
+}
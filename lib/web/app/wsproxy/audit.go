@@ -0,0 +1,125 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsproxy
+
+import (
+	"context"
+
+	"github.com/gravitational/teleport/api/types"
+	apievents "github.com/gravitational/teleport/api/types/events"
+	"github.com/gravitational/teleport/lib/events"
+)
+
+// Emitter is the subset of auth.ClientI this package needs in order to
+// record an upgraded connection's lifecycle as audit events.
+type Emitter interface {
+	EmitAuditEvent(ctx context.Context, event apievents.AuditEvent) error
+}
+
+// logger is the subset of logrus.FieldLogger this package needs, kept
+// small so tests can substitute a no-op implementation.
+type logger interface {
+	Warnf(format string, args ...any)
+}
+
+type noopLogger struct{}
+
+func (noopLogger) Warnf(string, ...any) {}
+
+// sessionAuditor emits the open/periodic-chunk/close sequence of audit
+// events for one upgraded connection.
+type sessionAuditor struct {
+	emitter   Emitter
+	log       logger
+	user      string
+	appServer types.AppServer
+	sessionID string
+}
+
+func newSessionAuditor(emitter Emitter, log logger, user string, appServer types.AppServer, sessionID string) *sessionAuditor {
+	if log == nil {
+		log = noopLogger{}
+	}
+	return &sessionAuditor{emitter: emitter, log: log, user: user, appServer: appServer, sessionID: sessionID}
+}
+
+func (a *sessionAuditor) appMetadata() apievents.AppMetadata {
+	if a.appServer == nil {
+		return apievents.AppMetadata{}
+	}
+	app := a.appServer.GetApp()
+	return apievents.AppMetadata{
+		AppName:       app.GetName(),
+		AppPublicAddr: app.GetPublicAddr(),
+		AppURI:        app.GetURI(),
+	}
+}
+
+func (a *sessionAuditor) emit(ctx context.Context, event apievents.AuditEvent) {
+	if a.emitter == nil {
+		return
+	}
+	if err := a.emitter.EmitAuditEvent(ctx, event); err != nil {
+		a.log.Warnf("Failed to emit app session audit event for %v: %v.", a.sessionID, err)
+	}
+}
+
+// start emits the connection-opened event.
+func (a *sessionAuditor) start(ctx context.Context) {
+	a.emit(ctx, &apievents.AppSessionStart{
+		Metadata: apievents.Metadata{
+			Type: events.AppSessionStartEvent,
+			Code: events.AppSessionStartCode,
+		},
+		UserMetadata: apievents.UserMetadata{User: a.user},
+		AppMetadata:  a.appMetadata(),
+		SessionID:    a.sessionID,
+	})
+}
+
+// chunk emits a periodic byte-counter update for the connection.
+func (a *sessionAuditor) chunk(ctx context.Context, counters Counters) {
+	a.emit(ctx, &apievents.AppSessionChunk{
+		Metadata: apievents.Metadata{
+			Type: events.AppSessionChunkEvent,
+			Code: events.AppSessionChunkCode,
+		},
+		UserMetadata: apievents.UserMetadata{User: a.user},
+		AppMetadata:  a.appMetadata(),
+		SessionID:    a.sessionID,
+		BytesRead:    counters.BytesRead,
+		BytesWritten: counters.BytesWritten,
+	})
+}
+
+// end emits the connection-closed event with final byte counts.
+func (a *sessionAuditor) end(ctx context.Context, counters Counters, cause error) {
+	event := &apievents.AppSessionEnd{
+		Metadata: apievents.Metadata{
+			Type: events.AppSessionEndEvent,
+			Code: events.AppSessionEndCode,
+		},
+		UserMetadata: apievents.UserMetadata{User: a.user},
+		AppMetadata:  a.appMetadata(),
+		SessionID:    a.sessionID,
+		BytesRead:    counters.BytesRead,
+		BytesWritten: counters.BytesWritten,
+		Status:       apievents.Status{Success: cause == nil},
+	}
+	if cause != nil {
+		event.Status.Error = cause.Error()
+	}
+	a.emit(ctx, event)
+}
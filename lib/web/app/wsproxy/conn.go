@@ -0,0 +1,80 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsproxy
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// accountingConn wraps a net.Conn, counting bytes read and written and
+// optionally throttling both to a *rate.Limiter, so a single upgraded
+// connection can be metered and capped the same way as any other
+// connection moving through the reverse tunnel.
+type accountingConn struct {
+	net.Conn
+	ctx     context.Context
+	limiter *rate.Limiter
+
+	bytesRead    atomic.Int64
+	bytesWritten atomic.Int64
+}
+
+// newAccountingConn wraps conn. limiter may be nil, for unlimited
+// throughput.
+func newAccountingConn(ctx context.Context, conn net.Conn, limiter *rate.Limiter) *accountingConn {
+	return &accountingConn{Conn: conn, ctx: ctx, limiter: limiter}
+}
+
+func (c *accountingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.bytesRead.Add(int64(n))
+		if werr := waitN(c.ctx, c.limiter, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (c *accountingConn) Write(p []byte) (int, error) {
+	if err := waitN(c.ctx, c.limiter, len(p)); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.bytesWritten.Add(int64(n))
+	}
+	return n, err
+}
+
+// Counters is a point-in-time snapshot of an accountingConn's traffic.
+type Counters struct {
+	BytesRead    int64
+	BytesWritten int64
+}
+
+// Snapshot returns the connection's cumulative byte counts so far.
+func (c *accountingConn) Snapshot() Counters {
+	return Counters{
+		BytesRead:    c.bytesRead.Load(),
+		BytesWritten: c.bytesWritten.Load(),
+	}
+}
+
+var _ net.Conn = (*accountingConn)(nil)
@@ -0,0 +1,115 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsproxy
+
+import (
+	"net/http"
+
+	"github.com/gravitational/teleport/api/types"
+	"github.com/gravitational/trace"
+)
+
+// UpgradeHandlerConfig configures an UpgradeHandler.
+type UpgradeHandlerConfig struct {
+	// Dialer opens the upstream leg of the connection.
+	Dialer Dialer
+	// Addr is the upstream address Dialer.Dial is called with.
+	Addr string
+	// Limiter enforces the app's per-app connection and throughput
+	// limits. Nil means unlimited.
+	Limiter *Limiter
+	// Limits is consulted for the per-connection byte rate; it should be
+	// the same Limits the Limiter itself was built from.
+	Limits Limits
+	// Emitter records connection lifecycle audit events. Nil discards
+	// them.
+	Emitter Emitter
+	// Log receives a warning if an audit event fails to emit.
+	Log logger
+	// AppServer identifies the app the connection belongs to, for audit
+	// event metadata.
+	AppServer types.AppServer
+}
+
+// UpgradeHandler hijacks upgrade requests (WebSocket, h2c) and splices
+// them through to the app's upstream over Dialer, applying Limiter and
+// Limits and auditing the connection's lifecycle. Plain HTTP requests
+// should never reach it; callers check IsUpgrade first and fall back to
+// the regular reverse-proxy path otherwise.
+type UpgradeHandler struct {
+	cfg UpgradeHandlerConfig
+}
+
+// NewUpgradeHandler creates an UpgradeHandler from cfg.
+func NewUpgradeHandler(cfg UpgradeHandlerConfig) *UpgradeHandler {
+	return &UpgradeHandler{cfg: cfg}
+}
+
+// ServeHTTP implements http.Handler. A rejection from Limiter is answered
+// with 429 Too Many Requests before the connection is ever hijacked, so a
+// client over the limit gets an ordinary HTTP response rather than a
+// connection that's accepted and then immediately dropped.
+//
+// The original request is re-serialized onto the upstream connection
+// before the client side is hijacked, since by the time a handler runs,
+// net/http has already consumed the request line and headers off the raw
+// connection into r; without replaying them, the upstream would never see
+// the upgrade handshake it needs to complete before raw bytes can be
+// spliced through.
+func (h *UpgradeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	release, err := h.cfg.Limiter.Admit()
+	if err != nil {
+		http.Error(w, trace.UserMessage(err), http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
+	upstream, err := h.cfg.Dialer.Dial("tcp", h.cfg.Addr)
+	if err != nil {
+		http.Error(w, "failed to dial upstream application", http.StatusBadGateway)
+		return
+	}
+	if err := r.Write(upstream); err != nil {
+		upstream.Close()
+		http.Error(w, "failed to forward upgrade request", http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "connection upgrade not supported", http.StatusInternalServerError)
+		return
+	}
+	clientConn, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		http.Error(w, "failed to hijack connection", http.StatusInternalServerError)
+		return
+	}
+	defer clientConn.Close()
+	defer upstream.Close()
+
+	user := ""
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		user = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	auditor := newSessionAuditor(h.cfg.Emitter, h.cfg.Log, user, h.cfg.AppServer, r.Header.Get("X-Teleport-Session-Id"))
+
+	// Splice blocks until the connection ends; ServeHTTP's caller (the
+	// HTTP server) runs each request on its own goroutine, so this is the
+	// upgraded connection's entire lifetime.
+	_ = Splice(r.Context(), clientConn, upstream, h.cfg.Limits, auditor)
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsproxy
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gravitational/trace"
+	"golang.org/x/time/rate"
+)
+
+// Limits bounds one app's long-lived connections. Zero means unlimited,
+// matching types.AppSpecV3's existing convention for optional numeric
+// fields (e.g. how Rewrite is left zero-value when unused): an
+// AppSpecV3.ConnectionLimits of {} imposes nothing, so upgrading Teleport
+// doesn't start rejecting connections an operator never asked to be
+// limited.
+type Limits struct {
+	// MaxConnections caps the number of concurrently open upgraded
+	// connections for the app. Zero means unlimited.
+	MaxConnections int
+	// MaxBytesPerSecond caps the combined read+write throughput of a
+	// single upgraded connection. Zero means unlimited.
+	MaxBytesPerSecond int64
+}
+
+// Limiter admits or rejects new upgraded connections for one app, and
+// rate-limits the bytes each admitted connection moves.
+type Limiter struct {
+	limits Limits
+
+	mu      sync.Mutex
+	current int
+}
+
+// NewLimiter creates a Limiter enforcing limits.
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{limits: limits}
+}
+
+// Admit reserves a connection slot, returning a release func to call when
+// the connection closes. It returns a trace.LimitExceeded error, the
+// proxy's cue to answer the upgrade with 429, if MaxConnections is already
+// at capacity. A nil Limiter imposes no limit, so UpgradeHandlerConfig.Limiter
+// can be left nil when an app has none configured.
+func (l *Limiter) Admit() (release func(), err error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limits.MaxConnections > 0 && l.current >= l.limits.MaxConnections {
+		return nil, trace.LimitExceeded("app has reached its limit of %v concurrent connections", l.limits.MaxConnections)
+	}
+	l.current++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.current--
+		})
+	}, nil
+}
+
+// NewByteLimiter returns a *rate.Limiter throttling a single connection to
+// Limits.MaxBytesPerSecond, or nil if throughput is unlimited, so callers
+// can skip the rate-limiting wrapper entirely rather than branching on a
+// limiter that always allows everything.
+func (l Limits) NewByteLimiter() *rate.Limiter {
+	if l.MaxBytesPerSecond <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(l.MaxBytesPerSecond), int(l.MaxBytesPerSecond))
+}
+
+// waitN blocks until limiter admits n bytes, a no-op if limiter is nil.
+func waitN(ctx context.Context, limiter *rate.Limiter, n int) error {
+	if limiter == nil {
+		return nil
+	}
+	// A single Read/Write can return more bytes than the bucket's burst
+	// size, which WaitN would reject outright; split it into burst-sized
+	// waits instead of requiring every caller to chunk its own I/O.
+	burst := limiter.Burst()
+	for n > 0 {
+		take := n
+		if burst > 0 && take > burst {
+			take = burst
+		}
+		if err := limiter.WaitN(ctx, take); err != nil {
+			return trace.Wrap(err)
+		}
+		n -= take
+	}
+	return nil
+}
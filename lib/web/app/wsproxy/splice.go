@@ -0,0 +1,98 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// chunkInterval is how often Splice emits a periodic byte-counter audit
+// event for a long-lived connection, independent of how much traffic it's
+// carrying.
+const chunkInterval = 30 * time.Second
+
+// Dialer opens the upstream half of an upgraded connection, the
+// counterpart of Hijacking the client's half. In production this is
+// reversetunnelclient.RemoteSite.Dial; tests substitute a fake listener's
+// Dial.
+type Dialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// Splice copies bytes bidirectionally between clientConn and upstream
+// until either side closes or ctx is canceled. The caller is responsible
+// for admitting the connection through a Limiter before hijacking
+// clientConn, for dialing upstream, and for forwarding whatever
+// handshake/request bytes the upstream needs before calling Splice;
+// Splice itself only concerns itself with the data path from that point
+// on. The connection is wrapped in a byte limiter if
+// limits.MaxBytesPerSecond is set, and the auditor records connection
+// open, periodic chunk, and close events for the pair (accounted from the
+// client-facing leg, so the numbers reported match what the end user's
+// client actually saw).
+func Splice(ctx context.Context, clientConn, upstream net.Conn, limits Limits, auditor *sessionAuditor) error {
+	acc := newAccountingConn(ctx, clientConn, limits.NewByteLimiter())
+
+	auditor.start(ctx)
+
+	stopChunks := make(chan struct{})
+	chunksDone := make(chan struct{})
+	go func() {
+		defer close(chunksDone)
+		ticker := time.NewTicker(chunkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				auditor.chunk(ctx, acc.Snapshot())
+			case <-stopChunks:
+				return
+			}
+		}
+	}()
+
+	copyErr := copyBidirectional(acc, upstream)
+
+	close(stopChunks)
+	<-chunksDone
+
+	auditor.end(ctx, acc.Snapshot(), copyErr)
+	return copyErr
+}
+
+// copyBidirectional copies a<->b until one direction finishes, then closes
+// both connections to unblock the other direction's Read, the way closing
+// either end of a spliced pair should tear down the whole connection.
+// Returns the first non-nil error encountered, if any.
+func copyBidirectional(a, b net.Conn) error {
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(a, b)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(b, a)
+		errc <- err
+	}()
+
+	first := <-errc
+	a.Close()
+	b.Close()
+	<-errc
+	return first
+}
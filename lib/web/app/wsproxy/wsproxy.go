@@ -0,0 +1,60 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wsproxy extends the app proxy path beyond plain request/response
+// HTTP: it detects WebSocket and h2c upgrade requests, splices the
+// resulting bidirectional stream through a net.Conn dialed over the
+// reverse tunnel the same way the plain HTTP path already does, and
+// enforces the per-app concurrency and throughput limits that only matter
+// once a connection is long-lived rather than one round trip.
+package wsproxy
+
+import (
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// IsUpgrade reports whether r is asking to upgrade its connection, either
+// to the WebSocket protocol (RFC 6455) or to HTTP/2 over cleartext (h2c,
+// RFC 7540 section 3.2). Both need the underlying connection spliced
+// through rather than served as a single request/response.
+func IsUpgrade(r *http.Request) bool {
+	return isWebSocketUpgrade(r) || isH2CUpgrade(r)
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+func isH2CUpgrade(r *http.Request) bool {
+	return headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "h2c")
+}
+
+// headerContainsToken reports whether any comma-separated value of
+// r.Header[key] case-insensitively contains token, the way multiple
+// "Connection: keep-alive, Upgrade"-style headers are combined.
+func headerContainsToken(h http.Header, key, token string) bool {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	for _, v := range h[key] {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
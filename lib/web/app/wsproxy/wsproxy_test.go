@@ -0,0 +1,230 @@
+// Copyright 2023 Gravitational, Inc
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+
+	apievents "github.com/gravitational/teleport/api/types/events"
+)
+
+// fakeRemoteListener stands in for the reverse tunnel: Accept hands out one
+// side of an in-memory net.Pipe per Dial call, mirroring the real
+// fakeRemoteListener used elsewhere in lib/web/app, but self-contained so
+// this package doesn't need to depend on reversetunnelclient.
+type fakeRemoteListener struct {
+	conns chan net.Conn
+}
+
+func newFakeRemoteListener() *fakeRemoteListener {
+	return &fakeRemoteListener{conns: make(chan net.Conn)}
+}
+
+// Dial implements Dialer by handing the server side of a fresh pipe to the
+// listener and returning the client side to the caller.
+func (f *fakeRemoteListener) Dial(_, _ string) (net.Conn, error) {
+	serverSide, clientSide := net.Pipe()
+	f.conns <- serverSide
+	return clientSide, nil
+}
+
+func (f *fakeRemoteListener) Accept() (net.Conn, error) {
+	conn, ok := <-f.conns
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (f *fakeRemoteListener) Close() error {
+	close(f.conns)
+	return nil
+}
+
+func (f *fakeRemoteListener) Addr() net.Addr { return &net.IPAddr{} }
+
+type fakeEmitter struct {
+	mu     sync.Mutex
+	events []apievents.AuditEvent
+}
+
+func (f *fakeEmitter) EmitAuditEvent(_ context.Context, event apievents.AuditEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeEmitter) snapshot() []apievents.AuditEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]apievents.AuditEvent, len(f.events))
+	copy(out, f.events)
+	return out
+}
+
+// echoWebSocketServer stands up a websocket.Handler behind a
+// fakeRemoteListener, echoing every frame it receives back to the sender.
+func echoWebSocketServer(t *testing.T, listener *fakeRemoteListener) *httptest.Server {
+	t.Helper()
+	wsHandler := websocket.Handler(func(ws *websocket.Conn) {
+		_, _ = io.Copy(ws, ws)
+	})
+	server := &httptest.Server{
+		Listener: listener,
+		Config:   &http.Server{Handler: wsHandler},
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIsUpgrade(t *testing.T) {
+	newReq := func(connection, upgrade string) *http.Request {
+		r, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		require.NoError(t, err)
+		if connection != "" {
+			r.Header.Set("Connection", connection)
+		}
+		if upgrade != "" {
+			r.Header.Set("Upgrade", upgrade)
+		}
+		return r
+	}
+
+	require.True(t, IsUpgrade(newReq("Upgrade", "websocket")))
+	require.True(t, IsUpgrade(newReq("keep-alive, Upgrade", "websocket")))
+	require.True(t, IsUpgrade(newReq("Upgrade", "h2c")))
+	require.False(t, IsUpgrade(newReq("", "")))
+	require.False(t, IsUpgrade(newReq("keep-alive", "")))
+}
+
+func TestSpliceProxiesWebSocketFramesEndToEnd(t *testing.T) {
+	listener := newFakeRemoteListener()
+	t.Cleanup(func() { _ = listener.Close() })
+	echoWebSocketServer(t, listener)
+
+	emitter := &fakeEmitter{}
+	handler := NewUpgradeHandler(UpgradeHandlerConfig{
+		Dialer:  listener,
+		Addr:    "app.example.com:443",
+		Limiter: NewLimiter(Limits{}),
+		Emitter: emitter,
+	})
+
+	frontend := httptest.NewServer(handler)
+	t.Cleanup(frontend.Close)
+
+	origin := "http://localhost/"
+	url := "ws://" + frontend.Listener.Addr().String() + "/"
+	ws, err := websocket.Dial(url, "", origin)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	const message = "hello over the reverse tunnel"
+	_, err = ws.Write([]byte(message))
+	require.NoError(t, err)
+
+	reply := make([]byte, len(message))
+	_, err = ws.Read(reply)
+	require.NoError(t, err)
+	require.Equal(t, message, string(reply))
+
+	require.NoError(t, ws.Close())
+
+	require.Eventually(t, func() bool {
+		for _, e := range emitter.snapshot() {
+			if _, ok := e.(*apievents.AppSessionEnd); ok {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond, "expected an AppSessionEnd audit event after the connection closed")
+
+	var start *apievents.AppSessionStart
+	var end *apievents.AppSessionEnd
+	for _, e := range emitter.snapshot() {
+		switch ev := e.(type) {
+		case *apievents.AppSessionStart:
+			start = ev
+		case *apievents.AppSessionEnd:
+			end = ev
+		}
+	}
+	require.NotNil(t, start, "expected an AppSessionStart audit event")
+	require.NotNil(t, end, "expected an AppSessionEnd audit event")
+	require.Greater(t, end.BytesRead+end.BytesWritten, int64(0), "expected the close event to report non-zero traffic")
+}
+
+func TestUpgradeHandlerRejectsOverCapacityWith429(t *testing.T) {
+	listener := newFakeRemoteListener()
+	t.Cleanup(func() { _ = listener.Close() })
+	echoWebSocketServer(t, listener)
+
+	limiter := NewLimiter(Limits{MaxConnections: 1})
+	handler := NewUpgradeHandler(UpgradeHandlerConfig{
+		Dialer:  listener,
+		Addr:    "app.example.com:443",
+		Limiter: limiter,
+	})
+	frontend := httptest.NewServer(handler)
+	t.Cleanup(frontend.Close)
+
+	origin := "http://localhost/"
+	url := "ws://" + frontend.Listener.Addr().String() + "/"
+
+	ws1, err := websocket.Dial(url, "", origin)
+	require.NoError(t, err)
+	defer ws1.Close()
+
+	// A second connection should be rejected with 429 while the first is
+	// still open and holding the only admitted slot.
+	resp, err := http.Get("http://" + frontend.Listener.Addr().String() + "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func TestLimiterAdmitRespectsMaxConnections(t *testing.T) {
+	limiter := NewLimiter(Limits{MaxConnections: 1})
+
+	release, err := limiter.Admit()
+	require.NoError(t, err)
+
+	_, err = limiter.Admit()
+	require.Error(t, err)
+
+	release()
+
+	_, err = limiter.Admit()
+	require.NoError(t, err, "releasing the first slot should admit a new connection")
+}
+
+func TestLimiterUnlimitedByDefault(t *testing.T) {
+	var limiter *Limiter
+	release, err := limiter.Admit()
+	require.NoError(t, err)
+	release()
+}
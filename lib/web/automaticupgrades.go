@@ -16,6 +16,8 @@ package web
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -28,10 +30,43 @@ import (
 	"github.com/gravitational/teleport"
 	versionlib "github.com/gravitational/teleport/integrations/kube-agent-updater/pkg/version"
 	"github.com/gravitational/teleport/lib/automaticupgrades"
+	"github.com/gravitational/teleport/lib/automaticupgrades/compat"
 )
 
 const defaultChannelTimeout = 5 * time.Second
 
+// agentVersionHeader is the header agents use to report their currently
+// installed version when asking for an upgrade plan. Falls back to the
+// current_version query parameter so plain HTTP clients can use it too.
+const agentVersionHeader = "Teleport-Agent-Version"
+
+// agentVersionFromRequest returns the agent's reported current version, or
+// "" if neither the header nor the query parameter was supplied.
+func agentVersionFromRequest(r *http.Request) string {
+	if v := r.Header.Get(agentVersionHeader); v != "" {
+		return v
+	}
+	return r.URL.Query().Get("current_version")
+}
+
+// agentIDHeader is the header agents use to report a stable identifier
+// (e.g. their host UUID) when hitting a channel with a staged rollout
+// configured. Falls back to the host_uuid query parameter.
+const agentIDHeader = "Teleport-Agent-ID"
+
+// agentIDFromRequest returns the agent's reported ID, or "" if neither the
+// header nor the query parameter was supplied.
+func agentIDFromRequest(r *http.Request) string {
+	if v := r.Header.Get(agentIDHeader); v != "" {
+		return v
+	}
+	return r.URL.Query().Get("host_uuid")
+}
+
+// rolloutAdminTokenHeader carries the shared secret (Rollout.AdminToken)
+// that authorizes a POST to the rollout route. See Rollout.AuthorizeAdmin.
+const rolloutAdminTokenHeader = "Teleport-Rollout-Admin-Token"
+
 // automaticUpgrades implements a version server in the Teleport Proxy.
 // It is configured through the Teleport Proxy configuration and tells agent updaters
 // which version they should install.
@@ -70,8 +105,20 @@ func (h *Handler) automaticUpgrades(w http.ResponseWriter, r *http.Request, p ht
 	case "critical":
 		h.log.Debugf("Agent requesting criticality for channel %s", channelName)
 		return h.automaticUpgradesCritical(w, r, channel)
+	case "manifest":
+		h.log.Debugf("Agent requesting artifact manifest for channel %s", channelName)
+		return h.automaticUpgradesManifest(w, r, channel)
+	case "retracted":
+		h.log.Debugf("Agent requesting retraction info for channel %s", channelName)
+		return h.automaticUpgradesRetracted(w, r, channel)
+	case "plan":
+		h.log.Debugf("Agent requesting upgrade plan for channel %s", channelName)
+		return h.automaticUpgradesPlan(w, r, channel)
+	case "rollout":
+		h.log.Debugf("Rollout status/control request for channel %s", channelName)
+		return h.automaticUpgradesRollout(w, r, channel)
 	default:
-		return nil, trace.BadParameter("requestType path must end by 'version' or 'critical'")
+		return nil, trace.BadParameter("requestType path must end by 'version', 'critical', 'manifest', 'retracted', 'plan' or 'rollout'")
 	}
 }
 
@@ -80,32 +127,294 @@ func (h *Handler) automaticUpgradesVersion(w http.ResponseWriter, r *http.Reques
 	ctx, cancel := context.WithTimeout(r.Context(), defaultChannelTimeout)
 	defer cancel()
 
+	// A staged rollout only decides which of two literal versions
+	// (Previous/Target) an agent gets, by bucketing it against the
+	// rollout's current percentage; it's just a different way of arriving
+	// at targetVersion, not a reason to skip the signature, retraction, and
+	// upgrade-policy checks every other version source goes through below.
+	var targetVersion string
+	if channel.Rollout != nil {
+		agentID := agentIDFromRequest(r)
+		if agentID == "" {
+			return nil, trace.BadParameter("the %s header or host_uuid query parameter is required for a channel with a staged rollout configured", agentIDHeader)
+		}
+		critical, err := channel.GetCritical(ctx)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		targetVersion = channel.Rollout.ResolveVersion(agentID, critical)
+	} else {
+		v, err := channel.GetVersion(ctx)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		targetVersion = v
+	}
+
+	if err := channel.VerifySignature(ctx, targetVersion); err != nil {
+		return nil, trace.ConnectionProblem(err, "failed to verify version signature")
+	}
+
+	resolvedVersion, retraction, err := channel.ResolveVersion(ctx, targetVersion)
+	if err != nil {
+		return nil, trace.Wrap(err, "resolving retracted versions")
+	}
+	if resolvedVersion == "" {
+		h.log.Warnf("Target version %s is retracted (%s) and no earlier non-retracted version is available; returning no update.", targetVersion, retraction.Reason)
+		return nil, nil
+	}
+	if resolvedVersion != targetVersion {
+		h.log.Infof("Target version %s is retracted (%s); falling back to %s.", targetVersion, retraction.Reason, resolvedVersion)
+		targetVersion = resolvedVersion
+	}
+
+	if agentVersion := agentVersionFromRequest(r); agentVersion != "" {
+		// The agent told us its current version, so the upgrade-path policy
+		// engine can make a real decision (no downgrades, capped major
+		// jumps, minor-skew window, required intermediate stops) instead of
+		// the blunt major-only guardrail below.
+		decision, err := compat.Resolve(channel.UpgradePolicy, agentVersion, targetVersion, channel.VersionHistory)
+		if err != nil {
+			return nil, trace.Wrap(err, "evaluating upgrade policy")
+		}
+		if decision.Version != targetVersion {
+			h.log.Infof("Upgrade policy adjusted target from %s to %s for agent on %s: %s", targetVersion, decision.Version, agentVersion, decision.Message)
+		}
+		targetVersion = decision.Version
+	} else {
+		// We don't want to tell the updater to upgrade to a new major we don't support yet
+		// This is mainly a workaround for Teleport Cloud and might be removed
+		// In the future when we'll have better tooling to control version channels.
+		targetMajor, err := parseMajorFromVersionString(targetVersion)
+		if err != nil {
+			return nil, trace.Wrap(err, "failed to process target version")
+		}
+
+		teleportMajor, err := parseMajorFromVersionString(teleport.Version)
+		if err != nil {
+			return nil, trace.Wrap(err, "failed to process teleport version")
+		}
+
+		if targetMajor > teleportMajor {
+			// TODO: improve the way updaters handle an empty response
+			h.log.Debugf("Client hit channel %s, target version (%s) major is above the proxy major (%s). Ignoring update.")
+			return nil, nil
+		}
+	}
+
+	// Older updaters only understand a bare version string; newer ones that
+	// want artifact metadata (checksum, signature, userMessage) ask for it
+	// via content negotiation instead of a version bump, so both can hit the
+	// same route.
+	if acceptsJSON(r) {
+		return nil, trace.Wrap(h.writeVersionManifest(ctx, w, r, channel, targetVersion))
+	}
+
+	_, err = w.Write([]byte(targetVersion))
+	return nil, trace.Wrap(err)
+}
+
+// automaticUpgradesManifest handles structured artifact manifest requests
+// from updaters that want per-platform download metadata up front, without
+// relying on content negotiation against the plain-text version route.
+func (h *Handler) automaticUpgradesManifest(w http.ResponseWriter, r *http.Request, channel *automaticupgrades.Channel) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), defaultChannelTimeout)
+	defer cancel()
+
 	targetVersion, err := channel.GetVersion(ctx)
 	if err != nil {
 		return nil, trace.Wrap(err)
 	}
 
-	// We don't want to tell the updater to upgrade to a new major we don't support yet
-	// This is mainly a workaround for Teleport Cloud and might be removed
-	// In the future when we'll have better tooling to control version channels.
-	targetMajor, err := parseMajorFromVersionString(targetVersion)
+	if err := channel.VerifySignature(ctx, targetVersion); err != nil {
+		return nil, trace.ConnectionProblem(err, "failed to verify version signature")
+	}
+
+	resolvedVersion, retraction, err := channel.ResolveVersion(ctx, targetVersion)
 	if err != nil {
-		return nil, trace.Wrap(err, "failed to process target version")
+		return nil, trace.Wrap(err, "resolving retracted versions")
+	}
+	if resolvedVersion == "" {
+		h.log.Warnf("Target version %s is retracted (%s) and no earlier non-retracted version is available; returning no update.", targetVersion, retraction.Reason)
+		return nil, nil
+	}
+	if resolvedVersion != targetVersion {
+		h.log.Infof("Target version %s is retracted (%s); falling back to %s.", targetVersion, retraction.Reason, resolvedVersion)
+		targetVersion = resolvedVersion
+	}
+
+	if agentVersion := agentVersionFromRequest(r); agentVersion != "" {
+		decision, err := compat.Resolve(channel.UpgradePolicy, agentVersion, targetVersion, channel.VersionHistory)
+		if err != nil {
+			return nil, trace.Wrap(err, "evaluating upgrade policy")
+		}
+		if decision.Version != targetVersion {
+			h.log.Infof("Upgrade policy adjusted target from %s to %s for agent on %s: %s", targetVersion, decision.Version, agentVersion, decision.Message)
+		}
+		targetVersion = decision.Version
 	}
 
-	teleportMajor, err := parseMajorFromVersionString(teleport.Version)
+	return nil, trace.Wrap(h.writeVersionManifest(ctx, w, r, channel, targetVersion))
+}
+
+// automaticUpgradesRetracted handles requests for a channel's configured
+// retraction list, so operators/agents can see why a version might be (or
+// has been) skipped in favor of an earlier release.
+func (h *Handler) automaticUpgradesRetracted(w http.ResponseWriter, r *http.Request, channel *automaticupgrades.Channel) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), defaultChannelTimeout)
+	defer cancel()
+
+	retractedRanges, err := channel.Retracted(ctx)
 	if err != nil {
-		return nil, trace.Wrap(err, "failed to process teleport version")
+		return nil, trace.Wrap(err)
 	}
 
-	if targetMajor > teleportMajor {
-		// TODO: improve the way updaters handle an empty response
-		h.log.Debugf("Client hit channel %s, target version (%s) major is above the proxy major (%s). Ignoring update.")
-		return nil, nil
+	w.Header().Set("Content-Type", "application/json")
+	return nil, trace.Wrap(json.NewEncoder(w).Encode(retractedRanges))
+}
+
+// automaticUpgradesPlan exposes the upgrade-path policy decision for an
+// agent reporting its current version (via the Teleport-Agent-Version
+// header or current_version query parameter), so operators can debug why
+// an agent was (or wasn't) told to move to a given version without having
+// to reproduce the agent's own request.
+func (h *Handler) automaticUpgradesPlan(w http.ResponseWriter, r *http.Request, channel *automaticupgrades.Channel) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), defaultChannelTimeout)
+	defer cancel()
+
+	agentVersion := agentVersionFromRequest(r)
+	if agentVersion == "" {
+		return nil, trace.BadParameter("the %s header or current_version query parameter is required", agentVersionHeader)
 	}
 
-	_, err = w.Write([]byte(targetVersion))
-	return nil, trace.Wrap(err)
+	targetVersion, err := channel.GetVersion(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	if err := channel.VerifySignature(ctx, targetVersion); err != nil {
+		return nil, trace.ConnectionProblem(err, "failed to verify version signature")
+	}
+
+	resolvedVersion, retraction, err := channel.ResolveVersion(ctx, targetVersion)
+	if err != nil {
+		return nil, trace.Wrap(err, "resolving retracted versions")
+	}
+
+	var decision compat.Decision
+	if resolvedVersion == "" {
+		decision = compat.Decision{
+			Version: agentVersion,
+			Reason:  compat.ReasonRetracted,
+			Message: fmt.Sprintf("target version %s is retracted (%s) and no earlier non-retracted version is available", targetVersion, retraction.Reason),
+		}
+	} else {
+		decision, err = compat.Resolve(channel.UpgradePolicy, agentVersion, resolvedVersion, channel.VersionHistory)
+		if err != nil {
+			return nil, trace.Wrap(err, "evaluating upgrade policy")
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return nil, trace.Wrap(json.NewEncoder(w).Encode(decision))
+}
+
+// rolloutActionRequest is the JSON body accepted by a POST to the rollout
+// route. Action must be one of "pause", "resume" or "rollback"; GET requests
+// (and the response to any successful POST) just report current status.
+type rolloutActionRequest struct {
+	Action string `json:"action"`
+}
+
+// automaticUpgradesRollout reports the status of a channel's staged rollout,
+// and, on POST, lets an operator pause, resume, or permanently roll it back.
+func (h *Handler) automaticUpgradesRollout(w http.ResponseWriter, r *http.Request, channel *automaticupgrades.Channel) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), defaultChannelTimeout)
+	defer cancel()
+
+	if channel.Rollout == nil {
+		return nil, trace.NotFound("channel does not have a staged rollout configured")
+	}
+
+	if r.Method == http.MethodPost {
+		// This route is reached through the same unauthenticated,
+		// session-less path as the version/critical/manifest agent
+		// endpoints, so a role check against a session isn't available
+		// here: the rollout's own AdminToken is the only thing standing
+		// between this action and anyone on the network.
+		if !channel.Rollout.AuthorizeAdmin(r.Header.Get(rolloutAdminTokenHeader)) {
+			return nil, trace.AccessDenied("missing or incorrect %s header", rolloutAdminTokenHeader)
+		}
+
+		var req rolloutActionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, trace.BadParameter("invalid rollout action request: %v", err)
+		}
+		switch req.Action {
+		case "pause":
+			channel.Rollout.Pause()
+		case "resume":
+			channel.Rollout.Resume()
+		case "rollback":
+			channel.Rollout.RollBack()
+		default:
+			return nil, trace.BadParameter("unrecognized rollout action %q, must be one of 'pause', 'resume', 'rollback'", req.Action)
+		}
+	}
+
+	critical, err := channel.GetCritical(ctx)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
+	status := automaticupgrades.RolloutStatus{
+		Percentage: channel.Rollout.CurrentPercentage(critical),
+		Paused:     channel.Rollout.Paused(),
+		RolledBack: channel.Rollout.RolledBack(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return nil, trace.Wrap(json.NewEncoder(w).Encode(status))
+}
+
+// versionManifestResponse is the JSON body served by the version route under
+// content negotiation and by the dedicated manifest route. Artifact is
+// omitted when the caller didn't supply both "os" and "arch" query
+// parameters, or when the channel has nothing published for that platform.
+type versionManifestResponse struct {
+	Version  string                      `json:"version"`
+	Artifact *automaticupgrades.Artifact `json:"artifact,omitempty"`
+}
+
+// writeVersionManifest resolves the artifact for the "os"/"arch" query
+// parameters on r, if both are present, and writes the JSON response to w.
+// A missing artifact for the requested platform is not an error: it falls
+// back to a version-only response so an updater can still learn the target
+// version and decide how to proceed (e.g. fetch the build itself).
+func (h *Handler) writeVersionManifest(ctx context.Context, w http.ResponseWriter, r *http.Request, channel *automaticupgrades.Channel, targetVersion string) error {
+	resp := versionManifestResponse{Version: targetVersion}
+
+	osName := r.URL.Query().Get("os")
+	arch := r.URL.Query().Get("arch")
+	if osName != "" && arch != "" {
+		artifact, err := channel.GetArtifact(ctx, osName, arch)
+		switch {
+		case trace.IsNotFound(err):
+			h.log.Debugf("No artifact published for os=%s arch=%s, falling back to version-only response.", osName, arch)
+		case err != nil:
+			return trace.Wrap(err)
+		default:
+			resp.Artifact = artifact
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return trace.Wrap(json.NewEncoder(w).Encode(resp))
+}
+
+// acceptsJSON reports whether r's Accept header asks for a JSON response.
+func acceptsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
 }
 
 // automaticUpgradesCritical handles criticality requests from upgraders